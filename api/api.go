@@ -2,17 +2,23 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/metrics"
 	stg "github.com/vocdoni/vocdoni-z-sandbox/storage"
 )
 
@@ -22,16 +28,55 @@ type APIConfig struct {
 	Host    string
 	Port    int
 	Storage *stg.Storage // Optional: use existing storage instance
+	// OrganizationAdmins is used to authorize the process setup requests
+	// against the administrators of the organizations of each chain, where
+	// the key is the chainID. If it is empty, any address can setup processes
+	// for its own organization on any chain.
+	OrganizationAdmins map[uint32]OrganizationAdmins
+	// Authenticator is used to authorize the administrative requests, such
+	// as the process setup, the census write operations and the metrics,
+	// according to the scopes granted to their credentials. The public read
+	// and vote endpoints are not authenticated. If it is nil, the
+	// administrative requests are rejected, unless InsecureNoAuth is set.
+	Authenticator Authenticator
+	// InsecureNoAuth serves the administrative endpoints without
+	// authentication if no Authenticator is set. It must only be used for
+	// development and testing.
+	InsecureNoAuth bool
 }
 
+// OrganizationAdmins defines the interface to check if an account is an
+// administrator of an organization.
+type OrganizationAdmins interface {
+	IsOrganizationAdministrator(orgID, account common.Address) (bool, error)
+}
+
+// readHeaderTimeout is the maximum time to read the headers of a request.
+const readHeaderTimeout = 10 * time.Second
+
 // API type represents the API HTTP server with JWT authentication capabilities.
 type API struct {
-	router  *chi.Mux
-	storage *stg.Storage
+	router    *chi.Mux
+	server    *http.Server
+	listener  net.Listener
+	storage   *stg.Storage
+	orgAdmins map[uint32]OrganizationAdmins
+	auth      Authenticator
+	// insecureNoAuth serves the administrative endpoints without
+	// authentication if auth is nil
+	insecureNoAuth bool
+	// censusImports keeps the census bulk import jobs
+	censusImports *censusImports
+	// shutdown is closed when the server starts shutting down, so the
+	// long-lived event streams end and do not hold the shutdown
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
 // New creates a new API instance with the given configuration.
-// It also initializes the storage and starts the HTTP server.
+// It also initializes the router and starts the HTTP server. It returns an
+// error if the server cannot listen on the configured address. If the port
+// is zero, a free port is chosen, which is returned by HostPort.
 func New(conf *APIConfig) (*API, error) {
 	if conf == nil {
 		return nil, fmt.Errorf("missing API configuration")
@@ -40,67 +85,145 @@ func New(conf *APIConfig) (*API, error) {
 		return nil, fmt.Errorf("missing storage instance")
 	}
 	a := &API{
-		storage: conf.Storage,
+		storage:   conf.Storage,
+		orgAdmins: conf.OrganizationAdmins,
+		auth:      conf.Authenticator,
+		shutdown:  make(chan struct{}),
+
+		insecureNoAuth: conf.InsecureNoAuth,
+
+		censusImports: newCensusImports(),
+	}
+	if a.auth == nil {
+		if a.insecureNoAuth {
+			log.Warnw("API authentication disabled, the administrative endpoints are open")
+		} else {
+			log.Warnw("API authenticator not configured, the administrative endpoints are disabled")
+		}
 	}
 
 	// Initialize router
 	a.initRouter()
+	listener, err := net.Listen("tcp", net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s:%d: %w", conf.Host, conf.Port, err)
+	}
+	a.listener = listener
+	a.server = &http.Server{
+		Handler:           a.router,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	a.server.RegisterOnShutdown(func() {
+		a.shutdownOnce.Do(func() { close(a.shutdown) })
+	})
 	go func() {
-		log.Infow("Starting API server", "host", conf.Host, "port", conf.Port)
-		if err := http.ListenAndServe(fmt.Sprintf("%s:%d", conf.Host, conf.Port), a.router); err != nil {
-			log.Fatalf("failed to start the API server: %v", err)
+		log.Infow("Starting API server", "address", listener.Addr().String())
+		if err := a.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorw(err, "API server stopped")
 		}
 	}()
 	return a, nil
 }
 
+// HostPort returns the host and port where the API server is listening,
+// which is the port chosen if the configured port was zero.
+func (a *API) HostPort() (string, int) {
+	addr := a.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// Shutdown gracefully stops the API server. It stops accepting connections,
+// ends the event streams, cancels the census imports and waits for the
+// requests and imports in progress until they finish or the context provided
+// is done.
+func (a *API) Shutdown(ctx context.Context) error {
+	err := a.server.Shutdown(ctx)
+	if importsErr := a.censusImports.stop(ctx); err == nil {
+		err = importsErr
+	}
+	return err
+}
+
 // Router returns the chi router for testing purposes
 func (a *API) Router() *chi.Mux {
 	return a.router
 }
 
-// registerHandlers registers all the HTTP handlers for the API endpoints.
-func (a *API) registerHandlers() {
-	// The following endpoints are registered:
+// registerHandlers registers all the HTTP handlers for the API endpoints in
+// the router provided, except the event streams and the census imports.
+func (a *API) registerHandlers(r chi.Router) {
+	// The following endpoints are registered, the ones with a scope require
+	// credentials that grant it:
 	// - GET /ping: No parameters
-	// - POST /process: No parameters
+	// - GET /metrics: No parameters (scope: operator)
+	// - POST /process: No parameters (scope: process:admin)
 	// - GET /process: No parameters
-	// - POST /census: No parameters
-	// - POST /census/<uuid>/participants: No parameters
-	// - GET /census/<uuid>/participants: No parameters
+	// - GET /process/<processId>/results: No parameters
+	// - GET /processes?organizationId=<address>&chainId=<n>&status=<n>&from=<time>&to=<time>&pageSize=<n>&cursor=<cursor>: Parameters: organizationId, chainId, status, from, to, pageSize, cursor
+	// - POST /census: Optional body with the census hash type (scope: census:write)
+	// - POST /census/derive: No parameters (scope: census:write)
+	// - POST /census/<uuid>/participants: No parameters (scope: census:write)
+	// - PUT /census/<uuid>/participants: No parameters (scope: census:write)
+	// - DELETE /census/<uuid>/participants: No parameters (scope: census:write)
+	// - GET /census/<uuid>/participants?pageSize=<n>&cursor=<cursor>&format=<ndjson>: Parameters: pageSize, cursor, format
 	// - GET /census/<uuid>/root: No parameters
 	// - GET /census/<uuid or root>/size: No parameters
-	// - DELETE /census/<uuid>: No parameters
+	// - DELETE /census/<uuid>: No parameters (scope: census:write)
 	// - GET /census/<root>/proof?key=<key>: Parameters: key
+	// - POST /census/<root>/proofs: No parameters
+	// - POST /census/<uuid>/publish: No parameters (scope: census:write)
+	// - GET /census/<uuid>/import/<jobID>: No parameters
 	log.Infow("register handler", "endpoint", PingEndpoint, "method", "GET")
-	a.router.Get(PingEndpoint, func(w http.ResponseWriter, r *http.Request) {
+	r.Get(PingEndpoint, func(w http.ResponseWriter, _ *http.Request) {
 		httpWriteOK(w)
 	})
+	log.Infow("register handler", "endpoint", MetricsEndpoint, "method", "GET", "scope", ScopeOperator)
+	r.With(a.requireScope(ScopeOperator)).Method(http.MethodGet, MetricsEndpoint, metrics.Handler(metrics.NewStorageCollector(a.storage)))
 	// processes endpoints
-	log.Infow("register handler", "endpoint", ProcessesEndpoint, "method", "POST")
-	a.router.Post(ProcessesEndpoint, a.newProcess)
+	log.Infow("register handler", "endpoint", ProcessesEndpoint, "method", "POST", "scope", ScopeProcessAdmin)
+	r.With(a.requireScope(ScopeProcessAdmin)).Post(ProcessesEndpoint, a.newProcess)
+	log.Infow("register handler", "endpoint", ProcessesEndpoint, "method", "GET")
+	r.Get(ProcessesEndpoint, a.listProcesses)
 	log.Infow("register handler", "endpoint", ProcessEndpoint, "method", "GET")
-	a.router.Get(ProcessEndpoint, a.process)
+	r.Get(ProcessEndpoint, a.process)
+	log.Infow("register handler", "endpoint", ProcessResultsEndpoint, "method", "GET")
+	r.Get(ProcessResultsEndpoint, a.processResults)
 	// votes endpoints
 	log.Infow("register handler", "endpoint", VotesEndpoint, "method", "POST")
-	a.router.Post(VotesEndpoint, a.newVote)
+	r.Post(VotesEndpoint, a.newVote)
 	// census endpoints
-	log.Infow("register handler", "endpoint", NewCensusEndpoint, "method", "POST")
-	a.router.Post(NewCensusEndpoint, a.newCensus)
-	log.Infow("register handler", "endpoint", AddCensusParticipantsEndpoint, "method", "POST")
-	a.router.Post(AddCensusParticipantsEndpoint, a.addCensusParticipants)
+	log.Infow("register handler", "endpoint", NewCensusEndpoint, "method", "POST", "scope", ScopeCensusWrite)
+	r.With(a.requireScope(ScopeCensusWrite)).Post(NewCensusEndpoint, a.newCensus)
+	log.Infow("register handler", "endpoint", DeriveCensusEndpoint, "method", "POST", "scope", ScopeCensusWrite)
+	r.With(a.requireScope(ScopeCensusWrite)).Post(DeriveCensusEndpoint, a.deriveCensus)
+	log.Infow("register handler", "endpoint", AddCensusParticipantsEndpoint, "method", "POST", "scope", ScopeCensusWrite)
+	r.With(a.requireScope(ScopeCensusWrite)).Post(AddCensusParticipantsEndpoint, a.addCensusParticipants)
+	log.Infow("register handler", "endpoint", UpdateCensusParticipantsEndpoint, "method", "PUT", "scope", ScopeCensusWrite)
+	r.With(a.requireScope(ScopeCensusWrite)).Put(UpdateCensusParticipantsEndpoint, a.updateCensusParticipants)
+	log.Infow("register handler", "endpoint", DeleteCensusParticipantsEndpoint, "method", "DELETE", "scope", ScopeCensusWrite)
+	r.With(a.requireScope(ScopeCensusWrite)).Delete(DeleteCensusParticipantsEndpoint, a.deleteCensusParticipants)
 	log.Infow("register handler", "endpoint", GetCensusParticipantsEndpoint, "method", "GET")
-	a.router.Get(GetCensusParticipantsEndpoint, a.getCensusParticipants)
+	r.Get(GetCensusParticipantsEndpoint, a.getCensusParticipants)
 	log.Infow("register handler", "endpoint", GetCensusRootEndpoint, "method", "GET")
-	a.router.Get(GetCensusRootEndpoint, a.getCensusRoot)
+	r.Get(GetCensusRootEndpoint, a.getCensusRoot)
 	log.Infow("register handler", "endpoint", GetCensusSizeEndpoint, "method", "GET")
-	a.router.Get(GetCensusSizeEndpoint, a.getCensusSize)
-	log.Infow("register handler", "endpoint", DeleteCensusEndpoint, "method", "DELETE")
-	a.router.Delete(DeleteCensusEndpoint, a.deleteCensus)
+	r.Get(GetCensusSizeEndpoint, a.getCensusSize)
+	log.Infow("register handler", "endpoint", DeleteCensusEndpoint, "method", "DELETE", "scope", ScopeCensusWrite)
+	r.With(a.requireScope(ScopeCensusWrite)).Delete(DeleteCensusEndpoint, a.deleteCensus)
 	log.Infow("register handler", "endpoint", GetCensusProofEndpoint, "method", "GET", "parameters", "key")
-	a.router.Get(GetCensusProofEndpoint, a.getCensusProof)
+	r.Get(GetCensusProofEndpoint, a.getCensusProof)
+	log.Infow("register handler", "endpoint", GetCensusProofsEndpoint, "method", "POST")
+	r.Post(GetCensusProofsEndpoint, a.getCensusProofs)
+	log.Infow("register handler", "endpoint", PublishCensusEndpoint, "method", "POST", "scope", ScopeCensusWrite)
+	r.With(a.requireScope(ScopeCensusWrite)).Post(PublishCensusEndpoint, a.publishCensus)
+	log.Infow("register handler", "endpoint", CensusImportJobEndpoint, "method", "GET")
+	r.Get(CensusImportJobEndpoint, a.getCensusImportJob)
 }
 
+// maxLoggedBodySize is the maximum number of bytes of the request bodies
+// logged in debug mode.
+const maxLoggedBodySize = 4 << 10
+
 // bufPool is a pool of bytes.Buffer to reduce logger allocations.
 var bufPool = sync.Pool{
 	New: func() interface{} {
@@ -122,26 +245,33 @@ func (a *API) initRouter() {
 			buf := bufPool.Get().(*bytes.Buffer)
 			buf.Reset()
 
-			// Read the request body into the buffer.
-			bodyBytes, err := io.ReadAll(r.Body)
+			// Read the beginning of the request body into the buffer, the
+			// census imports and proofs might be too large to be logged.
+			n, err := io.Copy(buf, io.LimitReader(r.Body, maxLoggedBodySize+1))
 			if err != nil {
 				http.Error(w, "unable to read request body", http.StatusInternalServerError)
 				bufPool.Put(buf)
 				return
 			}
-
-			// Write the bytes into our buffer.
-			buf.Write(bodyBytes)
+			bodyBytes := bytes.Clone(buf.Bytes())
+			body := buf.String()
+			if n > maxLoggedBodySize {
+				body = body[:maxLoggedBodySize] + "...(truncated)"
+			}
 
 			// Log the request details.
 			log.Debugw("api request",
 				"method", r.Method,
 				"url", r.URL.String(),
-				"body", strings.ReplaceAll(buf.String(), "\"", ""),
+				"body", strings.ReplaceAll(body, "\"", ""),
 			)
 
-			// Restore the body for the next handler.
-			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+			// Restore the body for the next handler, which streams the rest
+			// of it.
+			r.Body = &struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(bodyBytes), r.Body), r.Body}
 			// Return the buffer to the pool.
 			bufPool.Put(buf)
 
@@ -153,15 +283,21 @@ func (a *API) initRouter() {
 	a.router.Use(cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", CensusAuthTokenHeader, LastEventIDHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}).Handler)
 	a.router.Use(logHandler)
 	a.router.Use(middleware.Recoverer)
-	a.router.Use(middleware.Throttle(100))
-	a.router.Use(middleware.ThrottleBacklog(5000, 40000, 60*time.Second))
-	a.router.Use(middleware.Timeout(45 * time.Second))
 
-	a.registerHandlers()
+	// the event streams are long-lived, so they are neither throttled nor
+	// timed out
+	a.registerStreamHandlers()
+	a.registerImportHandlers()
+	a.router.Group(func(r chi.Router) {
+		r.Use(middleware.Throttle(100))
+		r.Use(middleware.ThrottleBacklog(5000, 40000, 60*time.Second))
+		r.Use(middleware.Timeout(45 * time.Second))
+		a.registerHandlers(r)
+	})
 }
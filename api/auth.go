@@ -0,0 +1,145 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Scope is a permission granted to the credentials of an administrative
+// request.
+type Scope string
+
+const (
+	// ScopeCensusWrite allows to create, modify, publish and delete
+	// censuses.
+	ScopeCensusWrite Scope = "census:write"
+	// ScopeProcessAdmin allows to setup processes.
+	ScopeProcessAdmin Scope = "process:admin"
+	// ScopeOperator allows to access the operational endpoints, such as the
+	// metrics, and grants every other scope.
+	ScopeOperator Scope = "operator"
+)
+
+// Authenticator validates the credentials of an administrative request and
+// returns the scopes granted to them. It returns an error if the request has
+// no valid credentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) ([]Scope, error)
+}
+
+// APIKeys is an Authenticator of static API keys, sent as bearer tokens in
+// the AuthorizationHeader. Each key is mapped to the scopes it grants.
+type APIKeys map[string][]Scope
+
+// Authenticate implements Authenticator. The keys are compared in constant
+// time.
+func (k APIKeys) Authenticate(r *http.Request) ([]Scope, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	tokenHash := sha256.Sum256([]byte(token))
+	var scopes []Scope
+	found := 0
+	for key, keyScopes := range k {
+		keyHash := sha256.Sum256([]byte(key))
+		if subtle.ConstantTimeCompare(tokenHash[:], keyHash[:]) == 1 {
+			scopes = keyScopes
+			found = 1
+		}
+	}
+	if found == 0 {
+		return nil, fmt.Errorf("unknown API key")
+	}
+	return scopes, nil
+}
+
+// JWTClaims are the claims of the JSON Web Tokens accepted by the
+// JWTAuthenticator. The scopes granted are listed in the scopes claim.
+type JWTClaims struct {
+	Scopes []Scope `json:"scopes"`
+	jwt.RegisteredClaims
+}
+
+// JWTAuthenticator is an Authenticator of JSON Web Tokens signed with HMAC
+// SHA-256 with the key provided, sent as bearer tokens in the
+// AuthorizationHeader. The expiration and not before claims are checked if
+// they are present.
+type JWTAuthenticator struct {
+	Key []byte
+}
+
+// Authenticate implements Authenticator.
+func (j *JWTAuthenticator) Authenticate(r *http.Request) ([]Scope, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	claims := &JWTClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return j.Key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()})); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	return claims.Scopes, nil
+}
+
+// NewJWT returns a JSON Web Token signed with the key provided that grants
+// the scopes provided, to be validated by a JWTAuthenticator with the same
+// key. The token does not expire, unless the registered claims provided set
+// an expiration time.
+func NewJWT(key []byte, claims jwt.RegisteredClaims, scopes ...Scope) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, &JWTClaims{
+		Scopes:           scopes,
+		RegisteredClaims: claims,
+	}).SignedString(key)
+}
+
+// requireScope returns a middleware that rejects the requests whose
+// credentials do not grant the scope provided, or ScopeOperator. If the API
+// has no Authenticator, every request is rejected, unless insecureNoAuth is
+// set.
+func (a *API) requireScope(scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if a.auth == nil {
+				if a.insecureNoAuth {
+					next.ServeHTTP(w, r)
+					return
+				}
+				ErrUnauthorized.Withf("authentication not configured").Write(w)
+				return
+			}
+			scopes, err := a.auth.Authenticate(r)
+			if err != nil {
+				ErrUnauthorized.WithErr(err).Write(w)
+				return
+			}
+			if !slices.Contains(scopes, scope) && !slices.Contains(scopes, ScopeOperator) {
+				ErrUnauthorized.Withf("missing scope %s", scope).Write(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bearerToken returns the bearer token of the AuthorizationHeader of the
+// request provided.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get(AuthorizationHeader)
+	if header == "" {
+		return "", fmt.Errorf("missing %s header", AuthorizationHeader)
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, BearerScheme) || token == "" {
+		return "", fmt.Errorf("malformed %s header", AuthorizationHeader)
+	}
+	return token, nil
+}
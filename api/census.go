@@ -1,25 +1,107 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/vocdoni/arbo"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 )
 
+// streamFlushInterval is the number of participants written between flushes
+// of a streamed census.
+const streamFlushInterval = 500
+
 func (a *API) newCensus(w http.ResponseWriter, r *http.Request) {
+	// the request body is optional
+	req := &NewCensusRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		ErrMalformedBody.WithErr(err).Write(w)
+		return
+	}
 	censusID := uuid.New()
-	_, err := a.storage.CensusDB().New(censusID)
+	ref, token, err := a.storage.CensusDB().NewWithAuthToken(censusID, req.HashType)
 	if err != nil {
+		if errors.Is(err, census.ErrUnsupportedHashType) {
+			ErrUnsupportedHashType.Withf("%q, supported: %s", req.HashType,
+				strings.Join(census.SupportedHashTypes(), ", ")).Write(w)
+			return
+		}
 		ErrGenericInternalServerError.WithErr(err).Write(w)
 		return
 	}
-	httpWriteJSON(w, &NewCensus{Census: censusID})
+	httpWriteJSON(w, &NewCensus{Census: censusID, AuthToken: token, HashType: ref.HashType})
+}
+
+// deriveCensus creates a new census from the union, intersection or
+// difference of the participants of other censuses. The participants of the
+// sources are public, so no management token is required to derive from them.
+// POST /censuses/derive
+func (a *API) deriveCensus(w http.ResponseWriter, r *http.Request) {
+	req := &DeriveCensusRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		ErrMalformedBody.WithErr(err).Write(w)
+		return
+	}
+	if len(req.Sources) > MaxDeriveCensusSources {
+		ErrMalformedBody.Withf("too many sources, the maximum is %d", MaxDeriveCensusSources).Write(w)
+		return
+	}
+	censusID := uuid.New()
+	ref, token, err := a.storage.CensusDB().DeriveWithAuthToken(censusID, census.DeriveOptions{
+		Operation:  census.SetOperation(req.Operation),
+		WeightRule: census.WeightRule(req.WeightRule),
+		Sources:    req.Sources,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, census.ErrInvalidDerivation):
+			ErrInvalidDerivation.WithErr(err).Write(w)
+		case errors.Is(err, census.ErrCensusNotFound):
+			ErrCensusNotFound.WithErr(err).Write(w)
+		default:
+			ErrGenericInternalServerError.WithErr(err).Write(w)
+		}
+		return
+	}
+	httpWriteJSON(w, &DerivedCensus{
+		Census:    censusID,
+		AuthToken: token,
+		HashType:  ref.HashType,
+		Root:      ref.Root(),
+		Size:      ref.Size(),
+	})
+}
+
+// loadAuthorizedCensus loads the census provided and checks the management
+// token of the request. If something fails, it writes the error response and
+// returns nil.
+func (a *API) loadAuthorizedCensus(w http.ResponseWriter, r *http.Request, censusID uuid.UUID) *census.CensusRef {
+	ref, err := a.storage.CensusDB().Load(censusID)
+	if err != nil {
+		if errors.Is(err, census.ErrCensusNotFound) {
+			ErrCensusNotFound.WithErr(err).Write(w)
+			return nil
+		}
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return nil
+	}
+	if err := ref.CheckAuthToken(r.Header.Get(CensusAuthTokenHeader)); err != nil {
+		ErrWrongCensusAuthToken.WithErr(err).Write(w)
+		return nil
+	}
+	return ref
 }
 
 func (a *API) addCensusParticipants(w http.ResponseWriter, r *http.Request) {
@@ -40,34 +122,25 @@ func (a *API) addCensusParticipants(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ref, err := a.storage.CensusDB().Load(censusID)
-	if err != nil {
-		ErrCensusNotFound.WithErr(err).Write(w)
+	ref := a.loadAuthorizedCensus(w, r, censusID)
+	if ref == nil {
 		return
 	}
 
 	// build the list of keys and values that will be added to the tree
-	keys := [][]byte{}
-	values := [][]byte{}
-	for _, p := range participants.Participants {
-		if p.Weight == nil {
-			p.Weight = new(types.BigInt).SetUint64(1)
-		}
-		leafKey := p.Key
-		if len(p.Key) > types.CensusKeyMaxLen {
-			leafKey = a.storage.CensusDB().HashAndTrunkKey(p.Key)
-			if leafKey == nil {
-				ErrGenericInternalServerError.WithErr(fmt.Errorf("failed to hash participant key")).Write(w)
-				return
-			}
-		}
-		keys = append(keys, leafKey)
-		values = append(values, arbo.BigIntToBytes(a.storage.CensusDB().HashLen(), p.Weight.MathBigInt()))
+	keys, values, err := participantLeaves(ref, participants.Participants)
+	if err != nil {
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
 	}
 
 	// insert the keys and values into the tree
 	invalid, err := ref.InsertBatch(keys, values)
 	if err != nil {
+		if errors.Is(err, census.ErrCensusIsLocked) {
+			ErrCensusLocked.WithErr(err).Write(w)
+			return
+		}
 		ErrGenericInternalServerError.WithErr(err).Write(w)
 		return
 	}
@@ -78,6 +151,142 @@ func (a *API) addCensusParticipants(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// participantLeaves returns the keys and values of the leaves of the census
+// tree provided for the participants provided. The participants without
+// weight get a weight of one.
+func participantLeaves(ref *census.CensusRef, participants []*CensusParticipant) ([][]byte, [][]byte, error) {
+	keys := make([][]byte, 0, len(participants))
+	values := make([][]byte, 0, len(participants))
+	for _, p := range participants {
+		if p.Weight == nil {
+			p.Weight = new(types.BigInt).SetUint64(1)
+		}
+		leafKey, err := participantLeafKey(ref.HashFunction(), p.Key)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, leafKey)
+		values = append(values, arbo.BigIntToBytes(ref.HashLen(), p.Weight.MathBigInt()))
+	}
+	return keys, values, nil
+}
+
+// participantLeafKey returns the census tree leaf key of the participant key
+// provided, which is hashed with the census hash function provided if it is
+// too long.
+func participantLeafKey(hashFn arbo.HashFunction, key []byte) ([]byte, error) {
+	if len(key) <= types.CensusKeyMaxLen {
+		return key, nil
+	}
+	leafKey := census.HashAndTrunkKey(hashFn, key)
+	if leafKey == nil {
+		return nil, fmt.Errorf("failed to hash participant key")
+	}
+	return leafKey, nil
+}
+
+func (a *API) updateCensusParticipants(w http.ResponseWriter, r *http.Request) {
+	censusID, err := uuid.Parse(chi.URLParam(r, CensusURLParam))
+	if err != nil {
+		ErrMalformedBody.WithErr(err).Write(w)
+		return
+	}
+
+	var participants CensusParticipants
+	if err := json.NewDecoder(r.Body).Decode(&participants); err != nil {
+		ErrMalformedBody.WithErr(err).Write(w)
+		return
+	}
+
+	if len(participants.Participants) == 0 {
+		ErrMalformedBody.WithErr(fmt.Errorf("no participants provided")).Write(w)
+		return
+	}
+
+	ref := a.loadAuthorizedCensus(w, r, censusID)
+	if ref == nil {
+		return
+	}
+
+	keys, values, err := participantLeaves(ref, participants.Participants)
+	if err != nil {
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
+	}
+	invalid, err := ref.UpdateBatch(keys, values)
+	if err != nil {
+		if errors.Is(err, census.ErrCensusIsLocked) {
+			ErrCensusLocked.WithErr(err).Write(w)
+			return
+		}
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
+	}
+	keysProvided := make([]types.HexBytes, len(participants.Participants))
+	for i, p := range participants.Participants {
+		keysProvided[i] = p.Key
+	}
+	httpWriteJSON(w, participantsResult(keysProvided, invalid))
+}
+
+func (a *API) deleteCensusParticipants(w http.ResponseWriter, r *http.Request) {
+	censusID, err := uuid.Parse(chi.URLParam(r, CensusURLParam))
+	if err != nil {
+		ErrMalformedBody.WithErr(err).Write(w)
+		return
+	}
+
+	var participants CensusParticipantKeys
+	if err := json.NewDecoder(r.Body).Decode(&participants); err != nil {
+		ErrMalformedBody.WithErr(err).Write(w)
+		return
+	}
+
+	if len(participants.Keys) == 0 {
+		ErrMalformedBody.WithErr(fmt.Errorf("no participants provided")).Write(w)
+		return
+	}
+
+	ref := a.loadAuthorizedCensus(w, r, censusID)
+	if ref == nil {
+		return
+	}
+
+	keys := make([][]byte, len(participants.Keys))
+	for i, key := range participants.Keys {
+		if keys[i], err = participantLeafKey(ref.HashFunction(), key); err != nil {
+			ErrGenericInternalServerError.WithErr(err).Write(w)
+			return
+		}
+	}
+	invalid, err := ref.DeleteBatch(keys)
+	if err != nil {
+		if errors.Is(err, census.ErrCensusIsLocked) {
+			ErrCensusLocked.WithErr(err).Write(w)
+			return
+		}
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
+	}
+	httpWriteJSON(w, participantsResult(participants.Keys, invalid))
+}
+
+// participantsResult returns the result of a participants operation over the
+// keys provided, given the invalid leaves reported by the census.
+func participantsResult(keys []types.HexBytes, invalid []arbo.Invalid) *CensusParticipantsResult {
+	result := &CensusParticipantsResult{
+		Succeeded: len(keys) - len(invalid),
+		Failed:    []*CensusParticipantFailure{},
+	}
+	for _, inv := range invalid {
+		result.Failed = append(result.Failed, &CensusParticipantFailure{
+			Key:   keys[inv.Index],
+			Error: inv.Error.Error(),
+		})
+	}
+	return result
+}
+
 func (a *API) getCensusParticipants(w http.ResponseWriter, r *http.Request) {
 	censusID, err := uuid.Parse(chi.URLParam(r, CensusURLParam))
 	if err != nil {
@@ -87,33 +296,91 @@ func (a *API) getCensusParticipants(w http.ResponseWriter, r *http.Request) {
 
 	ref, err := a.storage.CensusDB().Load(censusID)
 	if err != nil {
+		if errors.Is(err, census.ErrCensusNotFound) {
+			ErrCensusNotFound.WithErr(err).Write(w)
+			return
+		}
 		ErrGenericInternalServerError.WithErr(err).Write(w)
 		return
 	}
 
-	// TODO: Implement pagination properly
-	keys := make([][]byte, 0)
-	values := make([][]byte, 0)
-	err = ref.Tree().Iterate(nil, func(k []byte, v []byte) {
-		keys = append(keys, k)
-		values = append(values, v)
-	})
-	if err != nil {
+	if r.URL.Query().Get(FormatParam) == FormatNDJSON ||
+		strings.Contains(r.Header.Get("Accept"), NDJSONContentType) {
+		a.streamCensusParticipants(w, ref)
+		return
+	}
+
+	pageSize := DefaultPageSize
+	if size := r.URL.Query().Get(PageSizeParam); size != "" {
+		if pageSize, err = strconv.Atoi(size); err != nil || pageSize < 1 || pageSize > MaxPageSize {
+			ErrMalformedParam.Withf("%s must be between 1 and %d", PageSizeParam, MaxPageSize).Write(w)
+			return
+		}
+	}
+	var after []byte
+	if cursor := r.URL.Query().Get(CursorParam); cursor != "" {
+		if after, err = base64.RawURLEncoding.DecodeString(cursor); err != nil || len(after) == 0 {
+			ErrMalformedParam.Withf("invalid %s", CursorParam).Write(w)
+			return
+		}
+	}
+
+	// get one more participant than the page size to know if there is a
+	// next page
+	page := &CensusParticipantsPage{Participants: []*CensusParticipant{}}
+	more := false
+	if err := ref.IterateLeaves(after, func(key, value []byte) bool {
+		if len(page.Participants) == pageSize {
+			more = true
+			return false
+		}
+		page.Participants = append(page.Participants, leafParticipant(key, value))
+		return true
+	}); err != nil {
 		ErrGenericInternalServerError.WithErr(err).Write(w)
 		return
 	}
+	if more {
+		last := page.Participants[len(page.Participants)-1]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(last.Key)
+	}
+	httpWriteJSON(w, page)
+}
 
-	participants := make([]CensusParticipant, len(keys))
-	for i := range keys {
-		participants[i] = CensusParticipant{
-			Key:    keys[i],
-			Weight: (*types.BigInt)(arbo.BytesToBigInt(values[i])),
+// streamCensusParticipants writes every participant of the census provided
+// as newline delimited JSON, flushing the response periodically so the whole
+// census is never held in memory.
+func (a *API) streamCensusParticipants(w http.ResponseWriter, ref *census.CensusRef) {
+	w.Header().Set("Content-Type", NDJSONContentType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	count := 0
+	if err := ref.IterateLeaves(nil, func(key, value []byte) bool {
+		if err := enc.Encode(leafParticipant(key, value)); err != nil {
+			log.Warnw("failed to stream census participant", "error", err)
+			return false
+		}
+		count++
+		if flusher != nil && count%streamFlushInterval == 0 {
+			flusher.Flush()
 		}
+		return true
+	}); err != nil {
+		// the status is already written, so the stream is just truncated
+		log.Warnw("failed to iterate census participants", "census", ref.ID.String(), "error", err)
+	}
+	if flusher != nil {
+		flusher.Flush()
 	}
+}
 
-	httpWriteJSON(w, map[string]interface{}{
-		"participants": participants,
-	})
+// leafParticipant returns the participant stored in the census leaf provided.
+func leafParticipant(key, value []byte) *CensusParticipant {
+	return &CensusParticipant{
+		Key:    append(types.HexBytes(nil), key...),
+		Weight: (*types.BigInt)(arbo.BytesToBigInt(value)),
+	}
 }
 
 func (a *API) getCensusRoot(w http.ResponseWriter, r *http.Request) {
@@ -145,6 +412,10 @@ func (a *API) getCensusSize(w http.ResponseWriter, r *http.Request) {
 		size = ref.Size()
 	} else if root, err := hex.DecodeString(chi.URLParam(r, CensusURLParam)); err == nil {
 		if size, err = a.storage.CensusDB().SizeByRoot(root); err != nil {
+			if errors.Is(err, census.ErrCensusRootNotFound) {
+				ErrCensusNotFound.WithErr(err).Write(w)
+				return
+			}
 			ErrGenericInternalServerError.WithErr(err).Write(w)
 			return
 		}
@@ -164,7 +435,15 @@ func (a *API) deleteCensus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if ref := a.loadAuthorizedCensus(w, r, censusID); ref == nil {
+		return
+	}
+
 	if err := a.storage.CensusDB().Del(censusID); err != nil {
+		if errors.Is(err, census.ErrCensusRootsRetained) {
+			ErrCensusRootsRetained.WithErr(err).Write(w)
+			return
+		}
 		ErrGenericInternalServerError.WithErr(err).Write(w)
 		return
 	}
@@ -187,13 +466,19 @@ func (a *API) getCensusProof(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	leafKey := key
-	if len(key) > types.CensusKeyMaxLen {
-		leafKey = a.storage.CensusDB().HashAndTrunkKey(key)
-		if leafKey == nil {
-			ErrGenericInternalServerError.WithErr(fmt.Errorf("failed to hash participant key")).Write(w)
+	hashFn, err := a.storage.CensusDB().HashFunctionByRoot(root)
+	if err != nil {
+		if errors.Is(err, census.ErrCensusRootNotFound) {
+			ErrCensusNotFound.WithErr(err).Write(w)
 			return
 		}
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
+	}
+	leafKey, err := participantLeafKey(hashFn, key)
+	if err != nil {
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
 	}
 
 	proof, err := a.storage.CensusDB().ProofByRoot(root, leafKey)
@@ -204,3 +489,87 @@ func (a *API) getCensusProof(w http.ResponseWriter, r *http.Request) {
 
 	httpWriteJSON(w, proof)
 }
+
+func (a *API) getCensusProofs(w http.ResponseWriter, r *http.Request) {
+	root, err := hex.DecodeString(chi.URLParam(r, CensusURLParam))
+	if err != nil {
+		ErrInvalidCensusID.WithErr(err).Write(w)
+		return
+	}
+
+	var req CensusParticipantKeys
+	body := http.MaxBytesReader(w, r.Body, MaxCensusProofsRequestSize)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		ErrMalformedBody.WithErr(err).Write(w)
+		return
+	}
+	if len(req.Keys) == 0 {
+		ErrMalformedBody.WithErr(fmt.Errorf("no keys provided")).Write(w)
+		return
+	}
+	if len(req.Keys) > MaxCensusProofKeys {
+		ErrMalformedBody.Withf("too many keys, the maximum is %d", MaxCensusProofKeys).Write(w)
+		return
+	}
+
+	hashFn, err := a.storage.CensusDB().HashFunctionByRoot(root)
+	if err != nil {
+		if errors.Is(err, census.ErrCensusRootNotFound) {
+			ErrCensusNotFound.WithErr(err).Write(w)
+			return
+		}
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
+	}
+	leafKeys := make([][]byte, len(req.Keys))
+	for i, key := range req.Keys {
+		if leafKeys[i], err = participantLeafKey(hashFn, key); err != nil {
+			ErrGenericInternalServerError.WithErr(err).Write(w)
+			return
+		}
+	}
+
+	proofs, err := a.storage.CensusDB().ProofsByRoot(root, leafKeys)
+	if err != nil {
+		if errors.Is(err, census.ErrCensusRootNotFound) {
+			ErrCensusNotFound.WithErr(err).Write(w)
+			return
+		}
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
+	}
+	res := &CensusProofs{Proofs: make([]*CensusKeyProof, len(req.Keys))}
+	for i, proof := range proofs {
+		res.Proofs[i] = &CensusKeyProof{
+			Key:   req.Keys[i],
+			Found: proof != nil,
+			Proof: proof,
+		}
+	}
+	httpWriteJSON(w, res)
+}
+
+func (a *API) publishCensus(w http.ResponseWriter, r *http.Request) {
+	censusID, err := uuid.Parse(chi.URLParam(r, CensusURLParam))
+	if err != nil {
+		ErrInvalidCensusID.WithErr(err).Write(w)
+		return
+	}
+
+	if ref := a.loadAuthorizedCensus(w, r, censusID); ref == nil {
+		return
+	}
+
+	ref, err := a.storage.CensusDB().Publish(censusID)
+	if err != nil {
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
+	}
+
+	httpWriteJSON(w, &PublishedCensus{
+		Census:      censusID,
+		Root:        ref.PublishedRoot,
+		Size:        ref.PublishedSize,
+		PublishedAt: ref.PublishedAt,
+	})
+}
@@ -0,0 +1,495 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+const (
+	// censusImportChunkSize is the number of rows inserted on each batch of
+	// a census import.
+	censusImportChunkSize = 1000
+	// censusImportMaxRejectedRows is the maximum number of rejected rows
+	// listed on the status of a census import.
+	censusImportMaxRejectedRows = 1000
+	// censusImportMaxLineSize is the maximum size of a row of a NDJSON census
+	// import.
+	censusImportMaxLineSize = 1 << 20
+	// censusImportRetention is the time the finished census imports are kept
+	// to be queried.
+	censusImportRetention = 24 * time.Hour
+	// censusImportMaxJobs is the maximum number of census imports kept in
+	// memory. Once reached, the oldest finished imports are removed before
+	// they expire, and no import can start if all of them are running.
+	censusImportMaxJobs = 100
+)
+
+// errTooManyCensusImports is returned when a census import cannot start
+// because censusImportMaxJobs imports are running.
+var errTooManyCensusImports = fmt.Errorf("too many census imports running")
+
+// censusImports keeps the census import jobs, which run in the background
+// and are kept in memory until they expire. The running imports are
+// cancelled by stop.
+type censusImports struct {
+	mu     sync.Mutex
+	jobs   map[uuid.UUID]*CensusImportJob
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newCensusImports creates an empty set of census import jobs.
+func newCensusImports() *censusImports {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &censusImports{
+		jobs:   make(map[uuid.UUID]*CensusImportJob),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// add registers a new running import job for the census provided and
+// removes the finished jobs that expired, or the oldest finished ones if
+// there are censusImportMaxJobs jobs. It returns errTooManyCensusImports if
+// all of them are running.
+func (ci *censusImports) add(censusID uuid.UUID) (*CensusImportJob, error) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	for id, job := range ci.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > censusImportRetention {
+			delete(ci.jobs, id)
+		}
+	}
+	for len(ci.jobs) >= censusImportMaxJobs {
+		var oldest *CensusImportJob
+		for _, job := range ci.jobs {
+			if job.FinishedAt != nil && (oldest == nil || job.FinishedAt.Before(*oldest.FinishedAt)) {
+				oldest = job
+			}
+		}
+		if oldest == nil {
+			return nil, errTooManyCensusImports
+		}
+		delete(ci.jobs, oldest.ID)
+	}
+	job := &CensusImportJob{
+		ID:           uuid.New(),
+		Census:       censusID,
+		Status:       CensusImportRunning,
+		RejectedRows: []*CensusImportRejectedRow{},
+		StartedAt:    time.Now(),
+	}
+	ci.jobs[job.ID] = job
+	return job, nil
+}
+
+// run runs the function provided in the background with a context that is
+// cancelled by stop.
+func (ci *censusImports) run(f func(ctx context.Context)) {
+	ci.wg.Add(1)
+	go func() {
+		defer ci.wg.Done()
+		f(ci.ctx)
+	}()
+}
+
+// stop cancels the running imports and waits until they finish or the
+// context provided is done.
+func (ci *censusImports) stop(ctx context.Context) error {
+	ci.cancel()
+	done := make(chan struct{})
+	go func() {
+		ci.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// get returns a copy of the import job provided of the census provided, or
+// nil if it is not found.
+func (ci *censusImports) get(censusID, jobID uuid.UUID) *CensusImportJob {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	job, ok := ci.jobs[jobID]
+	if !ok || job.Census != censusID {
+		return nil
+	}
+	status := *job
+	status.RejectedRows = append([]*CensusImportRejectedRow{}, job.RejectedRows...)
+	return &status
+}
+
+// update calls the function provided with the import job provided while
+// holding the lock, so it can be safely modified.
+func (ci *censusImports) update(job *CensusImportJob, f func(*CensusImportJob)) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	f(job)
+}
+
+// reject records the row of the import job provided as rejected.
+func (ci *censusImports) reject(job *CensusImportJob, line int, key types.HexBytes, err error) {
+	ci.update(job, func(job *CensusImportJob) {
+		job.Processed++
+		job.Rejected++
+		if len(job.RejectedRows) < censusImportMaxRejectedRows {
+			job.RejectedRows = append(job.RejectedRows, &CensusImportRejectedRow{
+				Line:  line,
+				Key:   key,
+				Error: err.Error(),
+			})
+		}
+	})
+}
+
+// finish sets the final status of the import job provided, which is failed
+// if the error provided is not nil.
+func (ci *censusImports) finish(job *CensusImportJob, err error) {
+	ci.update(job, func(job *CensusImportJob) {
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Status = CensusImportDone
+		if err != nil {
+			job.Status = CensusImportFailed
+			job.Error = err.Error()
+		}
+	})
+}
+
+// censusImportRow is a participant read from the data of a census import,
+// or the error found parsing it.
+type censusImportRow struct {
+	line        int
+	participant *CensusParticipant
+	err         error
+}
+
+// censusImportFormat returns the format of the census import request
+// provided, taken from the FormatParam query parameter or else from its
+// content type.
+func censusImportFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get(FormatParam); format != "" {
+		if format != FormatCSV && format != FormatNDJSON {
+			return "", fmt.Errorf("unsupported import format %q", format)
+		}
+		return format, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", fmt.Errorf("invalid content type: %w", err)
+	}
+	switch mediaType {
+	case CSVContentType:
+		return FormatCSV, nil
+	case NDJSONContentType:
+		return FormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported import content type %q", mediaType)
+	}
+}
+
+// readCensusImportCSV reads the CSV rows of the reader provided, with the key
+// in hexadecimal and the optional decimal weight of a participant, calling the
+// function provided with each row until it returns an error. A first row
+// with a "key" header is skipped.
+func readCensusImportCSV(r io.Reader, f func(*censusImportRow) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+	first := true
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if err := f(&censusImportRow{line: parseErr.Line, err: parseErr.Err}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "key") {
+			first = false
+			continue
+		}
+		first = false
+		row := &censusImportRow{line: line}
+		row.participant, row.err = parseCensusImportCSVRecord(record)
+		if err := f(row); err != nil {
+			return err
+		}
+	}
+}
+
+// parseCensusImportCSVRecord parses the participant of a CSV census import
+// record.
+func parseCensusImportCSVRecord(record []string) (*CensusParticipant, error) {
+	if len(record) > 2 {
+		return nil, fmt.Errorf("expected key and weight, got %d fields", len(record))
+	}
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(record[0]), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("malformed key: %w", err)
+	}
+	p := &CensusParticipant{Key: key}
+	if len(record) == 2 && strings.TrimSpace(record[1]) != "" {
+		p.Weight = new(types.BigInt)
+		if err := p.Weight.UnmarshalText([]byte(strings.TrimSpace(record[1]))); err != nil {
+			return nil, fmt.Errorf("malformed weight: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// readCensusImportNDJSON reads the NDJSON rows of the reader provided, each
+// one a CensusParticipant, calling the function provided with each row until
+// it returns an error. Empty lines are skipped.
+func readCensusImportNDJSON(r io.Reader, f func(*censusImportRow) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), censusImportMaxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+		row := &censusImportRow{line: line, participant: &CensusParticipant{}}
+		if err := json.Unmarshal(data, row.participant); err != nil {
+			row.participant, row.err = nil, fmt.Errorf("malformed participant: %w", err)
+		}
+		if err := f(row); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// validateCensusImportParticipant checks the participant of a census import
+// row before it is inserted.
+func validateCensusImportParticipant(p *CensusParticipant) error {
+	if len(p.Key) == 0 {
+		return fmt.Errorf("empty key")
+	}
+	if p.Weight != nil && p.Weight.MathBigInt().Sign() < 0 {
+		return fmt.Errorf("negative weight")
+	}
+	return nil
+}
+
+// registerImportHandlers registers the census import endpoint in the API
+// router. The import data might be large, so the endpoint is neither
+// throttled nor timed out like the other endpoints. The number of imports
+// is bounded by censusImportMaxJobs instead.
+func (a *API) registerImportHandlers() {
+	// The following endpoints are registered:
+	// - POST /census/<uuid>/import?format=<csv|ndjson>: Parameters: format (or the CSV or NDJSON Content-Type) (scope: census:write)
+	log.Infow("register handler", "endpoint", ImportCensusParticipantsEndpoint, "method", "POST", "scope", ScopeCensusWrite)
+	a.router.With(a.requireScope(ScopeCensusWrite)).Post(ImportCensusParticipantsEndpoint, a.importCensusParticipants)
+}
+
+// importCensusParticipants starts a background import of the participants
+// of the request data into the census provided.
+// POST /censuses/{censusID}/import
+func (a *API) importCensusParticipants(w http.ResponseWriter, r *http.Request) {
+	censusID, err := uuid.Parse(chi.URLParam(r, CensusURLParam))
+	if err != nil {
+		ErrMalformedBody.WithErr(err).Write(w)
+		return
+	}
+	format, err := censusImportFormat(r)
+	if err != nil {
+		ErrMalformedParam.WithErr(err).Write(w)
+		return
+	}
+	if ref := a.loadAuthorizedCensus(w, r, censusID); ref == nil {
+		return
+	}
+	// the job is registered before receiving the data, so the data is not
+	// received if the import cannot start
+	job, err := a.censusImports.add(censusID)
+	if err != nil {
+		ErrTooManyCensusImports.WithErr(err).Write(w)
+		return
+	}
+
+	// the data is spooled to a temporary file, so the request finishes as
+	// soon as it is received and the rows are imported in the background
+	file, err := os.CreateTemp("", "census-import-*")
+	if err != nil {
+		a.censusImports.finish(job, err)
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
+	}
+	if _, err := io.Copy(file, http.MaxBytesReader(w, r.Body, MaxCensusImportSize)); err != nil {
+		closeAndRemove(file)
+		a.censusImports.finish(job, err)
+		ErrMalformedBody.WithErr(err).Write(w)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		closeAndRemove(file)
+		a.censusImports.finish(job, err)
+		ErrGenericInternalServerError.WithErr(err).Write(w)
+		return
+	}
+
+	log.Infow("census import started", "census", censusID.String(), "job", job.ID.String(), "format", format)
+	a.censusImports.run(func(ctx context.Context) {
+		defer closeAndRemove(file)
+		err := a.runCensusImport(ctx, job, format, file)
+		a.censusImports.finish(job, err)
+		status := a.censusImports.get(censusID, job.ID)
+		log.Infow("census import finished",
+			"census", censusID.String(),
+			"job", job.ID.String(),
+			"status", status.Status,
+			"imported", status.Imported,
+			"rejected", status.Rejected,
+			"error", status.Error)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(a.censusImports.get(censusID, job.ID)); err != nil {
+		log.Warnw("failed to write http response", "error", err)
+	}
+}
+
+// runCensusImport reads the rows of the data provided in the format provided
+// and inserts the participants into the census of the import job provided in
+// chunks, updating the progress of the job. It stops once the context
+// provided is done, keeping the chunks already inserted.
+func (a *API) runCensusImport(ctx context.Context, job *CensusImportJob, format string, data io.Reader) error {
+	read := readCensusImportCSV
+	if format == FormatNDJSON {
+		read = readCensusImportNDJSON
+	}
+	chunk := make([]*censusImportRow, 0, censusImportChunkSize)
+	if err := read(data, func(row *censusImportRow) error {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("census import cancelled: %w", err)
+		}
+		if row.err == nil {
+			row.err = validateCensusImportParticipant(row.participant)
+		}
+		if row.err != nil {
+			var key types.HexBytes
+			if row.participant != nil {
+				key = row.participant.Key
+			}
+			a.censusImports.reject(job, row.line, key, row.err)
+			return nil
+		}
+		chunk = append(chunk, row)
+		if len(chunk) < censusImportChunkSize {
+			return nil
+		}
+		err := a.insertCensusImportChunk(job, chunk)
+		chunk = chunk[:0]
+		return err
+	}); err != nil {
+		return err
+	}
+	if len(chunk) == 0 {
+		return nil
+	}
+	return a.insertCensusImportChunk(job, chunk)
+}
+
+// insertCensusImportChunk inserts the participants of the rows provided into
+// the census of the import job provided, recording the rows that could not be
+// inserted as rejected.
+func (a *API) insertCensusImportChunk(job *CensusImportJob, rows []*censusImportRow) error {
+	// the census is loaded on every chunk so it is not considered idle
+	// during long imports
+	ref, err := a.storage.CensusDB().Load(job.Census)
+	if err != nil {
+		return err
+	}
+	participants := make([]*CensusParticipant, len(rows))
+	for i, row := range rows {
+		participants[i] = row.participant
+	}
+	keys, values, err := participantLeaves(ref, participants)
+	if err != nil {
+		return err
+	}
+	invalid, err := ref.InsertBatch(keys, values)
+	if err != nil {
+		if errors.Is(err, census.ErrCensusIsLocked) {
+			return fmt.Errorf("census locked during import: %w", err)
+		}
+		return err
+	}
+	for _, inv := range invalid {
+		row := rows[inv.Index]
+		a.censusImports.reject(job, row.line, row.participant.Key, inv.Error)
+	}
+	a.censusImports.update(job, func(job *CensusImportJob) {
+		job.Processed += len(rows) - len(invalid)
+		job.Imported += len(rows) - len(invalid)
+	})
+	return nil
+}
+
+func (a *API) getCensusImportJob(w http.ResponseWriter, r *http.Request) {
+	censusID, err := uuid.Parse(chi.URLParam(r, CensusURLParam))
+	if err != nil {
+		ErrMalformedBody.WithErr(err).Write(w)
+		return
+	}
+	jobID, err := uuid.Parse(chi.URLParam(r, CensusImportJobURLParam))
+	if err != nil {
+		ErrMalformedParam.WithErr(err).Write(w)
+		return
+	}
+	if ref := a.loadAuthorizedCensus(w, r, censusID); ref == nil {
+		return
+	}
+	job := a.censusImports.get(censusID, jobID)
+	if job == nil {
+		ErrResourceNotFound.Withf("census import %s", jobID).Write(w)
+		return
+	}
+	httpWriteJSON(w, job)
+}
+
+// closeAndRemove closes and removes the temporary file provided.
+func closeAndRemove(file *os.File) {
+	if err := file.Close(); err != nil {
+		log.Warnw("failed to close temporary file", "file", file.Name(), "error", err)
+	}
+	if err := os.Remove(file.Name()); err != nil {
+		log.Warnw("failed to remove temporary file", "file", file.Name(), "error", err)
+	}
+}
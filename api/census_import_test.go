@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/google/uuid"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage"
+	"go.vocdoni.io/dvote/db/metadb"
+)
+
+func newTestAPI(t *testing.T) *API {
+	a := &API{
+		storage:       storage.New(metadb.NewTest(t)),
+		shutdown:      make(chan struct{}),
+		censusImports: newCensusImports(),
+
+		insecureNoAuth: true,
+	}
+	a.initRouter()
+	return a
+}
+
+func readCensusImportRows(c *qt.C, format, data string) []*censusImportRow {
+	read := readCensusImportCSV
+	if format == FormatNDJSON {
+		read = readCensusImportNDJSON
+	}
+	rows := []*censusImportRow{}
+	c.Assert(read(strings.NewReader(data), func(row *censusImportRow) error {
+		rows = append(rows, row)
+		return nil
+	}), qt.IsNil)
+	return rows
+}
+
+func TestReadCensusImportCSV(t *testing.T) {
+	c := qt.New(t)
+	rows := readCensusImportRows(c, FormatCSV, "key,weight\n"+
+		"0x0102,5\n"+
+		"0304\n"+
+		"zz,1\n"+
+		"0506,abc\n"+
+		"0708,1,2\n"+
+		"\"09,1\n")
+	c.Assert(rows, qt.HasLen, 6)
+	c.Assert(rows[0].err, qt.IsNil)
+	c.Assert(rows[0].line, qt.Equals, 2)
+	c.Assert([]byte(rows[0].participant.Key), qt.DeepEquals, []byte{1, 2})
+	c.Assert(rows[0].participant.Weight.MathBigInt().Int64(), qt.Equals, int64(5))
+	// the weight is optional
+	c.Assert(rows[1].err, qt.IsNil)
+	c.Assert(rows[1].participant.Weight, qt.IsNil)
+	// malformed rows are reported with their line
+	for i, line := range []int{4, 5, 6, 7} {
+		c.Assert(rows[i+2].err, qt.IsNotNil, qt.Commentf("row %d", i+2))
+		c.Assert(rows[i+2].line, qt.Equals, line)
+	}
+}
+
+func TestReadCensusImportNDJSON(t *testing.T) {
+	c := qt.New(t)
+	rows := readCensusImportRows(c, FormatNDJSON, `{"key":"0x0102","weight":"5"}`+"\n"+
+		"\n"+
+		`{"key":"0x0304"}`+"\n"+
+		`{"key":`+"\n")
+	c.Assert(rows, qt.HasLen, 3)
+	c.Assert(rows[0].err, qt.IsNil)
+	c.Assert([]byte(rows[0].participant.Key), qt.DeepEquals, []byte{1, 2})
+	c.Assert(rows[0].participant.Weight.MathBigInt().Int64(), qt.Equals, int64(5))
+	// empty lines are skipped but counted
+	c.Assert(rows[1].err, qt.IsNil)
+	c.Assert(rows[1].line, qt.Equals, 3)
+	c.Assert(rows[2].err, qt.IsNotNil)
+	c.Assert(rows[2].line, qt.Equals, 4)
+}
+
+func TestCensusImport(t *testing.T) {
+	c := qt.New(t)
+	a := newTestAPI(t)
+	ref, token, err := a.storage.CensusDB().NewWithAuthToken(uuid.New(), "")
+	c.Assert(err, qt.IsNil)
+
+	// more rows than a chunk, with some rejected rows in between
+	var data bytes.Buffer
+	total := 2*censusImportChunkSize + 10
+	for i := 0; i < total; i++ {
+		fmt.Fprintf(&data, "%08x,1\n", i)
+	}
+	data.WriteString("zz,1\n")
+	data.WriteString("0a0b,-1\n")
+	data.WriteString("00000000,1\n")
+
+	importEndpoint := EndpointWithParam(ImportCensusParticipantsEndpoint, CensusURLParam, ref.ID.String())
+	req := httptest.NewRequest(http.MethodPost, importEndpoint, &data)
+	req.Header.Set("Content-Type", CSVContentType)
+	req.Header.Set(CensusAuthTokenHeader, token)
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	c.Assert(w.Code, qt.Equals, http.StatusAccepted, qt.Commentf("%s", w.Body.String()))
+	job := &CensusImportJob{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), job), qt.IsNil)
+
+	// the job status requires the census token
+	jobEndpoint := EndpointWithParam(EndpointWithParam(CensusImportJobEndpoint,
+		CensusURLParam, ref.ID.String()), CensusImportJobURLParam, job.ID.String())
+	getJob := func(token string) (int, *CensusImportJob) {
+		req := httptest.NewRequest(http.MethodGet, jobEndpoint, nil)
+		req.Header.Set(CensusAuthTokenHeader, token)
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, req)
+		status := &CensusImportJob{}
+		if w.Code == http.StatusOK {
+			c.Assert(json.Unmarshal(w.Body.Bytes(), status), qt.IsNil)
+		}
+		return w.Code, status
+	}
+	code, _ := getJob("wrong")
+	c.Assert(code, qt.Equals, http.StatusUnauthorized)
+	for job.Status == CensusImportRunning {
+		time.Sleep(10 * time.Millisecond)
+		code, job = getJob(token)
+		c.Assert(code, qt.Equals, http.StatusOK)
+	}
+	c.Assert(job.Status, qt.Equals, CensusImportDone, qt.Commentf("%s", job.Error))
+	c.Assert(job.Processed, qt.Equals, total+3)
+	c.Assert(job.Imported, qt.Equals, total)
+	c.Assert(job.Rejected, qt.Equals, 3)
+	c.Assert(job.RejectedRows, qt.HasLen, 3)
+	lines := []int{}
+	for _, row := range job.RejectedRows {
+		lines = append(lines, row.Line)
+	}
+	c.Assert(lines, qt.ContentEquals, []int{total + 1, total + 2, total + 3})
+	c.Assert(job.FinishedAt, qt.IsNotNil)
+
+	// every chunk was inserted
+	c.Assert(ref.Size(), qt.Equals, total)
+}
+
+func TestCensusImportsBounded(t *testing.T) {
+	c := qt.New(t)
+	imports := newCensusImports()
+	censusID := uuid.New()
+	jobs := []*CensusImportJob{}
+	for i := 0; i < censusImportMaxJobs; i++ {
+		job, err := imports.add(censusID)
+		c.Assert(err, qt.IsNil)
+		jobs = append(jobs, job)
+	}
+	// all the jobs are running
+	_, err := imports.add(censusID)
+	c.Assert(err, qt.ErrorIs, errTooManyCensusImports)
+
+	// the oldest finished job is removed to make room
+	imports.finish(jobs[3], nil)
+	time.Sleep(time.Millisecond)
+	imports.finish(jobs[1], nil)
+	job, err := imports.add(censusID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(imports.get(censusID, job.ID), qt.IsNotNil)
+	c.Assert(imports.get(censusID, jobs[3].ID), qt.IsNil)
+	c.Assert(imports.get(censusID, jobs[1].ID), qt.IsNotNil)
+}
+
+func TestCensusImportsStop(t *testing.T) {
+	c := qt.New(t)
+	imports := newCensusImports()
+	started := make(chan struct{})
+	imports.run(func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	})
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.Assert(imports.stop(ctx), qt.IsNil)
+}
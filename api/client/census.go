@@ -0,0 +1,177 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/vocdoni/vocdoni-z-sandbox/api"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+// IterateCensusParticipants requests every page of the participants of the
+// census provided, calling the function provided with each participant until
+// it returns false. If pageSize is zero, the default page size of the API is
+// used.
+func (c *HTTPclient) IterateCensusParticipants(censusID uuid.UUID, pageSize int, f func(*api.CensusParticipant) bool) error {
+	endpoint := api.EndpointWithParam(api.GetCensusParticipantsEndpoint, api.CensusURLParam, censusID.String())
+	cursor := ""
+	for {
+		params := []string{}
+		if pageSize > 0 {
+			params = append(params, api.PageSizeParam, strconv.Itoa(pageSize))
+		}
+		if cursor != "" {
+			params = append(params, api.CursorParam, cursor)
+		}
+		data, status, err := c.Request(HTTPGET, nil, params, endpoint)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("%s: %d (%s)", errCodeNot200, status, data)
+		}
+		page := &api.CensusParticipantsPage{}
+		if err := json.Unmarshal(data, page); err != nil {
+			return fmt.Errorf("failed to decode participants page: %w", err)
+		}
+		for _, p := range page.Participants {
+			if !f(p) {
+				return nil
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CensusParticipants returns every participant of the census provided,
+// requesting the pages of the size provided.
+func (c *HTTPclient) CensusParticipants(censusID uuid.UUID, pageSize int) ([]*api.CensusParticipant, error) {
+	participants := []*api.CensusParticipant{}
+	if err := c.IterateCensusParticipants(censusID, pageSize, func(p *api.CensusParticipant) bool {
+		participants = append(participants, p)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	return participants, nil
+}
+
+// CensusProofs returns the census proofs of the keys provided in the census
+// of the root provided, in the same order as the keys. The keys are requested
+// in batches of the maximum size allowed by the API.
+func (c *HTTPclient) CensusProofs(root types.HexBytes, keys []types.HexBytes) ([]*api.CensusKeyProof, error) {
+	endpoint := api.EndpointWithParam(api.GetCensusProofsEndpoint, api.CensusURLParam, root.String())
+	proofs := make([]*api.CensusKeyProof, 0, len(keys))
+	for start := 0; start < len(keys); start += api.MaxCensusProofKeys {
+		end := min(start+api.MaxCensusProofKeys, len(keys))
+		data, status, err := c.Request(HTTPPOST, &api.CensusParticipantKeys{Keys: keys[start:end]}, nil, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("%s: %d (%s)", errCodeNot200, status, data)
+		}
+		res := &api.CensusProofs{}
+		if err := json.Unmarshal(data, res); err != nil {
+			return nil, fmt.Errorf("failed to decode census proofs: %w", err)
+		}
+		if len(res.Proofs) != end-start {
+			return nil, fmt.Errorf("unexpected number of census proofs: %d", len(res.Proofs))
+		}
+		proofs = append(proofs, res.Proofs...)
+	}
+	return proofs, nil
+}
+
+// ImportCensusParticipants starts a bulk import into the census provided of
+// the participants of the data provided, in the format provided (api.FormatCSV
+// or api.FormatNDJSON), authorized with the management token of the census.
+// The data is sent in a single request, so the timeout of the client must be
+// large enough to upload it. It returns the import job, whose progress can be
+// queried with CensusImportJob.
+func (c *HTTPclient) ImportCensusParticipants(censusID uuid.UUID, authToken, format string, data io.Reader) (*api.CensusImportJob, error) {
+	contentType := api.CSVContentType
+	if format == api.FormatNDJSON {
+		contentType = api.NDJSONContentType
+	}
+	u, err := url.Parse(c.host.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host URL: %w", err)
+	}
+	u.Path = path.Join(u.Path, api.EndpointWithParam(api.ImportCensusParticipantsEndpoint, api.CensusURLParam, censusID.String()))
+	req, err := http.NewRequest(HTTPPOST, u.String(), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(api.CensusAuthTokenHeader, authToken)
+	if c.authToken != "" {
+		req.Header.Set(api.AuthorizationHeader, api.BearerScheme+" "+c.authToken)
+	}
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("%s: %d (%s)", errCodeNot200, resp.StatusCode, body)
+	}
+	job := &api.CensusImportJob{}
+	if err := json.Unmarshal(body, job); err != nil {
+		return nil, fmt.Errorf("failed to decode census import job: %w", err)
+	}
+	return job, nil
+}
+
+// CensusImportJob returns the status of the import job provided of the census
+// provided, authorized with the management token of the census.
+func (c *HTTPclient) CensusImportJob(censusID uuid.UUID, authToken string, jobID uuid.UUID) (*api.CensusImportJob, error) {
+	endpoint := api.EndpointWithParam(api.CensusImportJobEndpoint, api.CensusURLParam, censusID.String())
+	endpoint = api.EndpointWithParam(endpoint, api.CensusImportJobURLParam, jobID.String())
+	headers := http.Header{}
+	headers.Set(api.CensusAuthTokenHeader, authToken)
+	data, status, err := c.RequestWithHeaders(HTTPGET, nil, headers, nil, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%s: %d (%s)", errCodeNot200, status, data)
+	}
+	job := &api.CensusImportJob{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, fmt.Errorf("failed to decode census import job: %w", err)
+	}
+	return job, nil
+}
+
+// DeriveCensus creates a new census from the set operation and weight rule
+// provided applied to the source censuses provided. It returns the new census
+// with its management token.
+func (c *HTTPclient) DeriveCensus(operation, weightRule string, sources ...uuid.UUID) (*api.DerivedCensus, error) {
+	req := &api.DeriveCensusRequest{Operation: operation, WeightRule: weightRule, Sources: sources}
+	data, status, err := c.Request(HTTPPOST, req, nil, api.DeriveCensusEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%s: %d (%s)", errCodeNot200, status, data)
+	}
+	derived := &api.DerivedCensus{}
+	if err := json.Unmarshal(data, derived); err != nil {
+		return nil, fmt.Errorf("failed to decode derived census: %w", err)
+	}
+	return derived, nil
+}
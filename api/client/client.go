@@ -22,6 +22,8 @@ const (
 	HTTPPOST = http.MethodPost
 	// HTTPDELETE is the method string used for calling
 	HTTPDELETE = http.MethodDelete
+	// HTTPPUT is the method string used for calling Request()
+	HTTPPUT = http.MethodPut
 
 	errCodeNot200 = "API error"
 
@@ -33,9 +35,10 @@ const (
 
 // HTTPclient is the Vocdoni API HTTP client.
 type HTTPclient struct {
-	c       *http.Client
-	host    *url.URL
-	retries int
+	c         *http.Client
+	host      *url.URL
+	retries   int
+	authToken string
 }
 
 // New connects to the API host with a random bearer token and returns the handle
@@ -85,6 +88,13 @@ func (c *HTTPclient) SetRetries(n int) {
 	c.retries = n
 }
 
+// SetAuthToken configures the API key or JSON Web Token sent in the
+// api.AuthorizationHeader of every request, required by the administrative
+// endpoints if the API server authenticates them.
+func (c *HTTPclient) SetAuthToken(token string) {
+	c.authToken = token
+}
+
 // SetTimeout configures the timeout for the HTTP client.
 func (c *HTTPclient) SetTimeout(d time.Duration) {
 	c.c.Timeout = d
@@ -102,6 +112,13 @@ func (c *HTTPclient) SetTimeout(d time.Duration) {
 // Supports query parameters via `params` slice. If the slice is not empty, it should contain pairs of strings;
 // the first element of each pair is the key, and the second element is the value.
 func (c *HTTPclient) Request(method string, jsonBody any, params []string, urlPath ...string) ([]byte, int, error) {
+	return c.RequestWithHeaders(method, jsonBody, nil, params, urlPath...)
+}
+
+// RequestWithHeaders performs a request like Request, adding the extra HTTP
+// headers provided, such as the api.CensusAuthTokenHeader required by the
+// census write operations.
+func (c *HTTPclient) RequestWithHeaders(method string, jsonBody any, extraHeaders http.Header, params []string, urlPath ...string) ([]byte, int, error) {
 	var (
 		body []byte
 		err  error
@@ -143,6 +160,14 @@ func (c *HTTPclient) Request(method string, jsonBody any, params []string, urlPa
 		headers.Set("Content-Type", "application/json")
 		headers.Set("Accept", "application/json")
 	}
+	for key, values := range extraHeaders {
+		for _, value := range values {
+			headers.Add(key, value)
+		}
+	}
+	if c.authToken != "" {
+		headers.Set(api.AuthorizationHeader, api.BearerScheme+" "+c.authToken)
+	}
 
 	// Log the request details, truncating body if large
 	log.Debugw("client request",
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/vocdoni/vocdoni-z-sandbox/api"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+// NewProcess sets up a new voting process with the signed setup provided and
+// returns the setup response, which includes the process ID and the
+// encryption key of the process. The signature must be made over
+// types.ProcessSetup.SignatureMessage.
+func (c *HTTPclient) NewProcess(setup *types.ProcessSetup) (*types.ProcessSetupResponse, error) {
+	data, status, err := c.Request(HTTPPOST, setup, nil, api.ProcessesEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%s: %d (%s)", errCodeNot200, status, data)
+	}
+	resp := &types.ProcessSetupResponse{}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return nil, fmt.Errorf("failed to decode process setup response: %w", err)
+	}
+	return resp, nil
+}
+
+// ListProcesses returns the summaries of every process that passes the
+// filters provided, requesting the pages of the size provided. The filters
+// are pairs of query parameters and values, such as api.OrganizationIDParam
+// and the address of the organization. If pageSize is zero, the default page
+// size of the API is used.
+func (c *HTTPclient) ListProcesses(pageSize int, filters ...string) ([]*storage.ProcessSummary, error) {
+	processes := []*storage.ProcessSummary{}
+	cursor := ""
+	for {
+		params := append([]string{}, filters...)
+		if pageSize > 0 {
+			params = append(params, api.PageSizeParam, strconv.Itoa(pageSize))
+		}
+		if cursor != "" {
+			params = append(params, api.CursorParam, cursor)
+		}
+		data, status, err := c.Request(HTTPGET, nil, params, api.ProcessesEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("%s: %d (%s)", errCodeNot200, status, data)
+		}
+		page := &api.ProcessesPage{}
+		if err := json.Unmarshal(data, page); err != nil {
+			return nil, fmt.Errorf("failed to decode processes page: %w", err)
+		}
+		processes = append(processes, page.Processes...)
+		if page.NextCursor == "" {
+			return processes, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// ProcessResults returns the results of the process provided, mapped onto the
+// questions and choices of its metadata if available.
+func (c *HTTPclient) ProcessResults(processID types.HexBytes) (*api.ProcessResults, error) {
+	endpoint := api.EndpointWithParam(api.ProcessResultsEndpoint, api.ProcessURLParam, processID.String())
+	data, status, err := c.Request(HTTPGET, nil, nil, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%s: %d (%s)", errCodeNot200, status, data)
+	}
+	results := &api.ProcessResults{}
+	if err := json.Unmarshal(data, results); err != nil {
+		return nil, fmt.Errorf("failed to decode process results: %w", err)
+	}
+	return results, nil
+}
@@ -25,15 +25,28 @@ import (
 // Do note that HTTPstatus 204 No Content implies the response body will be empty,
 // so the Code and Message will actually be discarded, never sent to the client
 var (
-	ErrResourceNotFound   = Error{Code: 40001, HTTPstatus: http.StatusNotFound, Err: fmt.Errorf("resource not found")}
-	ErrMalformedBody      = Error{Code: 40004, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("malformed JSON body")}
-	ErrInvalidSignature   = Error{Code: 40005, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("invalid signature")}
-	ErrMalformedProcessID = Error{Code: 40006, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("malformed process ID")}
-	ErrProcessNotFound    = Error{Code: 40007, HTTPstatus: http.StatusNotFound, Err: fmt.Errorf("process not found")}
-	ErrInvalidCensusProof = Error{Code: 40008, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("invalid census proof")}
-	ErrInvalidBallotProof = Error{Code: 40009, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("invalid census proof")}
-	ErrInvalidCensusID    = Error{Code: 40010, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("invalid census ID")}
-	ErrCensusNotFound     = Error{Code: 40011, HTTPstatus: http.StatusNotFound, Err: fmt.Errorf("census not found")}
+	ErrResourceNotFound     = Error{Code: 40001, HTTPstatus: http.StatusNotFound, Err: fmt.Errorf("resource not found")}
+	ErrMalformedBody        = Error{Code: 40004, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("malformed JSON body")}
+	ErrInvalidSignature     = Error{Code: 40005, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("invalid signature")}
+	ErrMalformedProcessID   = Error{Code: 40006, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("malformed process ID")}
+	ErrProcessNotFound      = Error{Code: 40007, HTTPstatus: http.StatusNotFound, Err: fmt.Errorf("process not found")}
+	ErrInvalidCensusProof   = Error{Code: 40008, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("invalid census proof")}
+	ErrInvalidBallotProof   = Error{Code: 40009, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("invalid census proof")}
+	ErrInvalidCensusID      = Error{Code: 40010, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("invalid census ID")}
+	ErrCensusNotFound       = Error{Code: 40011, HTTPstatus: http.StatusNotFound, Err: fmt.Errorf("census not found")}
+	ErrNotOrganizationAdmin = Error{Code: 40012, HTTPstatus: http.StatusForbidden, Err: fmt.Errorf("not an organization administrator")}
+	ErrUnsupportedChain     = Error{Code: 40013, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("unsupported chain")}
+	ErrCensusRootsRetained  = Error{Code: 40014, HTTPstatus: http.StatusConflict, Err: fmt.Errorf("census roots retained")}
+	ErrCensusNotPublished   = Error{Code: 40015, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("census not published")}
+	ErrCensusLocked         = Error{Code: 40016, HTTPstatus: http.StatusConflict, Err: fmt.Errorf("census is locked")}
+	ErrWrongCensusAuthToken = Error{Code: 40017, HTTPstatus: http.StatusUnauthorized, Err: fmt.Errorf("wrong census authentication token")}
+	ErrMalformedParam       = Error{Code: 40018, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("malformed parameter")}
+	ErrUnsupportedHashType  = Error{Code: 40019, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("unsupported census hash type")}
+	ErrInvalidDerivation    = Error{Code: 40020, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("invalid census derivation")}
+	ErrResultsNotAvailable  = Error{Code: 40021, HTTPstatus: http.StatusNotFound, Err: fmt.Errorf("process results not available")}
+	ErrUnauthorized         = Error{Code: 40022, HTTPstatus: http.StatusUnauthorized, Err: fmt.Errorf("unauthorized")}
+	ErrUnsupportedCensus    = Error{Code: 40023, HTTPstatus: http.StatusBadRequest, Err: fmt.Errorf("unsupported census origin")}
+	ErrTooManyCensusImports = Error{Code: 40024, HTTPstatus: http.StatusTooManyRequests, Err: fmt.Errorf("too many census imports")}
 
 	ErrMarshalingServerJSONFailed = Error{Code: 50001, HTTPstatus: http.StatusInternalServerError, Err: fmt.Errorf("marshaling (server-side) JSON failed")}
 	ErrGenericInternalServerError = Error{Code: 50002, HTTPstatus: http.StatusInternalServerError, Err: fmt.Errorf("internal server error")}
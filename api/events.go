@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vocdoni/vocdoni-z-sandbox/events"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+)
+
+// wsUpgrader upgrades the event stream requests to WebSocket connections. The
+// API allows any origin, as the CORS configuration does.
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// wsWriteTimeout is the maximum time to write a WebSocket message.
+const wsWriteTimeout = 10 * time.Second
+
+// registerStreamHandlers registers the HTTP handlers of the event streams.
+func (a *API) registerStreamHandlers() {
+	// The following endpoints are registered:
+	// - GET /process/<processId>/events?lastEventId=<id>: Parameters: lastEventId (or the Last-Event-ID header)
+	// - GET /process/<processId>/events/ws?lastEventId=<id>: Parameters: lastEventId
+	log.Infow("register handler", "endpoint", ProcessEventsEndpoint, "method", "GET")
+	a.router.Get(ProcessEventsEndpoint, a.processEvents)
+	log.Infow("register handler", "endpoint", ProcessEventsWSEndpoint, "method", "GET")
+	a.router.Get(ProcessEventsWSEndpoint, a.processEventsWS)
+}
+
+// processEvents streams the events of a process as Server-Sent Events. If
+// the stream is resumed, the events published since the last event ID
+// provided are sent first.
+// GET /process/{processId}/events
+func (a *API) processEvents(w http.ResponseWriter, r *http.Request) {
+	pid, ok := processIDParam(w, r)
+	if !ok {
+		return
+	}
+	lastEventID, ok := lastEventIDParam(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		ErrGenericInternalServerError.Withf("streaming not supported").Write(w)
+		return
+	}
+	missed, sub := a.storage.Events().Subscribe(pid.Marshal(), lastEventID)
+	defer a.storage.Events().Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range missed {
+		if err := writeSSE(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(EventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-a.shutdown:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				// the subscriber fell behind, the client resumes the stream
+				// from the last event received
+				return
+			}
+			if err := writeSSE(w, e); err != nil {
+				log.Debugw("event stream closed", "processId", pid.String(), "error", err.Error())
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// processEventsWS streams the events of a process as WebSocket JSON
+// messages. If the stream is resumed, the events published since the last
+// event ID provided are sent first.
+// GET /process/{processId}/events/ws
+func (a *API) processEventsWS(w http.ResponseWriter, r *http.Request) {
+	pid, ok := processIDParam(w, r)
+	if !ok {
+		return
+	}
+	lastEventID, ok := lastEventIDParam(w, r)
+	if !ok {
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied with the error
+		log.Debugw("could not upgrade event stream", "error", err.Error())
+		return
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Debugw("could not close event stream", "error", err.Error())
+		}
+	}()
+	missed, sub := a.storage.Events().Subscribe(pid.Marshal(), lastEventID)
+	defer a.storage.Events().Unsubscribe(sub)
+
+	// the client messages are discarded, reading them is needed to handle
+	// the control messages and detect that the connection is closed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(e *events.Event) error {
+		if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+			return err
+		}
+		return conn.WriteJSON(e)
+	}
+	for _, e := range missed {
+		if err := write(e); err != nil {
+			return
+		}
+	}
+	keepAlive := time.NewTicker(EventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-a.shutdown:
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(wsWriteTimeout))
+			return
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				// the subscriber fell behind, the client resumes the stream
+				// from the last event received
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber too slow"),
+					time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if err := write(e); err != nil {
+				log.Debugw("event stream closed", "processId", pid.String(), "error", err.Error())
+				return
+			}
+		}
+	}
+}
+
+// lastEventIDParam returns the ID of the last event received by the client,
+// provided in the LastEventIDParam query parameter or the LastEventIDHeader
+// header, or zero if none is provided. If it is not valid, it writes the
+// error response and returns false.
+func lastEventIDParam(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	value := r.URL.Query().Get(LastEventIDParam)
+	if value == "" {
+		value = r.Header.Get(LastEventIDHeader)
+	}
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		ErrMalformedParam.Withf("invalid %s: %v", LastEventIDParam, err).Write(w)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeSSE writes the event provided as a Server-Sent Event, with the event
+// ID, type and JSON encoded event as data.
+func writeSSE(w http.ResponseWriter, e *events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	qt "github.com/frankban/quicktest"
+	"github.com/gorilla/websocket"
+	"github.com/vocdoni/vocdoni-z-sandbox/events"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+// readSSE reads the next Server-Sent Event of the stream provided and
+// returns its ID line and the event decoded from its data.
+func readSSE(c *qt.C, r *bufio.Reader) (string, *events.Event) {
+	var id string
+	e := &events.Event{}
+	for {
+		line, err := r.ReadString('\n')
+		c.Assert(err, qt.IsNil)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return id, e
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			c.Assert(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), e), qt.IsNil)
+		}
+	}
+}
+
+func TestProcessEventsResume(t *testing.T) {
+	c := qt.New(t)
+	a := newTestAPI(t)
+	srv := httptest.NewServer(a.router)
+	defer srv.Close()
+
+	pid := &types.ProcessID{Address: common.HexToAddress("0x01"), Nonce: 1, ChainID: 1}
+	bus := a.storage.Events()
+	e1 := bus.Publish(pid.Marshal(), events.StateRoot, &events.StateRootData{StateRoot: []byte{1}})
+	// the events of other processes are not streamed
+	other := &types.ProcessID{Address: common.HexToAddress("0x02"), Nonce: 1, ChainID: 1}
+	bus.Publish(other.Marshal(), events.StateRoot, nil)
+	e3 := bus.Publish(pid.Marshal(), events.BatchSettled, &events.BatchData{Ballots: 2})
+	e4 := bus.Publish(pid.Marshal(), events.ProcessEnded, &events.ProcessStatusData{Status: types.ProcessStatusEnded})
+
+	eventsEndpoint := srv.URL + EndpointWithParam(ProcessEventsEndpoint, ProcessURLParam, pid.String())
+
+	// the Server-Sent Events stream is resumed from the Last-Event-ID header
+	c.Run("sse", func(c *qt.C) {
+		req, err := http.NewRequest(http.MethodGet, eventsEndpoint, nil)
+		c.Assert(err, qt.IsNil)
+		req.Header.Set(LastEventIDHeader, fmt.Sprint(e1.ID))
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, qt.IsNil)
+		defer resp.Body.Close()
+		c.Assert(resp.StatusCode, qt.Equals, http.StatusOK)
+		c.Assert(resp.Header.Get("Content-Type"), qt.Equals, "text/event-stream")
+		stream := bufio.NewReader(resp.Body)
+		for _, want := range []*events.Event{e3, e4} {
+			id, e := readSSE(c, stream)
+			c.Assert(id, qt.Equals, fmt.Sprint(want.ID))
+			c.Assert(e.Type, qt.Equals, want.Type)
+			c.Assert(e.ProcessID, qt.DeepEquals, want.ProcessID)
+		}
+		// then the new events are streamed
+		e5 := bus.Publish(pid.Marshal(), events.ResultsReady, nil)
+		id, e := readSSE(c, stream)
+		c.Assert(id, qt.Equals, fmt.Sprint(e5.ID))
+		c.Assert(e.Type, qt.Equals, events.ResultsReady)
+	})
+
+	// the WebSocket stream is resumed from the lastEventId query parameter
+	c.Run("ws", func(c *qt.C) {
+		wsEndpoint := "ws" + strings.TrimPrefix(eventsEndpoint, "http") + "/ws?" + LastEventIDParam + "=" + fmt.Sprint(e3.ID)
+		conn, resp, err := websocket.DefaultDialer.Dial(wsEndpoint, nil)
+		c.Assert(err, qt.IsNil)
+		defer resp.Body.Close()
+		defer conn.Close()
+		e := &events.Event{}
+		c.Assert(conn.ReadJSON(e), qt.IsNil)
+		c.Assert(e.ID, qt.Equals, e4.ID)
+		c.Assert(e.Type, qt.Equals, events.ProcessEnded)
+		// the event published during the SSE stream is also replayed
+		c.Assert(conn.ReadJSON(e), qt.IsNil)
+		c.Assert(e.Type, qt.Equals, events.ResultsReady)
+		e6 := bus.Publish(pid.Marshal(), events.StateRoot, &events.StateRootData{StateRoot: []byte{2}})
+		c.Assert(conn.ReadJSON(e), qt.IsNil)
+		c.Assert(e.ID, qt.Equals, e6.ID)
+	})
+
+	// an invalid last event ID is rejected
+	req, err := http.NewRequest(http.MethodGet, eventsEndpoint+"?"+LastEventIDParam+"=x", nil)
+	c.Assert(err, qt.IsNil)
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, qt.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, qt.Equals, http.StatusBadRequest)
+}
@@ -1,11 +1,15 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/go-chi/chi/v5"
 	"github.com/vocdoni/arbo/memdb"
 	"github.com/vocdoni/vocdoni-z-sandbox/circuits"
@@ -15,6 +19,8 @@ import (
 	"github.com/vocdoni/vocdoni-z-sandbox/crypto/ethereum"
 	"github.com/vocdoni/vocdoni-z-sandbox/log"
 	"github.com/vocdoni/vocdoni-z-sandbox/state"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 )
 
@@ -27,16 +33,61 @@ func (a *API) newProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if p.OrganizationID == (common.Address{}) {
+		ErrMalformedBody.Withf("missing organizationId").Write(w)
+		return
+	}
+	orgID := p.OrganizationID
+
 	// Extract the address from the signature
-	address, err := ethereum.AddrFromSignature([]byte(fmt.Sprintf("%d%d", p.ChainID, p.Nonce)), p.Signature)
+	address, err := ethereum.AddrFromSignature(p.SignatureMessage(), p.Signature)
 	if err != nil {
 		ErrInvalidSignature.Withf("could not extract address from signature: %v", err).Write(w)
 		return
 	}
 
+	// Check that the signer is an administrator of the organization on the
+	// chain of the process
+	if len(a.orgAdmins) > 0 {
+		orgAdmins, ok := a.orgAdmins[p.ChainID]
+		if !ok {
+			ErrUnsupportedChain.Withf("chain %d", p.ChainID).Write(w)
+			return
+		}
+		isAdmin, err := orgAdmins.IsOrganizationAdministrator(orgID, address)
+		if err != nil {
+			ErrGenericInternalServerError.Withf("could not check organization administrator: %v", err).Write(w)
+			return
+		}
+		if !isAdmin {
+			ErrNotOrganizationAdmin.Withf("%s is not an administrator of %s", address.Hex(), orgID.Hex()).Write(w)
+			return
+		}
+	} else if orgID != address {
+		ErrNotOrganizationAdmin.Withf("organization administrators cannot be checked").Write(w)
+		return
+	}
+
+	// Check that the census is published, so it cannot be modified
+	censusRef, err := a.storage.CensusDB().PublishedCensus(p.CensusRoot)
+	if err != nil {
+		if errors.Is(err, census.ErrCensusNotPublished) {
+			ErrCensusNotPublished.Withf("census root %x", p.CensusRoot).Write(w)
+			return
+		}
+		ErrGenericInternalServerError.Withf("could not check census: %v", err).Write(w)
+		return
+	}
+	// Check that the census proofs can be verified by the circuits
+	if !census.ProvableHashType(censusRef.HashType) {
+		ErrUnsupportedHashType.Withf("census hash type %s, processes require %s",
+			censusRef.HashType, census.DefaultHashType).Write(w)
+		return
+	}
+
 	// Create the process ID
 	pid := types.ProcessID{
-		Address: address,
+		Address: orgID,
 		Nonce:   p.Nonce,
 		ChainID: p.ChainID,
 	}
@@ -95,20 +146,13 @@ func (a *API) newProcess(w http.ResponseWriter, r *http.Request) {
 // getProcess retrieves a voting process
 // GET /process/{processId}
 func (a *API) process(w http.ResponseWriter, r *http.Request) {
-	// Unmarshal the process ID
-	pidBytes, err := hex.DecodeString(chi.URLParam(r, ProcessURLParam))
-	if err != nil {
-		ErrMalformedProcessID.Withf("could not decode process ID: %v", err).Write(w)
-		return
-	}
-	pid := types.ProcessID{}
-	if err := pid.Unmarshal(pidBytes); err != nil {
-		ErrMalformedProcessID.Withf("could not unmarshal process ID: %v", err).Write(w)
+	pid, ok := processIDParam(w, r)
+	if !ok {
 		return
 	}
 
 	// Retrieve the process
-	proc, err := a.storage.Process(&pid)
+	proc, err := a.storage.Process(pid)
 	if err != nil {
 		ErrProcessNotFound.Withf("could not retrieve process: %v", err).Write(w)
 		return
@@ -117,3 +161,139 @@ func (a *API) process(w http.ResponseWriter, r *http.Request) {
 	// Write the response
 	httpWriteJSON(w, proc)
 }
+
+// processResults retrieves the results of a voting process, mapped onto the
+// questions and choices of its metadata if available
+// GET /process/{processId}/results
+func (a *API) processResults(w http.ResponseWriter, r *http.Request) {
+	pid, ok := processIDParam(w, r)
+	if !ok {
+		return
+	}
+	proc, err := a.storage.Process(pid)
+	if err != nil {
+		ErrProcessNotFound.Withf("could not retrieve process: %v", err).Write(w)
+		return
+	}
+	if len(proc.Result) == 0 {
+		ErrResultsNotAvailable.Withf("process %x", pid.Marshal()).Write(w)
+		return
+	}
+
+	res := &ProcessResults{
+		ProcessID: pid.Marshal(),
+		Results:   proc.Result,
+	}
+	if proc.Metadata != nil {
+		fields := proc.Metadata.ChoiceFields()
+		for q, question := range proc.Metadata.Questions {
+			qr := &QuestionResults{Title: question.Title, Choices: []*ChoiceResults{}}
+			for c, choice := range question.Choices {
+				// the choices without a ballot field have no votes
+				total := new(types.BigInt).SetUint64(0)
+				if field := fields[q][c]; field < len(proc.Result) && proc.Result[field] != nil {
+					total = proc.Result[field]
+				}
+				qr.Choices = append(qr.Choices, &ChoiceResults{
+					Title: choice.Title,
+					Value: choice.Value,
+					Field: fields[q][c],
+					Total: total,
+				})
+			}
+			res.Questions = append(res.Questions, qr)
+		}
+	}
+	httpWriteJSON(w, res)
+}
+
+// processIDParam decodes the process ID of the URL of the request. If it is
+// not valid, it writes the error response and returns false.
+func processIDParam(w http.ResponseWriter, r *http.Request) (*types.ProcessID, bool) {
+	pidBytes, err := hex.DecodeString(chi.URLParam(r, ProcessURLParam))
+	if err != nil {
+		ErrMalformedProcessID.Withf("could not decode process ID: %v", err).Write(w)
+		return nil, false
+	}
+	pid := &types.ProcessID{}
+	if err := pid.Unmarshal(pidBytes); err != nil {
+		ErrMalformedProcessID.Withf("could not unmarshal process ID: %v", err).Write(w)
+		return nil, false
+	}
+	return pid, true
+}
+
+// listProcesses lists the summaries of the processes that pass the filters
+// of the query parameters, paginated.
+// GET /processes
+func (a *API) listProcesses(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &storage.ProcessFilter{}
+	if org := query.Get(OrganizationIDParam); org != "" {
+		if !common.IsHexAddress(org) {
+			ErrMalformedParam.Withf("invalid %s", OrganizationIDParam).Write(w)
+			return
+		}
+		address := common.HexToAddress(org)
+		filter.OrganizationID = &address
+	}
+	if chain := query.Get(ChainIDParam); chain != "" {
+		chainID, err := strconv.ParseUint(chain, 10, 32)
+		if err != nil {
+			ErrMalformedParam.Withf("invalid %s: %v", ChainIDParam, err).Write(w)
+			return
+		}
+		id := uint32(chainID)
+		filter.ChainID = &id
+	}
+	if status := query.Get(StatusParam); status != "" {
+		value, err := strconv.ParseUint(status, 10, 8)
+		if err != nil || uint8(value) > types.ProcessStatusResults {
+			ErrMalformedParam.Withf("invalid %s", StatusParam).Write(w)
+			return
+		}
+		st := uint8(value)
+		filter.Status = &st
+	}
+	for param, t := range map[string]*time.Time{FromParam: &filter.From, ToParam: &filter.To} {
+		if value := query.Get(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				ErrMalformedParam.Withf("invalid %s: %v", param, err).Write(w)
+				return
+			}
+			*t = parsed
+		}
+	}
+	pageSize := DefaultPageSize
+	if size := query.Get(PageSizeParam); size != "" {
+		var err error
+		if pageSize, err = strconv.Atoi(size); err != nil || pageSize < 1 || pageSize > MaxPageSize {
+			ErrMalformedParam.Withf("%s must be between 1 and %d", PageSizeParam, MaxPageSize).Write(w)
+			return
+		}
+	}
+	if cursor := query.Get(CursorParam); cursor != "" {
+		after, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(after) == 0 {
+			ErrMalformedParam.Withf("invalid %s", CursorParam).Write(w)
+			return
+		}
+		filter.After = after
+	}
+
+	// get one more process than the page size to know if there is a next
+	// page
+	filter.Limit = pageSize + 1
+	summaries, err := a.storage.ListProcessSummaries(filter)
+	if err != nil {
+		ErrGenericInternalServerError.Withf("could not list processes: %v", err).Write(w)
+		return
+	}
+	page := &ProcessesPage{Processes: summaries}
+	if len(summaries) > pageSize {
+		page.Processes = summaries[:pageSize]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(page.Processes[pageSize-1].ID)
+	}
+	httpWriteJSON(w, page)
+}
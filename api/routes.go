@@ -1,15 +1,31 @@
 package api
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 const (
 	// PingEndpoint is the endpoint for checking the API status
 	PingEndpoint = "/ping"
-	// ProcessesEndpoint is the endpoint for creating a new voting process
+	// MetricsEndpoint is the endpoint for scraping the Prometheus metrics
+	MetricsEndpoint = "/metrics"
+	// ProcessesEndpoint is the endpoint for creating a new voting process and
+	// for listing the processes, filtered with the OrganizationIDParam,
+	// ChainIDParam, StatusParam, FromParam and ToParam query parameters and
+	// paginated with the PageSizeParam and CursorParam query parameters
 	ProcessesEndpoint = "/processes"
 	// ProcessEndpoint is the endpoint to get the process info
 	ProcessURLParam = "processId"
 	ProcessEndpoint = "/processes/{" + ProcessURLParam + "}"
+	// ProcessResultsEndpoint is the endpoint to get the results of a process
+	ProcessResultsEndpoint = "/processes/{" + ProcessURLParam + "}/results"
+	// ProcessEventsEndpoint is the endpoint to receive the events of a process
+	// as Server-Sent Events
+	ProcessEventsEndpoint = "/processes/{" + ProcessURLParam + "}/events"
+	// ProcessEventsWSEndpoint is the endpoint to receive the events of a
+	// process as WebSocket JSON messages
+	ProcessEventsWSEndpoint = "/processes/{" + ProcessURLParam + "}/events/ws"
 	// TestSetProcessEndpoint and TestProcessEndpoint is the endpoint for store
 	// and retrieve the process info for testing. In a real scenatio, this
 	// information should be in the smart contract.
@@ -19,11 +35,28 @@ const (
 	VotesEndpoint = "/votes"
 
 	CensusURLParam = "censusID"
+	// AuthorizationHeader is the HTTP header that carries the credentials of
+	// the administrative requests, an API key or a JSON Web Token preceded by
+	// the BearerScheme
+	AuthorizationHeader = "Authorization"
+	BearerScheme        = "Bearer"
+	// CensusAuthTokenHeader is the HTTP header that carries the management
+	// token of a census, required by the census write operations
+	CensusAuthTokenHeader = "X-Census-Token"
 	// NewCensusEndpoint is the endpoint for creating a new census
 	NewCensusEndpoint = "/censuses"
+	// DeriveCensusEndpoint is the endpoint for creating a new census from the
+	// union, intersection or difference of other censuses
+	DeriveCensusEndpoint = "/censuses/derive"
 	// AddCensusParticipantsEndpoint is the endpoint for adding participants to a census
 	AddCensusParticipantsEndpoint = "/censuses/{" + CensusURLParam + "}/participants"
-	// GetCensusParticipantsEndpoint is the endpoint for getting the participants of a census
+	// UpdateCensusParticipantsEndpoint is the endpoint for updating the weight of participants of a census
+	UpdateCensusParticipantsEndpoint = "/censuses/{" + CensusURLParam + "}/participants"
+	// DeleteCensusParticipantsEndpoint is the endpoint for removing participants from a census
+	DeleteCensusParticipantsEndpoint = "/censuses/{" + CensusURLParam + "}/participants"
+	// GetCensusParticipantsEndpoint is the endpoint for getting the participants of a census,
+	// paginated with the PageSizeParam and CursorParam query parameters, or
+	// streamed as NDJSON if FormatParam is FormatNDJSON
 	GetCensusParticipantsEndpoint = "/censuses/{" + CensusURLParam + "}/participants"
 	// GetCensusRootEndpoint is the endpoint for getting the root of a census
 	GetCensusRootEndpoint = "/censuses/{" + CensusURLParam + "}/root"
@@ -33,6 +66,88 @@ const (
 	DeleteCensusEndpoint = "/censuses/{" + CensusURLParam + "}"
 	// GetCensusProofEndpoint is the endpoint for getting a proof of a census
 	GetCensusProofEndpoint = "/censuses/{" + CensusURLParam + "}/proof"
+	// GetCensusProofsEndpoint is the endpoint for getting the proofs of a batch of keys of a census
+	GetCensusProofsEndpoint = "/censuses/{" + CensusURLParam + "}/proofs"
+	// PublishCensusEndpoint is the endpoint for publishing a census
+	PublishCensusEndpoint = "/censuses/{" + CensusURLParam + "}/publish"
+	// ImportCensusParticipantsEndpoint is the endpoint for starting a bulk
+	// import of participants to a census from CSV or NDJSON rows
+	ImportCensusParticipantsEndpoint = "/censuses/{" + CensusURLParam + "}/import"
+	// CensusImportJobEndpoint is the endpoint for getting the status of a
+	// census bulk import
+	CensusImportJobURLParam = "jobID"
+	CensusImportJobEndpoint = "/censuses/{" + CensusURLParam + "}/import/{" + CensusImportJobURLParam + "}"
+)
+
+const (
+	// PageSizeParam is the query parameter for the number of items of a page
+	PageSizeParam = "pageSize"
+	// CursorParam is the query parameter for the opaque cursor returned by
+	// the previous page
+	CursorParam = "cursor"
+	// OrganizationIDParam is the query parameter for the organization address
+	// of the processes listed
+	OrganizationIDParam = "organizationId"
+	// ChainIDParam is the query parameter for the chain ID of the processes
+	// listed
+	ChainIDParam = "chainId"
+	// StatusParam is the query parameter for the status of the processes
+	// listed
+	StatusParam = "status"
+	// FromParam and ToParam are the query parameters for the RFC 3339 bounds
+	// of the time window that the voting period of the processes listed must
+	// overlap
+	FromParam = "from"
+	ToParam   = "to"
+	// LastEventIDParam is the query parameter for the ID of the last event
+	// received, to resume an event stream. The Server-Sent Events streams
+	// also accept it in the LastEventIDHeader header.
+	LastEventIDParam  = "lastEventId"
+	LastEventIDHeader = "Last-Event-ID"
+	// FormatParam is the query parameter for the format of the response
+	FormatParam = "format"
+	// FormatNDJSON is the FormatParam value to stream the response as
+	// newline delimited JSON
+	FormatNDJSON = "ndjson"
+	// NDJSONContentType is the content type of the newline delimited JSON
+	// responses, it can also be requested with the Accept header
+	NDJSONContentType = "application/x-ndjson"
+	// FormatCSV is the FormatParam value to import census participants as
+	// comma separated values
+	FormatCSV = "csv"
+	// CSVContentType is the content type of the comma separated values
+	CSVContentType = "text/csv"
+
+	// DefaultPageSize is the page size used if no PageSizeParam is provided
+	DefaultPageSize = 100
+	// MaxPageSize is the maximum page size allowed
+	MaxPageSize = 1000
+	// MaxCensusProofKeys is the maximum number of keys of a census proofs
+	// request, which bounds the size of the response
+	MaxCensusProofKeys = 1000
+	// MaxCensusProofsRequestSize is the maximum size in bytes of the body of
+	// a census proofs request, enough for MaxCensusProofKeys hex keys
+	MaxCensusProofsRequestSize = 256 << 10
+	// MaxDeriveCensusSources is the maximum number of source censuses of a
+	// census derivation request
+	MaxDeriveCensusSources = 16
+	// EventStreamKeepAlive is the interval of the keep alive messages of the
+	// event streams
+	EventStreamKeepAlive = 30 * time.Second
+	// MaxCensusImportSize is the maximum size in bytes of the data of a
+	// census bulk import
+	MaxCensusImportSize = 1 << 30
+)
+
+const (
+	// CensusImportRunning is the status of a census import in progress
+	CensusImportRunning = "running"
+	// CensusImportDone is the status of a finished census import, even if
+	// some of its rows were rejected
+	CensusImportDone = "done"
+	// CensusImportFailed is the status of a census import that could not be
+	// finished
+	CensusImportFailed = "failed"
 )
 
 // EndpointWithParam replaces the key in the path with the param value
@@ -1,15 +1,51 @@
 package api
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/vocdoni/circom2gnark/parser"
 	"github.com/vocdoni/vocdoni-z-sandbox/crypto/elgamal"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 )
 
-// NewCensus is the response to a new census creation request.
+// NewCensusRequest is the optional body of a new census creation request.
+// HashType is the hash function of the census tree, if it is empty the
+// default one is used.
+type NewCensusRequest struct {
+	HashType string `json:"hashType,omitempty"`
+}
+
+// NewCensus is the response to a new census creation request. The
+// AuthToken is the secret token required to manage the census, it must be
+// sent in the CensusAuthTokenHeader of the census write requests.
 type NewCensus struct {
-	Census uuid.UUID `json:"census"`
+	Census    uuid.UUID `json:"census"`
+	AuthToken string    `json:"authToken"`
+	HashType  string    `json:"hashType"`
+}
+
+// DeriveCensusRequest is the body of a census derivation request. The new
+// census contains the participants resulting of the Operation (union,
+// intersection or difference) applied to the participants of the Sources
+// censuses, in order. The WeightRule (first, sum or max) combines the weights
+// of the participants in several sources, if it is empty the weight of the
+// first source is taken.
+type DeriveCensusRequest struct {
+	Operation  string      `json:"operation"`
+	WeightRule string      `json:"weightRule,omitempty"`
+	Sources    []uuid.UUID `json:"sources"`
+}
+
+// DerivedCensus is the response to a census derivation request. Like the new
+// censuses, the derived census is managed with the AuthToken provided.
+type DerivedCensus struct {
+	Census    uuid.UUID      `json:"census"`
+	AuthToken string         `json:"authToken"`
+	HashType  string         `json:"hashType"`
+	Root      types.HexBytes `json:"root"`
+	Size      int            `json:"size"`
 }
 
 // CensusRoot is the response to a census root request.
@@ -17,6 +53,14 @@ type CensusRoot struct {
 	Root types.HexBytes `json:"root"`
 }
 
+// PublishedCensus is the response to a census publish request.
+type PublishedCensus struct {
+	Census      uuid.UUID      `json:"census"`
+	Root        types.HexBytes `json:"root"`
+	Size        int            `json:"size"`
+	PublishedAt time.Time      `json:"publishedAt"`
+}
+
 // CensusParticipant is a participant in a census.
 type CensusParticipant struct {
 	Key    types.HexBytes `json:"key"`
@@ -28,6 +72,106 @@ type CensusParticipants struct {
 	Participants []*CensusParticipant `json:"participants"`
 }
 
+// CensusParticipantKeys is a list of keys of participants in a census.
+type CensusParticipantKeys struct {
+	Keys []types.HexBytes `json:"keys"`
+}
+
+// CensusParticipantFailure is a participant that could not be modified and
+// the reason.
+type CensusParticipantFailure struct {
+	Key   types.HexBytes `json:"key"`
+	Error string         `json:"error"`
+}
+
+// CensusParticipantsResult is the response to a participants update or
+// removal request. The participants listed in Failed were not modified.
+type CensusParticipantsResult struct {
+	Succeeded int                         `json:"succeeded"`
+	Failed    []*CensusParticipantFailure `json:"failed"`
+}
+
+// CensusKeyProof is the census proof of a key. If the key is not found in
+// the census, Found is false and Proof is nil.
+type CensusKeyProof struct {
+	Key   types.HexBytes     `json:"key"`
+	Found bool               `json:"found"`
+	Proof *types.CensusProof `json:"proof,omitempty"`
+}
+
+// CensusProofs is the response to a census proofs request, with one proof
+// for each key requested in the same order.
+type CensusProofs struct {
+	Proofs []*CensusKeyProof `json:"proofs"`
+}
+
+// CensusParticipantsPage is a page of the participants of a census. The
+// NextCursor must be provided to get the next page, it is empty if there are
+// no more participants.
+type CensusParticipantsPage struct {
+	Participants []*CensusParticipant `json:"participants"`
+	NextCursor   string               `json:"nextCursor,omitempty"`
+}
+
+// CensusImportJob is the status of a bulk import of participants into a
+// census. Processed is the number of rows read so far, which are either
+// imported or rejected. Only the first rejected rows are listed in
+// RejectedRows, Rejected counts all of them.
+type CensusImportJob struct {
+	ID           uuid.UUID                  `json:"id"`
+	Census       uuid.UUID                  `json:"census"`
+	Status       string                     `json:"status"`
+	Processed    int                        `json:"processed"`
+	Imported     int                        `json:"imported"`
+	Rejected     int                        `json:"rejected"`
+	RejectedRows []*CensusImportRejectedRow `json:"rejectedRows"`
+	Error        string                     `json:"error,omitempty"`
+	StartedAt    time.Time                  `json:"startedAt"`
+	FinishedAt   *time.Time                 `json:"finishedAt,omitempty"`
+}
+
+// CensusImportRejectedRow is a row of a census import that was not imported,
+// identified by its line number in the imported data.
+type CensusImportRejectedRow struct {
+	Line  int            `json:"line"`
+	Key   types.HexBytes `json:"key,omitempty"`
+	Error string         `json:"error"`
+}
+
+// ProcessesPage is a page of the summaries of the processes. The NextCursor
+// must be provided to get the next page, it is empty if there are no more
+// processes.
+type ProcessesPage struct {
+	Processes  []*storage.ProcessSummary `json:"processes"`
+	NextCursor string                    `json:"nextCursor,omitempty"`
+}
+
+// ProcessResults are the results of a process. Results are the raw totals of
+// each ballot field. If the metadata of the process is available, Questions
+// maps the totals onto its questions and choices.
+type ProcessResults struct {
+	ProcessID types.HexBytes     `json:"processId"`
+	Results   []*types.BigInt    `json:"results"`
+	Questions []*QuestionResults `json:"questions,omitempty"`
+}
+
+// QuestionResults are the results of a question of the metadata of a
+// process, with the title in every language of the metadata.
+type QuestionResults struct {
+	Title   types.MultilingualString `json:"title"`
+	Choices []*ChoiceResults         `json:"choices"`
+}
+
+// ChoiceResults are the results of a choice of a question. Field is the index
+// of the ballot field of the choice in the raw results, and Value is the
+// value of the choice in the metadata.
+type ChoiceResults struct {
+	Title types.MultilingualString `json:"title"`
+	Value int                      `json:"value"`
+	Field int                      `json:"field"`
+	Total *types.BigInt            `json:"total"`
+}
+
 // Vote is the struct to represent a vote in the system. It will be provided by
 // the user to cast a vote in a process.
 type Vote struct {
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/vocdoni/vocdoni-z-sandbox/circuits"
 	"github.com/vocdoni/vocdoni-z-sandbox/circuits/ballotproof"
+	"github.com/vocdoni/vocdoni-z-sandbox/circuits/voteverifier"
+	"github.com/vocdoni/vocdoni-z-sandbox/metrics"
 	"github.com/vocdoni/vocdoni-z-sandbox/storage"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 )
@@ -17,34 +20,44 @@ func (a *API) newVote(w http.ResponseWriter, r *http.Request) {
 	// decode the vote
 	vote := &Vote{}
 	if err := json.NewDecoder(r.Body).Decode(vote); err != nil {
-		ErrMalformedBody.Withf("could not decode request body: %v", err).Write(w)
+		rejectBallot(w, ErrMalformedBody.Withf("could not decode request body: %v", err))
 		return
 	}
 	// get the process from the storage
 	pid := new(types.ProcessID)
 	if err := pid.Unmarshal(vote.ProcessID); err != nil {
-		ErrMalformedBody.Withf("could not decode process id: %v", err).Write(w)
+		rejectBallot(w, ErrMalformedBody.Withf("could not decode process id: %v", err))
 		return
 	}
 	process, err := a.storage.Process(pid)
 	if err != nil {
-		ErrResourceNotFound.Withf("could not get process: %v", err).Write(w)
+		rejectBallot(w, ErrResourceNotFound.Withf("could not get process: %v", err))
+		return
+	}
+	// check that the ballots of the census origin of the process can be
+	// proven, otherwise they would be dropped by the processor
+	if process.Census == nil {
+		rejectBallot(w, ErrUnsupportedCensus.Withf("process without census"))
+		return
+	}
+	if err := voteverifier.CheckCensusOrigin(process.Census.CensusOrigin); err != nil {
+		rejectBallot(w, ErrUnsupportedCensus.WithErr(err))
 		return
 	}
 	// check that the census root is the same as the one in the process
 	if !bytes.Equal(process.Census.CensusRoot, vote.CensusProof.Root) {
-		ErrInvalidCensusProof.Withf("census root mismatch").Write(w)
+		rejectBallot(w, ErrInvalidCensusProof.Withf("census root mismatch"))
 		return
 	}
 	// verify the census proof
 	if !a.storage.CensusDB().VerifyProof(&vote.CensusProof) {
-		ErrInvalidCensusProof.Withf("census proof verification failed").Write(w)
+		rejectBallot(w, ErrInvalidCensusProof.Withf("census proof verification failed"))
 		return
 	}
 	// load the verification key for the ballot proof circuit, used by the user
 	// to generate a proof of a valid ballot
 	if err := ballotproof.Artifacts.LoadAll(); err != nil {
-		ErrGenericInternalServerError.Withf("could not load artifacts: %v", err).Write(w)
+		rejectBallot(w, ErrGenericInternalServerError.Withf("could not load artifacts: %v", err))
 		return
 	}
 	// convert the circom proof to gnark proof and verify it
@@ -54,12 +67,12 @@ func (a *API) newVote(w http.ResponseWriter, r *http.Request) {
 		[]string{vote.BallotInputsHash.BigInt().String()},
 	)
 	if err != nil {
-		ErrInvalidBallotProof.Withf("could not verify and convert proof: %v", err).Write(w)
+		rejectBallot(w, ErrInvalidBallotProof.Withf("could not verify and convert proof: %v", err))
 		return
 	}
 	// verify the signature of the vote
 	if !vote.Signature.Verify(vote.BallotInputsHash.BigInt().MathBigInt(), vote.PublicKey) {
-		ErrInvalidSignature.Withf("invalid vote signature").Write(w)
+		rejectBallot(w, ErrInvalidSignature.Withf("invalid vote signature"))
 		return
 	}
 	// push the ballot to the processor storage queue to be verified, aggregated
@@ -77,8 +90,16 @@ func (a *API) newVote(w http.ResponseWriter, r *http.Request) {
 		CensusProof:      vote.CensusProof,
 		PubKey:           vote.PublicKey,
 	}); err != nil {
-		ErrGenericInternalServerError.Withf("could not push ballot: %v", err).Write(w)
+		rejectBallot(w, ErrGenericInternalServerError.Withf("could not push ballot: %v", err))
 		return
 	}
+	metrics.BallotsAccepted.Inc()
 	httpWriteOK(w)
 }
+
+// rejectBallot writes the error response of a rejected ballot and counts the
+// rejection by its error code.
+func rejectBallot(w http.ResponseWriter, e Error) {
+	metrics.BallotsRejected.WithLabelValues(metrics.StageAPI, strconv.Itoa(e.Code)).Inc()
+	e.Write(w)
+}
@@ -71,7 +71,7 @@ func VoteVerifierInputsForTest(votersData []VoterTestData, processId []byte) (
 		return VoteVerifierTestResults{}, voteverifier.VerifyVoteCircuit{}, nil, err
 	}
 	// common data
-	if processId != nil {
+	if processId == nil {
 		processId = util.RandomBytes(20)
 	}
 	ek := ballottest.GenEncryptionKeyForTest()
@@ -162,16 +162,16 @@ func VoteVerifierInputsForTest(votersData []VoterTestData, processId []byte) (
 	}
 
 	return VoteVerifierTestResults{
-			InputsHashes:     inputsHashes,
-			EncryptionPubKey: encryptionKey,
-			Addresses:        addresses,
-			ProcessID:        finalProcessID,
-			CensusRoot:       testCensus.Root,
-			Nullifiers:       nullifiers,
-			Commitments:      commitments,
-			Ballots:          ballots,
-		}, voteverifier.VerifyVoteCircuit{
-			CircomProof:           circomPlaceholder.Proof,
-			CircomVerificationKey: circomPlaceholder.Vk,
-		}, assignments, nil
+		InputsHashes:     inputsHashes,
+		EncryptionPubKey: encryptionKey,
+		Addresses:        addresses,
+		ProcessID:        finalProcessID,
+		CensusRoot:       testCensus.Root,
+		Nullifiers:       nullifiers,
+		Commitments:      commitments,
+		Ballots:          ballots,
+	}, voteverifier.VerifyVoteCircuit{
+		CircomProof:           circomPlaceholder.Proof,
+		CircomVerificationKey: circomPlaceholder.Vk,
+	}, assignments, nil
 }
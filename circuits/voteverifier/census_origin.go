@@ -0,0 +1,24 @@
+package voteverifier
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+// ErrUnsupportedCensusOrigin is returned by CheckCensusOrigin if the ballots
+// of the census origin provided cannot be proven.
+var ErrUnsupportedCensusOrigin = errors.New("unsupported census origin")
+
+// CheckCensusOrigin returns ErrUnsupportedCensusOrigin if the ballots of the
+// processes with the census origin provided cannot be proven. The circuit only
+// verifies census merkle proofs, so the Credential Service Provider (CSP)
+// censuses, whose proofs are signatures (see the crypto/csp package), are not
+// supported.
+func CheckCensusOrigin(censusOrigin uint8) error {
+	if censusOrigin == types.CensusOriginOffChainCA {
+		return fmt.Errorf("%w %d: CSP census proofs cannot be proven", ErrUnsupportedCensusOrigin, censusOrigin)
+	}
+	return nil
+}
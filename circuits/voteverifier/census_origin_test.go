@@ -0,0 +1,15 @@
+package voteverifier
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+func TestCheckCensusOrigin(t *testing.T) {
+	c := qt.New(t)
+	c.Assert(CheckCensusOrigin(types.CensusOriginOffChainTree), qt.IsNil)
+	c.Assert(CheckCensusOrigin(types.CensusOriginERC20), qt.IsNil)
+	c.Assert(CheckCensusOrigin(types.CensusOriginOffChainCA), qt.ErrorIs, ErrUnsupportedCensusOrigin)
+}
@@ -2,22 +2,25 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"time"
 
 	flag "github.com/spf13/pflag"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/vocdoni/arbo/memdb"
-	bjj "github.com/vocdoni/vocdoni-z-sandbox/crypto/ecc/bjj_gnark"
-	"github.com/vocdoni/vocdoni-z-sandbox/crypto/ecc/curves"
-	"github.com/vocdoni/vocdoni-z-sandbox/crypto/elgamal"
+	"github.com/vocdoni/vocdoni-z-sandbox/api"
+	"github.com/vocdoni/vocdoni-z-sandbox/api/client"
 	"github.com/vocdoni/vocdoni-z-sandbox/log"
 	"github.com/vocdoni/vocdoni-z-sandbox/service"
 	"github.com/vocdoni/vocdoni-z-sandbox/storage"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 	"github.com/vocdoni/vocdoni-z-sandbox/util"
 	"github.com/vocdoni/vocdoni-z-sandbox/web3"
+	"github.com/vocdoni/vocdoni-z-sandbox/web3/signer"
 )
 
 var rpcs = []string{
@@ -40,14 +43,26 @@ const (
 )
 
 func main() {
-	privKey := flag.String("privkey", testLocalAccountPrivKey, "private key to use for the Ethereum account")
+	privKey := flag.String("privkey", "", "private key to use for the Ethereum account (defaults to the local geth test account)")
+	keystorePath := flag.String("keystore", "", "encrypted JSON keystore file of the Ethereum account")
+	passphraseFile := flag.String("keystorePassphraseFile", "", "file containing the passphrase of the keystore")
+	signerURL := flag.String("signerURL", "", "JSON-RPC endpoint of an external signer (clef compatible)")
+	signerAddr := flag.String("signerAddress", "", "account of the external signer to use (defaults to the first one)")
 	sepolia := flag.Bool("sepolia", false, "use sepolia dev deployment")
 	w3rpc := flag.String("w3rpc", "http://localhost:8545", "web3 rpc endpoint")
+	sweepInterval := flag.Duration("censusSweepInterval", service.DefaultCensusSweepConfig.Interval, "time between the census garbage collection sweeps")
+	censusIdleTimeout := flag.Duration("censusIdleTimeout", service.DefaultCensusSweepConfig.IdleTimeout, "time after which an unused census is unloaded from memory (0 to keep them loaded)")
+	censusRetention := flag.Duration("censusRetention", service.DefaultCensusSweepConfig.Retention, "time after which an unused unpublished census is deleted (0 to keep them)")
 
 	flag.Parse()
 	log.Init("debug", "stdout", nil)
 
-	var err error
+	txSigner, err := loadSigner(*privKey, *keystorePath, *passphraseFile, *signerURL, *signerAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infow("signer loaded", "address", txSigner.Address().Hex())
+
 	contracts := &web3.Contracts{}
 
 	if *sepolia {
@@ -65,14 +80,12 @@ func main() {
 			}
 		}
 
-		if err := contracts.SetAccountPrivateKey(*privKey); err != nil {
-			log.Fatal(err)
-		}
+		contracts.SetSigner(txSigner)
 
 		log.Infow("contracts initialized", "chainId", contracts.ChainID)
 
 	} else {
-		contracts, err = web3.DeployContracts(*w3rpc, *privKey)
+		contracts, err = web3.DeployContractsWithSigner(*w3rpc, txSigner)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -89,25 +102,51 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// collect the idle and abandoned censuses
+	sweeper := service.NewCensusSweeper(stg, census.SweepConfig{
+		Interval:    *sweepInterval,
+		IdleTimeout: *censusIdleTimeout,
+		Retention:   *censusRetention,
+	})
+	if err := sweeper.Start(ctx); err != nil {
+		log.Fatal(err)
+	}
+
 	// start API service
-	api := service.NewAPI(stg, "0.0.0.0", 0)
-	if err := api.Start(ctx); err != nil {
+	apiSrv := service.NewAPI(stg, "127.0.0.1", 0)
+	apiSrv.SetOrganizationAdmins(uint32(contracts.ChainID), contracts)
+	// the administrative requests are authorized with a random operator key
+	apiKey := util.RandomHex(32)
+	apiSrv.SetAuthenticator(api.APIKeys{apiKey: {api.ScopeOperator}})
+	if err := apiSrv.Start(ctx); err != nil {
+		log.Fatal(err)
+	}
+	host, port := apiSrv.HostPort()
+	cli, err := client.New(fmt.Sprintf("http://%s:%d", host, port))
+	if err != nil {
 		log.Fatal(err)
 	}
+	cli.SetAuthToken(apiKey)
 
 	// monitor new organizations
 	newOrgChan, err := contracts.MonitorOrganizationCreatedByPolling(ctx, time.Second*5)
 	if err != nil {
 		log.Fatal(err)
 	}
+	updatedOrgChan, err := contracts.MonitorOrganizationUpdatedByPolling(ctx, time.Second*5)
+	if err != nil {
+		log.Fatal(err)
+	}
 	go func() {
-		log.Info("monitoring new organizations")
+		log.Info("monitoring new and updated organizations")
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case org := <-newOrgChan:
 				log.Infow("new organization found", "organization", org.String())
+			case org := <-updatedOrgChan:
+				log.Infow("organization updated", "organization", org.String())
 			}
 		}
 	}()
@@ -129,39 +168,38 @@ func main() {
 		return
 	}
 
-	curve := curves.New(bjj.CurveType)
-	pubKey, _, err := elgamal.GenerateKey(curve)
+	ballotMode := types.BallotMode{
+		MaxCount:        2,
+		MaxValue:        new(types.BigInt).SetUint64(100),
+		MinValue:        new(types.BigInt).SetUint64(0),
+		MaxTotalCost:    new(types.BigInt).SetUint64(0),
+		MinTotalCost:    new(types.BigInt).SetUint64(0),
+		ForceUniqueness: false,
+		CostFromWeight:  false,
+	}
+	censusRoot, setup, err := setupProcess(cli, contracts, ballotMode)
 	if err != nil {
-		log.Errorw(err, "failed to generate key")
+		log.Errorw(err, "failed to set up process")
 		return
 	}
-	x, y := pubKey.Point()
 
 	_, _, err = contracts.CreateProcess(&types.Process{
 		Status:         0,
 		OrganizationId: contracts.AccountAddress(),
 		EncryptionKey: &types.EncryptionKey{
-			X: x,
-			Y: y,
+			X: setup.EncryptionPubKey[0].MathBigInt(),
+			Y: setup.EncryptionPubKey[1].MathBigInt(),
 		},
-		StateRoot:   util.RandomBytes(32),
+		StateRoot:   setup.StateRoot,
 		StartTime:   time.Now().Add(5 * time.Minute),
 		Duration:    time.Hour,
 		MetadataURI: "https://example.com/metadata",
-		BallotMode: &types.BallotMode{
-			MaxCount:        2,
-			MaxValue:        new(types.BigInt).SetUint64(100),
-			MinValue:        new(types.BigInt).SetUint64(0),
-			MaxTotalCost:    new(types.BigInt).SetUint64(0),
-			MinTotalCost:    new(types.BigInt).SetUint64(0),
-			ForceUniqueness: false,
-			CostFromWeight:  false,
-		},
+		BallotMode:  &ballotMode,
 		Census: &types.Census{
-			CensusRoot:   util.RandomBytes(32),
+			CensusRoot:   censusRoot,
 			MaxVotes:     new(types.BigInt).SetUint64(100),
 			CensusURI:    "https://example.com/census",
-			CensusOrigin: 0,
+			CensusOrigin: types.CensusOriginOffChainTree,
 		},
 	})
 	if err != nil {
@@ -170,3 +208,90 @@ func main() {
 	}
 	select {}
 }
+
+// setupProcess creates and publishes a census with the account of the
+// contracts as its only participant, and sets up a process with it through
+// the API, signed by the account. It returns the published census root and
+// the setup response.
+func setupProcess(cli *client.HTTPclient, contracts *web3.Contracts, ballotMode types.BallotMode) (types.HexBytes, *types.ProcessSetupResponse, error) {
+	data, status, err := cli.Request(client.HTTPPOST, nil, nil, api.NewCensusEndpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status != http.StatusOK {
+		return nil, nil, fmt.Errorf("could not create census: %d (%s)", status, data)
+	}
+	newCensus := &api.NewCensus{}
+	if err := json.Unmarshal(data, newCensus); err != nil {
+		return nil, nil, err
+	}
+	authHeader := http.Header{api.CensusAuthTokenHeader: []string{newCensus.AuthToken}}
+	participants := &api.CensusParticipants{Participants: []*api.CensusParticipant{{
+		Key:    contracts.AccountAddress().Bytes(),
+		Weight: new(types.BigInt).SetUint64(1),
+	}}}
+	endpoint := api.EndpointWithParam(api.AddCensusParticipantsEndpoint, api.CensusURLParam, newCensus.Census.String())
+	data, status, err = cli.RequestWithHeaders(client.HTTPPOST, participants, authHeader, nil, endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status != http.StatusOK {
+		return nil, nil, fmt.Errorf("could not add census participants: %d (%s)", status, data)
+	}
+	endpoint = api.EndpointWithParam(api.PublishCensusEndpoint, api.CensusURLParam, newCensus.Census.String())
+	data, status, err = cli.RequestWithHeaders(client.HTTPPOST, nil, authHeader, nil, endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status != http.StatusOK {
+		return nil, nil, fmt.Errorf("could not publish census: %d (%s)", status, data)
+	}
+	published := &api.PublishedCensus{}
+	if err := json.Unmarshal(data, published); err != nil {
+		return nil, nil, err
+	}
+
+	nonce, err := contracts.AccountNonce()
+	if err != nil {
+		return nil, nil, err
+	}
+	process := &types.ProcessSetup{
+		CensusRoot:     published.Root,
+		BallotMode:     ballotMode,
+		Nonce:          nonce,
+		ChainID:        uint32(contracts.ChainID),
+		OrganizationID: contracts.AccountAddress(),
+	}
+	if process.Signature, err = contracts.SignMessage(process.SignatureMessage()); err != nil {
+		return nil, nil, err
+	}
+	setup, err := cli.NewProcess(process)
+	if err != nil {
+		return nil, nil, err
+	}
+	return published.Root, setup, nil
+}
+
+// loadSigner returns the signer of the Ethereum account. An external signer
+// takes precedence over a keystore file, and a keystore file over a raw
+// private key. If none of them is provided, the local geth test account is
+// used.
+func loadSigner(privKey, keystorePath, passphraseFile, signerURL, signerAddr string) (signer.Signer, error) {
+	switch {
+	case signerURL != "":
+		return signer.NewRemoteSigner(signerURL, common.HexToAddress(signerAddr))
+	case keystorePath != "":
+		passphrase := ""
+		if passphraseFile != "" {
+			var err error
+			if passphrase, err = signer.ReadPassphraseFile(passphraseFile); err != nil {
+				return nil, err
+			}
+		}
+		return signer.NewKeystoreSigner(keystorePath, passphrase)
+	case privKey != "":
+		return signer.NewLocalSigner(privKey)
+	default:
+		return signer.NewLocalSigner(testLocalAccountPrivKey)
+	}
+}
@@ -0,0 +1,191 @@
+// Package csp implements the census proofs of the Credential Service
+// Providers (CSP). A CSP authenticates the voters by its own means (SMS,
+// OAuth, etc.) and signs the address of each eligible voter for a process
+// with its key, instead of including the voters in a census merkle tree. The
+// census root of the processes with the CensusOriginOffChainCA origin is
+// derived from the public key of the CSP, and the census proof of a voter is
+// the signature of its address, process and weight.
+//
+// The signatures are EdDSA signatures over the twisted Edwards curve of
+// BLS12-377 with the MiMC hash function, so a variant of the vote verifier
+// circuit could verify them natively. That variant does not exist yet, so
+// the sequencer rejects the processes with CSP censuses, and this package
+// only issues and verifies the proofs outside of the circuits.
+package csp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/fr/mimc"
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/twistededwards/eddsa"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/vocdoni/arbo"
+	"github.com/vocdoni/vocdoni-z-sandbox/crypto"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+const (
+	// PublicKeyLength is the size of a compressed CSP public key.
+	PublicKeyLength = fr.Bytes
+	// SignatureLength is the size of a CSP signature.
+	SignatureLength = 2 * fr.Bytes
+)
+
+// CSP is a Credential Service Provider that signs the census proofs of the
+// voters that it authenticates.
+type CSP struct {
+	key *eddsa.PrivateKey
+}
+
+// New creates a CSP with a new random key.
+func New() (*CSP, error) {
+	key, err := eddsa.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate CSP key: %w", err)
+	}
+	return &CSP{key: key}, nil
+}
+
+// NewFromBytes creates a CSP with the key encoded in the bytes provided, as
+// returned by Bytes.
+func NewFromBytes(privKey []byte) (*CSP, error) {
+	key := new(eddsa.PrivateKey)
+	if _, err := key.SetBytes(privKey); err != nil {
+		return nil, fmt.Errorf("invalid CSP key: %w", err)
+	}
+	return &CSP{key: key}, nil
+}
+
+// Bytes returns the encoded private key of the CSP.
+func (c *CSP) Bytes() []byte {
+	return c.key.Bytes()
+}
+
+// PublicKey returns the compressed public key of the CSP.
+func (c *CSP) PublicKey() types.HexBytes {
+	return c.key.PublicKey.Bytes()
+}
+
+// CensusRoot returns the census root of the processes whose voters are
+// authenticated by the CSP.
+func (c *CSP) CensusRoot() types.HexBytes {
+	return censusRoot(&c.key.PublicKey)
+}
+
+// GenerateProof signs the address and weight of the voter provided for the
+// process provided, and returns the resulting census proof.
+func (c *CSP) GenerateProof(processID []byte, address common.Address, weight *big.Int) (*types.CensusProof, error) {
+	msg, err := Message(processID, address, weight)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := c.key.Sign(msg, mimc.NewMiMC())
+	if err != nil {
+		return nil, fmt.Errorf("could not sign census proof: %w", err)
+	}
+	return &types.CensusProof{
+		CensusOrigin: types.CensusOriginOffChainCA,
+		Root:         c.CensusRoot(),
+		Key:          address.Bytes(),
+		Weight:       (*types.BigInt)(new(big.Int).Set(weight)),
+		PublicKey:    c.PublicKey(),
+		Signature:    signature,
+	}, nil
+}
+
+// CensusRoot returns the census root of the CSP with the compressed public
+// key provided, which is the MiMC hash of the coordinates of the key, encoded
+// as the arbo roots.
+func CensusRoot(pubKey []byte) (types.HexBytes, error) {
+	key, err := decodePublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return censusRoot(key), nil
+}
+
+// VerifyProof checks that the CSP census proof provided is valid for the
+// process provided. The root of the proof must be the census root of its
+// public key, and its signature must be valid for its key and weight.
+func VerifyProof(processID []byte, proof *types.CensusProof) error {
+	if proof == nil || proof.Weight == nil {
+		return fmt.Errorf("incomplete CSP census proof")
+	}
+	if proof.CensusOrigin != types.CensusOriginOffChainCA {
+		return fmt.Errorf("unexpected census origin %d", proof.CensusOrigin)
+	}
+	if len(proof.Key) != common.AddressLength {
+		return fmt.Errorf("invalid voter address length %d", len(proof.Key))
+	}
+	if len(proof.Signature) != SignatureLength {
+		return fmt.Errorf("invalid signature length %d", len(proof.Signature))
+	}
+	key, err := decodePublicKey(proof.PublicKey)
+	if err != nil {
+		return err
+	}
+	if root := censusRoot(key); !bytes.Equal(root, proof.Root) {
+		return fmt.Errorf("census root %x does not match the CSP public key", []byte(proof.Root))
+	}
+	msg, err := Message(processID, common.BytesToAddress(proof.Key), proof.Weight.MathBigInt())
+	if err != nil {
+		return err
+	}
+	valid, err := key.Verify(proof.Signature, msg, mimc.NewMiMC())
+	if err != nil {
+		return fmt.Errorf("could not verify CSP signature: %w", err)
+	}
+	if !valid {
+		return fmt.Errorf("invalid CSP signature")
+	}
+	return nil
+}
+
+// Message returns the message signed by the CSP for the voter provided, which
+// is the MiMC hash of the process ID, the address and the weight. The process
+// ID is reduced to the BN254 scalar field first, as the circuits do with it.
+func Message(processID []byte, address common.Address, weight *big.Int) ([]byte, error) {
+	if weight.Sign() < 0 || weight.Cmp(fr.Modulus()) >= 0 {
+		return nil, fmt.Errorf("weight %s out of range", weight)
+	}
+	pid := crypto.BigToFF(fr.Modulus(), crypto.BigToFF(ecc.BN254.ScalarField(), new(big.Int).SetBytes(processID)))
+	var elements [3]fr.Element
+	elements[0].SetBigInt(pid)
+	elements[1].SetBigInt(new(big.Int).SetBytes(address.Bytes()))
+	elements[2].SetBigInt(weight)
+	h := mimc.NewMiMC()
+	for _, e := range elements {
+		b := e.Bytes()
+		if _, err := h.Write(b[:]); err != nil {
+			return nil, fmt.Errorf("could not hash CSP message: %w", err)
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+func decodePublicKey(pubKey []byte) (*eddsa.PublicKey, error) {
+	if len(pubKey) != PublicKeyLength {
+		return nil, fmt.Errorf("invalid CSP public key length %d", len(pubKey))
+	}
+	key := new(eddsa.PublicKey)
+	if _, err := key.SetBytes(pubKey); err != nil {
+		return nil, fmt.Errorf("invalid CSP public key: %w", err)
+	}
+	return key, nil
+}
+
+func censusRoot(key *eddsa.PublicKey) types.HexBytes {
+	var root fr.Element
+	h := mimc.NewMiMC()
+	x, y := key.A.X.Bytes(), key.A.Y.Bytes()
+	// the coordinates are field elements, so they can always be hashed
+	_, _ = h.Write(x[:])
+	_, _ = h.Write(y[:])
+	root.SetBytes(h.Sum(nil))
+	return arbo.BigIntToBytes(fr.Bytes, root.BigInt(new(big.Int)))
+}
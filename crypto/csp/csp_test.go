@@ -0,0 +1,54 @@
+package csp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	qt "github.com/frankban/quicktest"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+	"github.com/vocdoni/vocdoni-z-sandbox/util"
+)
+
+func TestCSPProof(t *testing.T) {
+	c := qt.New(t)
+	t.Parallel()
+
+	provider, err := New()
+	c.Assert(err, qt.IsNil)
+	root, err := CensusRoot(provider.PublicKey())
+	c.Assert(err, qt.IsNil)
+	c.Assert(root, qt.DeepEquals, provider.CensusRoot())
+
+	processID := util.RandomBytes(32)
+	address := common.BytesToAddress(util.RandomBytes(20))
+	proof, err := provider.GenerateProof(processID, address, big.NewInt(10))
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.Valid(), qt.IsTrue)
+	c.Assert(VerifyProof(processID, proof), qt.IsNil)
+
+	// the key can be restored
+	restored, err := NewFromBytes(provider.Bytes())
+	c.Assert(err, qt.IsNil)
+	c.Assert(restored.PublicKey(), qt.DeepEquals, provider.PublicKey())
+
+	// the proof is bound to the process
+	c.Assert(VerifyProof(util.RandomBytes(32), proof), qt.IsNotNil)
+
+	// the proof is bound to the weight
+	tampered := *proof
+	tampered.Weight = new(types.BigInt).SetUint64(20)
+	c.Assert(VerifyProof(processID, &tampered), qt.IsNotNil)
+
+	// the proof is bound to the address
+	tampered = *proof
+	tampered.Key = util.RandomBytes(20)
+	c.Assert(VerifyProof(processID, &tampered), qt.IsNotNil)
+
+	// the root must be derived from the public key
+	other, err := New()
+	c.Assert(err, qt.IsNil)
+	tampered = *proof
+	tampered.Root = other.CensusRoot()
+	c.Assert(VerifyProof(processID, &tampered), qt.IsNotNil)
+}
@@ -0,0 +1,202 @@
+// Package events implements the event bus of the sequencer. The stages of the
+// storage publish the changes of the processes and their ballots, and the
+// subscribers receive the events of the process they are interested in. The
+// bus keeps the latest events, so the subscribers that reconnect can receive
+// the events published since the last one they received.
+package events
+
+import (
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+// Type is the type of an event.
+type Type string
+
+const (
+	// StateRoot is published when the state root of a process changes on
+	// chain. Its data is a StateRootData.
+	StateRoot Type = "stateRoot"
+	// BatchSettled is published when a batch of aggregated ballots of a
+	// process leaves the sequencer queues. Its data is a BatchData.
+	BatchSettled Type = "batchSettled"
+	// BallotStatus is published when a ballot moves to another stage. Its
+	// data is a BallotStatusData.
+	BallotStatus Type = "ballotStatus"
+	// ProcessEnded is published when a process stops accepting ballots
+	// because it is ended, canceled, its duration is over or its results are
+	// set. Its data is a ProcessStatusData.
+	ProcessEnded Type = "processEnded"
+	// ResultsReady is published when the results of a process are available.
+	// Its data is a ResultsData.
+	ResultsReady Type = "resultsReady"
+)
+
+// Ballot status values of the BallotStatusData events.
+const (
+	BallotPending    = "pending"
+	BallotVerified   = "verified"
+	BallotAggregated = "aggregated"
+)
+
+// DefaultHistorySize is the number of events kept by a bus created with a
+// non-positive history size.
+const DefaultHistorySize = 4096
+
+// subscriptionBuffer is the number of events that a subscriber can fall
+// behind before it is dropped.
+const subscriptionBuffer = 256
+
+// Event is an event of a process published on the bus. The ID of the events
+// is sequential, so it can be used to resume a subscription.
+type Event struct {
+	ID        uint64         `json:"id"`
+	Type      Type           `json:"type"`
+	ProcessID types.HexBytes `json:"processId"`
+	Time      time.Time      `json:"time"`
+	Data      any            `json:"data,omitempty"`
+}
+
+// StateRootData is the data of the StateRoot events.
+type StateRootData struct {
+	StateRoot types.HexBytes `json:"stateRoot"`
+}
+
+// BatchData is the data of the BatchSettled events.
+type BatchData struct {
+	Ballots int `json:"ballots"`
+}
+
+// BallotStatusData is the data of the BallotStatus events. The ballots are
+// identified by their nullifier.
+type BallotStatusData struct {
+	Nullifier types.HexBytes `json:"nullifier"`
+	Address   types.HexBytes `json:"address"`
+	Status    string         `json:"status"`
+}
+
+// ProcessStatusData is the data of the ProcessEnded events.
+type ProcessStatusData struct {
+	Status uint8 `json:"status"`
+}
+
+// ResultsData is the data of the ResultsReady events.
+type ResultsData struct {
+	Results []*types.BigInt `json:"results"`
+}
+
+// Subscription receives the events of a process published after it was
+// created. If the subscriber falls too far behind, the subscription is
+// dropped and C is closed, so the subscriber must subscribe again from the
+// last event received.
+type Subscription struct {
+	C     <-chan *Event
+	c     chan *Event
+	topic string
+}
+
+// Bus is the event bus. It is safe for concurrent use.
+type Bus struct {
+	mu          sync.Mutex
+	seq         uint64
+	history     []*Event
+	historySize int
+	subs        map[*Subscription]struct{}
+}
+
+// NewBus creates a new event bus that keeps the latest historySize events to
+// resume subscriptions. If historySize is not positive, DefaultHistorySize is
+// used.
+func NewBus(historySize int) *Bus {
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+	return &Bus{
+		historySize: historySize,
+		subs:        make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish publishes an event of the type and data provided for the process
+// provided, and returns it.
+func (b *Bus) Publish(processID []byte, t Type, data any) *Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e := &Event{
+		ID:        b.seq,
+		Type:      t,
+		ProcessID: append(types.HexBytes{}, processID...),
+		Time:      time.Now(),
+		Data:      data,
+	}
+	if len(b.history) == b.historySize {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, e)
+
+	topic := hex.EncodeToString(processID)
+	for sub := range b.subs {
+		if sub.topic != topic {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			// the subscriber is too slow, drop it so it resumes from the
+			// last event received
+			b.drop(sub)
+		}
+	}
+	return e
+}
+
+// Subscribe subscribes to the events of the process provided. If lastEventID
+// is not zero, it also returns the events of the process published after
+// that one that are still kept by the bus, which must be handled before the
+// events of the subscription. If lastEventID is newer than the last event
+// published, as happens if the sequencer restarted, every event kept is
+// returned.
+func (b *Bus) Subscribe(processID []byte, lastEventID uint64) ([]*Event, *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	topic := hex.EncodeToString(processID)
+	var missed []*Event
+	if lastEventID > 0 {
+		if lastEventID > b.seq {
+			lastEventID = 0
+		}
+		for _, e := range b.history {
+			if e.ID > lastEventID && e.ProcessID.String() == topic {
+				missed = append(missed, e)
+			}
+		}
+	}
+	c := make(chan *Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, topic: topic}
+	b.subs[sub] = struct{}{}
+	return missed, sub
+}
+
+// Unsubscribe cancels the subscription provided and closes its channel. It
+// can be called several times.
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(sub)
+}
+
+// drop removes the subscription provided and closes its channel. The caller
+// must hold the lock.
+func (b *Bus) drop(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.c)
+}
@@ -0,0 +1,53 @@
+package events
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestBus(t *testing.T) {
+	c := qt.New(t)
+	bus := NewBus(3)
+	pid1, pid2 := []byte{1}, []byte{2}
+
+	missed, sub := bus.Subscribe(pid1, 0)
+	c.Assert(missed, qt.HasLen, 0)
+	e1 := bus.Publish(pid1, StateRoot, &StateRootData{StateRoot: []byte{0xaa}})
+	bus.Publish(pid2, StateRoot, nil)
+	e3 := bus.Publish(pid1, ProcessEnded, &ProcessStatusData{Status: 1})
+
+	// only the events of the process are received
+	c.Assert(<-sub.C, qt.Equals, e1)
+	c.Assert(<-sub.C, qt.Equals, e3)
+	c.Assert(e3.ID, qt.Equals, uint64(3))
+
+	// a subscription is resumed from the last event received
+	missed, resumed := bus.Subscribe(pid1, e1.ID)
+	c.Assert(missed, qt.DeepEquals, []*Event{e3})
+	bus.Unsubscribe(resumed)
+	_, ok := <-resumed.C
+	c.Assert(ok, qt.IsFalse)
+	bus.Unsubscribe(resumed)
+
+	// only the latest events are kept
+	e4 := bus.Publish(pid1, ResultsReady, nil)
+	missed, resumed = bus.Subscribe(pid1, e1.ID)
+	c.Assert(missed, qt.DeepEquals, []*Event{e3, e4})
+	bus.Unsubscribe(resumed)
+
+	// after a restart, the unknown event IDs replay every event kept
+	missed, resumed = bus.Subscribe(pid1, 100)
+	c.Assert(missed, qt.DeepEquals, []*Event{e3, e4})
+	bus.Unsubscribe(resumed)
+
+	// the slow subscribers are dropped
+	for i := 0; i < subscriptionBuffer+1; i++ {
+		bus.Publish(pid1, BallotStatus, nil)
+	}
+	count := 0
+	for range sub.C {
+		count++
+	}
+	c.Assert(count, qt.Equals, subscriptionBuffer)
+}
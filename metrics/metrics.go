@@ -0,0 +1,158 @@
+// Package metrics defines the Prometheus metrics of the sequencer. The
+// stages of the sequencer update the metrics defined here, and the API
+// exposes them with the Handler, together with the metrics collected from the
+// storage on each scrape.
+package metrics
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace is the prefix of the names of the metrics of the sequencer.
+const namespace = "sequencer"
+
+// Circuit names of the ProvingDuration metric.
+const (
+	CircuitVoteVerifier = "voteverifier"
+)
+
+// Stage names of the BallotsRejected metric.
+const (
+	StageAPI       = "api"
+	StageProcessor = "processor"
+)
+
+// Reasons of the BallotsRejected metric for the ballots rejected by the
+// processor. The ballots rejected by the API use the API error code instead.
+const (
+	ReasonInvalidBallot      = "invalid_ballot"
+	ReasonProcessNotFound    = "process_not_found"
+	ReasonUnsupportedCensus  = "unsupported_census"
+	ReasonInvalidCensusProof = "invalid_census_proof"
+	ReasonInvalidInputs      = "invalid_inputs"
+	ReasonProvingFailed      = "proving_failed"
+	ReasonUnknown            = "unknown"
+)
+
+var (
+	// ProvingDuration is the time to generate a proof, by circuit.
+	ProvingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "proving_duration_seconds",
+		Help:      "Time to generate a proof, by circuit.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"circuit"})
+	// BallotsAccepted is the number of ballots accepted by the API.
+	BallotsAccepted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ballots_accepted_total",
+		Help:      "Number of ballots accepted by the API.",
+	})
+	// BallotsRejected is the number of ballots rejected, by the stage that
+	// rejected them and the reason, which is the API error code for the API
+	// stage.
+	BallotsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ballots_rejected_total",
+		Help:      "Number of ballots rejected, by stage and reason.",
+	}, []string{"stage", "reason"})
+	// RPCDuration is the duration of the web3 RPC requests, by chain,
+	// endpoint and method.
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "web3_rpc_duration_seconds",
+		Help:      "Duration of the web3 RPC requests, by chain, endpoint and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"chain_id", "endpoint", "method"})
+	// RPCErrors is the number of failed web3 RPC requests, by chain, endpoint
+	// and method.
+	RPCErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "web3_rpc_errors_total",
+		Help:      "Number of failed web3 RPC requests, by chain, endpoint and method.",
+	}, []string{"chain_id", "endpoint", "method"})
+	// MonitorLag is the number of blocks between the head of each chain and
+	// the last block scanned by the process monitor.
+	MonitorLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "monitor_lag_blocks",
+		Help:      "Number of blocks between the chain head and the last block scanned by the process monitor.",
+	}, []string{"chain_id"})
+)
+
+// registry is the registry of the metrics updated by the sequencer stages and
+// the runtime metrics.
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ProvingDuration,
+		BallotsAccepted,
+		BallotsRejected,
+		RPCDuration,
+		RPCErrors,
+		MonitorLag,
+	)
+}
+
+// Handler returns the HTTP handler that exposes the metrics of the sequencer
+// and the metrics gathered from the collectors provided on each scrape, such
+// as the storage collector created with NewStorageCollector. The collectors
+// are registered in a registry of the handler, so several handlers can
+// collect from different storages.
+func Handler(cs ...prometheus.Collector) http.Handler {
+	local := prometheus.NewRegistry()
+	local.MustRegister(cs...)
+	return promhttp.HandlerFor(prometheus.Gatherers{registry, local}, promhttp.HandlerOpts{})
+}
+
+// ObserveProving records the time to generate a proof of the circuit
+// provided since the start time provided.
+func ObserveProving(circuit string, start time.Time) {
+	ProvingDuration.WithLabelValues(circuit).Observe(time.Since(start).Seconds())
+}
+
+// ObserveRPC records the duration and result of a web3 RPC request of the
+// method provided to the endpoint provided, started at the start time
+// provided. Only the host of the endpoint is used as label, since the rest
+// of the URL may contain an API key.
+func ObserveRPC(chainID uint64, endpoint, method string, start time.Time, err error) {
+	labels := prometheus.Labels{
+		"chain_id": strconv.FormatUint(chainID, 10),
+		"endpoint": endpointHost(endpoint),
+		"method":   method,
+	}
+	RPCDuration.With(labels).Observe(time.Since(start).Seconds())
+	if err != nil {
+		RPCErrors.With(labels).Inc()
+	}
+}
+
+// SetMonitorLag sets the number of blocks between the head of the chain
+// provided and the last block scanned by the process monitor.
+func SetMonitorLag(chainID uint64, head, scanned uint64) {
+	lag := uint64(0)
+	if head > scanned {
+		lag = head - scanned
+	}
+	MonitorLag.WithLabelValues(strconv.FormatUint(chainID, 10)).Set(float64(lag))
+}
+
+// endpointHost returns the host of the endpoint URL provided, or "unknown"
+// if it cannot be parsed.
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage"
+)
+
+var (
+	queueDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "queue", "depth"),
+		"Number of items of each storage queue, by process.",
+		[]string{"queue", "process_id"}, nil)
+	queueReservationsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "queue", "reservations"),
+		"Number of reserved items of each storage queue.",
+		[]string{"queue"}, nil)
+	censusesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "censuses", "total"),
+		"Number of censuses, by state.",
+		[]string{"state"}, nil)
+	censusSweepTimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "census_sweep", "last_timestamp_seconds"),
+		"Time when the last census sweep started.",
+		nil, nil)
+	censusSweepDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "census_sweep", "last_duration_seconds"),
+		"Duration of the last census sweep.",
+		nil, nil)
+	censusSweepReclaimedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "census_sweep", "last_reclaimed"),
+		"Number of censuses unloaded and deleted, and database keys deleted, by the last census sweep.",
+		[]string{"resource"}, nil)
+)
+
+// storageCollector collects the queue, census and census sweep metrics of a
+// storage on each scrape.
+type storageCollector struct {
+	stg *storage.Storage
+}
+
+// NewStorageCollector returns a collector of the queue depths, reservations,
+// census counts and last census sweep report of the storage provided.
+func NewStorageCollector(stg *storage.Storage) prometheus.Collector {
+	return &storageCollector{stg: stg}
+}
+
+// Describe implements prometheus.Collector.
+func (sc *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- queueReservationsDesc
+	ch <- censusesDesc
+	ch <- censusSweepTimeDesc
+	ch <- censusSweepDurationDesc
+	ch <- censusSweepReclaimedDesc
+}
+
+// Collect implements prometheus.Collector. The metrics that cannot be read
+// from the storage are omitted.
+func (sc *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	queues, err := sc.stg.QueueStats()
+	if err != nil {
+		log.Warnw("could not collect queue metrics", "error", err.Error())
+	} else {
+		for queue, depths := range queues.Depths {
+			for pid, depth := range depths {
+				ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(depth), queue, pid)
+			}
+		}
+		for queue, reserved := range queues.Reservations {
+			ch <- prometheus.MustNewConstMetric(queueReservationsDesc, prometheus.GaugeValue, float64(reserved), queue)
+		}
+	}
+	if report := sc.stg.CensusDB().LastSweepReport(); report != nil {
+		ch <- prometheus.MustNewConstMetric(censusSweepTimeDesc, prometheus.GaugeValue,
+			float64(report.StartedAt.Unix()))
+		ch <- prometheus.MustNewConstMetric(censusSweepDurationDesc, prometheus.GaugeValue,
+			report.Duration.Seconds())
+		for resource, count := range map[string]int{
+			"unloaded":     len(report.Unloaded),
+			"deleted":      len(report.Deleted),
+			"deleted_keys": report.DeletedKeys,
+		} {
+			ch <- prometheus.MustNewConstMetric(censusSweepReclaimedDesc, prometheus.GaugeValue, float64(count), resource)
+		}
+	}
+	censuses, err := sc.stg.CensusDB().Stats()
+	if err != nil {
+		log.Warnw("could not collect census metrics", "error", err.Error())
+		return
+	}
+	for state, count := range map[string]int{
+		"stored":    censuses.Stored,
+		"loaded":    censuses.Loaded,
+		"published": censuses.Published,
+		"retained":  censuses.RetainedRoots,
+	} {
+		ch <- prometheus.MustNewConstMetric(censusesDesc, prometheus.GaugeValue, float64(count), state)
+	}
+}
@@ -2,6 +2,7 @@ package processor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
@@ -16,11 +17,22 @@ import (
 	"github.com/vocdoni/vocdoni-z-sandbox/circuits/voteverifier"
 	"github.com/vocdoni/vocdoni-z-sandbox/crypto"
 	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/metrics"
 	"github.com/vocdoni/vocdoni-z-sandbox/storage"
 	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 )
 
+// Errors returned by ProcessBallot, by the reason the ballot is rejected.
+var (
+	ErrInvalidBallot      = fmt.Errorf("invalid ballot")
+	ErrProcessNotFound    = fmt.Errorf("process not found")
+	ErrUnsupportedCensus  = fmt.Errorf("unsupported process census")
+	ErrInvalidCensusProof = fmt.Errorf("invalid census proof")
+	ErrInvalidInputs      = fmt.Errorf("invalid circuit inputs")
+	ErrProvingFailed      = fmt.Errorf("failed to generate proof")
+)
+
 // VoteProcessor is a processor that processes ballots, generating proofs of
 // their validity.
 type VoteProcessor struct {
@@ -71,6 +83,7 @@ func (p *VoteProcessor) Start(ctx context.Context) error {
 			verifiedBallot, err := p.ProcessBallot(ballot)
 			if err != nil {
 				log.Warnw("marking ballot as invalid", "address", ballot.Address.String(), "error", err.Error())
+				metrics.BallotsRejected.WithLabelValues(metrics.StageProcessor, rejectionReason(err)).Inc()
 				continue
 			}
 
@@ -97,12 +110,18 @@ func (p *VoteProcessor) Stop() error {
 func (p *VoteProcessor) ProcessBallot(b *storage.Ballot) (*storage.VerifiedBallot, error) {
 	// check if the ballot is valid
 	if !b.Valid() {
-		return nil, fmt.Errorf("invalid ballot")
+		return nil, ErrInvalidBallot
 	}
 	// get the process metadata
 	process, err := p.stg.Process(new(types.ProcessID).SetBytes(b.ProcessID))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get process metadata: %w", err)
+		return nil, fmt.Errorf("%w: failed to get process metadata: %w", ErrProcessNotFound, err)
+	}
+	if process.Census == nil {
+		return nil, fmt.Errorf("%w: process without census", ErrUnsupportedCensus)
+	}
+	if err := voteverifier.CheckCensusOrigin(process.Census.CensusOrigin); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedCensus, err)
 	}
 	// transform to circuit types
 	processID := crypto.BigToFF(circuits.BallotProofCurve.ScalarField(), b.ProcessID.BigInt().MathBigInt())
@@ -121,12 +140,12 @@ func (p *VoteProcessor) ProcessBallot(b *storage.Ballot) (*storage.VerifiedBallo
 	hashInputs = append(hashInputs, b.EncryptedBallot.BigInts()...)
 	inputHash, err := mimc7.Hash(hashInputs, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash inputs: %w", err)
+		return nil, fmt.Errorf("%w: failed to hash inputs: %w", ErrInvalidInputs, err)
 	}
 	// unpack census proof siblings to big integers
 	siblings, err := census.BigIntSiblings(b.CensusProof.Siblings)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unpack census proof siblings: %w", err)
+		return nil, fmt.Errorf("%w: failed to unpack census proof siblings: %w", ErrInvalidCensusProof, err)
 	}
 	// convert to emulated elements
 	emulatedSiblings := [circuits.CensusProofMaxLevels]emulated.Element[sw_bn254.ScalarField]{}
@@ -136,7 +155,7 @@ func (p *VoteProcessor) ProcessBallot(b *storage.Ballot) (*storage.VerifiedBallo
 	// decompress the public key
 	pubKey, err := ethcrypto.DecompressPubkey(b.PubKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decompress voter public key: %w", err)
+		return nil, fmt.Errorf("%w: failed to decompress voter public key: %w", ErrInvalidInputs, err)
 	}
 	// set the circuit assignment
 	assignment := voteverifier.VerifyVoteCircuit{
@@ -168,9 +187,11 @@ func (p *VoteProcessor) ProcessBallot(b *storage.Ballot) (*storage.VerifiedBallo
 		CircomProof: b.BallotProof,
 	}
 	// generate the final proof
+	proveStart := time.Now()
 	proof, err := assignment.Prove()
+	metrics.ObserveProving(metrics.CircuitVoteVerifier, proveStart)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate proof: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrProvingFailed, err)
 	}
 	return &storage.VerifiedBallot{
 		ProcessID:       b.ProcessID,
@@ -182,3 +203,24 @@ func (p *VoteProcessor) ProcessBallot(b *storage.Ballot) (*storage.VerifiedBallo
 		Proof:           proof,
 	}, nil
 }
+
+// rejectionReason returns the reason of the BallotsRejected metric for the
+// error returned by ProcessBallot.
+func rejectionReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidBallot):
+		return metrics.ReasonInvalidBallot
+	case errors.Is(err, ErrProcessNotFound):
+		return metrics.ReasonProcessNotFound
+	case errors.Is(err, ErrUnsupportedCensus):
+		return metrics.ReasonUnsupportedCensus
+	case errors.Is(err, ErrInvalidCensusProof):
+		return metrics.ReasonInvalidCensusProof
+	case errors.Is(err, ErrInvalidInputs):
+		return metrics.ReasonInvalidInputs
+	case errors.Is(err, ErrProvingFailed):
+		return metrics.ReasonProvingFailed
+	default:
+		return metrics.ReasonUnknown
+	}
+}
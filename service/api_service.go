@@ -4,19 +4,29 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/vocdoni/vocdoni-z-sandbox/api"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
 	"github.com/vocdoni/vocdoni-z-sandbox/storage"
 )
 
+// apiShutdownTimeout is the maximum time to wait for the requests in
+// progress when the API service is stopped.
+const apiShutdownTimeout = 10 * time.Second
+
 // APIService represents a service that manages the HTTP API server.
 type APIService struct {
-	storage *storage.Storage
-	api     *api.API
-	mu      sync.Mutex
-	cancel  context.CancelFunc
-	host    string
-	port    int
+	storage   *storage.Storage
+	api       *api.API
+	orgAdmins map[uint32]api.OrganizationAdmins
+	auth      api.Authenticator
+	// insecureNoAuth serves the administrative endpoints without
+	// authentication if no Authenticator is set
+	insecureNoAuth bool
+	mu             sync.Mutex
+	host           string
+	port           int
 }
 
 // NewAPIService creates a new APIService instance.
@@ -28,46 +38,92 @@ func NewAPI(storage *storage.Storage, host string, port int) *APIService {
 	}
 }
 
+// SetOrganizationAdmins sets the source of organization administrators used
+// to authorize the process setup requests of the chainID provided. Once a
+// source is set, the process setup requests of the chains without one are
+// rejected. It must be called before Start.
+func (as *APIService) SetOrganizationAdmins(chainID uint32, orgAdmins api.OrganizationAdmins) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.orgAdmins == nil {
+		as.orgAdmins = make(map[uint32]api.OrganizationAdmins)
+	}
+	as.orgAdmins[chainID] = orgAdmins
+}
+
+// SetAuthenticator sets the Authenticator used to authorize the
+// administrative requests. If none is set, they are rejected, unless
+// SetInsecureNoAuth is enabled. It must be called before Start.
+func (as *APIService) SetAuthenticator(auth api.Authenticator) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.auth = auth
+}
+
+// SetInsecureNoAuth sets whether the administrative requests are served
+// without authentication when no Authenticator is set. It must only be
+// enabled for development and testing, and called before Start.
+func (as *APIService) SetInsecureNoAuth(insecure bool) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.insecureNoAuth = insecure
+}
+
 // Start begins the API server. It returns an error if the service
 // is already running or if it fails to start.
 func (as *APIService) Start(ctx context.Context) error {
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
-	if as.cancel != nil {
+	if as.api != nil {
 		return fmt.Errorf("service already running")
 	}
 
-	_, as.cancel = context.WithCancel(ctx)
-
 	// Create API instance with existing storage
 	var err error
 	as.api, err = api.New(&api.APIConfig{
-		Host:    as.host,
-		Port:    as.port,
-		Storage: as.storage,
+		Host:               as.host,
+		Port:               as.port,
+		Storage:            as.storage,
+		OrganizationAdmins: as.orgAdmins,
+		Authenticator:      as.auth,
+		InsecureNoAuth:     as.insecureNoAuth,
 	})
 	if err != nil {
-		as.cancel = nil
+		as.api = nil
 		return fmt.Errorf("failed to start API server: %w", err)
 	}
 
 	return nil
 }
 
-// Stop halts the API server.
+// Stop gracefully halts the API server, waiting up to apiShutdownTimeout for
+// the requests in progress. The storage is not closed, since it is owned by
+// the caller, so the service can be started again.
 func (as *APIService) Stop() {
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
-	if as.cancel != nil {
-		as.cancel()
-		as.cancel = nil
+	if as.api == nil {
+		return
 	}
-	as.storage.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+	defer cancel()
+	if err := as.api.Shutdown(ctx); err != nil {
+		log.Warnw("API server shutdown timed out", "error", err.Error())
+	}
+	as.api = nil
 }
 
-// HostPort returns the host and port of the API server.
+// HostPort returns the host and port of the API server. If the service is
+// running, it returns the address where the server is listening, which
+// includes the port chosen if the configured port was zero.
 func (as *APIService) HostPort() (string, int) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if as.api != nil {
+		return as.api.HostPort()
+	}
 	return as.host, as.port
 }
@@ -2,11 +2,15 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net/http"
 	"testing"
-	"time"
 
 	qt "github.com/frankban/quicktest"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/vocdoni/arbo/memdb"
+	"github.com/vocdoni/vocdoni-z-sandbox/api"
 	"github.com/vocdoni/vocdoni-z-sandbox/storage"
 )
 
@@ -21,22 +25,129 @@ func TestAPIService(t *testing.T) {
 	// Create API service with a random available port
 	apiService := NewAPI(store, "127.0.0.1", 0) // Port 0 lets the OS choose an available port
 
-	// Start service in background
 	ctx := context.Background()
-
 	err := apiService.Start(ctx)
 	c.Assert(err, qt.IsNil)
 	defer apiService.Stop()
 
-	// Give the service time to start
-	time.Sleep(2 * time.Second)
+	// The bound port is reported and the server is ready
+	host, port := apiService.HostPort()
+	c.Assert(host, qt.Equals, "127.0.0.1")
+	c.Assert(port, qt.Not(qt.Equals), 0)
+	ping := func() error {
+		resp, err := http.Get(fmt.Sprintf("http://%s:%d%s", host, port, api.PingEndpoint))
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	c.Assert(ping(), qt.IsNil)
+
+	// Another server cannot listen on the same port
+	other := NewAPI(store, host, port)
+	c.Assert(other.Start(ctx), qt.ErrorMatches, "failed to start API server: .*")
 
-	// Test stopping and restarting
+	// Stopping releases the port and keeps the storage open
 	apiService.Stop()
+	c.Assert(ping(), qt.Not(qt.IsNil))
+	_, err = store.ProcessStats([]byte{1})
+	c.Assert(err, qt.IsNil)
+
+	// The service can be restarted on the same port
+	apiService = NewAPI(store, host, port)
 	err = apiService.Start(ctx)
 	c.Assert(err, qt.IsNil)
+	c.Assert(ping(), qt.IsNil)
 
 	// Test starting an already running service
 	err = apiService.Start(ctx)
 	c.Assert(err, qt.ErrorMatches, "service already running")
 }
+
+func TestAPIServiceAuth(t *testing.T) {
+	c := qt.New(t)
+
+	store := storage.New(memdb.New())
+	defer store.Close()
+
+	jwtKey := []byte("test key")
+	keyOfScope := map[api.Scope]string{
+		api.ScopeCensusWrite: "census-key",
+		api.ScopeOperator:    "operator-key",
+	}
+	keys := api.APIKeys{}
+	for scope, key := range keyOfScope {
+		keys[key] = []api.Scope{scope}
+	}
+	for name, auth := range map[string]api.Authenticator{
+		"apiKeys": keys,
+		"jwt":     &api.JWTAuthenticator{Key: jwtKey},
+	} {
+		c.Run(name, func(c *qt.C) {
+			apiService := NewAPI(store, "127.0.0.1", 0)
+			apiService.SetAuthenticator(auth)
+			c.Assert(apiService.Start(context.Background()), qt.IsNil)
+			defer apiService.Stop()
+			host, port := apiService.HostPort()
+
+			token := func(scope api.Scope) string {
+				if name == "jwt" {
+					t, err := api.NewJWT(jwtKey, jwt.RegisteredClaims{}, scope)
+					c.Assert(err, qt.IsNil)
+					return t
+				}
+				return keyOfScope[scope]
+			}
+			request := func(method, path, token string) (int, string) {
+				req, err := http.NewRequest(method, fmt.Sprintf("http://%s:%d%s", host, port, path), nil)
+				c.Assert(err, qt.IsNil)
+				if token != "" {
+					req.Header.Set(api.AuthorizationHeader, api.BearerScheme+" "+token)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				c.Assert(err, qt.IsNil)
+				defer func() { c.Assert(resp.Body.Close(), qt.IsNil) }()
+				body, err := io.ReadAll(resp.Body)
+				c.Assert(err, qt.IsNil)
+				return resp.StatusCode, string(body)
+			}
+
+			// the public endpoints are open
+			status, _ := request(http.MethodGet, api.PingEndpoint, "")
+			c.Assert(status, qt.Equals, http.StatusOK)
+			status, _ = request(http.MethodGet, api.ProcessesEndpoint, "")
+			c.Assert(status, qt.Equals, http.StatusOK)
+
+			// the administrative endpoints require credentials with the scope
+			status, body := request(http.MethodPost, api.NewCensusEndpoint, "")
+			c.Assert(status, qt.Equals, http.StatusUnauthorized)
+			c.Assert(body, qt.Contains, fmt.Sprint(api.ErrUnauthorized.Code))
+			status, _ = request(http.MethodPost, api.NewCensusEndpoint, "wrong")
+			c.Assert(status, qt.Equals, http.StatusUnauthorized)
+			status, _ = request(http.MethodGet, api.MetricsEndpoint, token(api.ScopeCensusWrite))
+			c.Assert(status, qt.Equals, http.StatusUnauthorized)
+			status, _ = request(http.MethodPost, api.NewCensusEndpoint, token(api.ScopeCensusWrite))
+			c.Assert(status, qt.Equals, http.StatusOK)
+
+			// the operator scope grants every scope
+			status, _ = request(http.MethodGet, api.MetricsEndpoint, token(api.ScopeOperator))
+			c.Assert(status, qt.Equals, http.StatusOK)
+			status, _ = request(http.MethodPost, api.NewCensusEndpoint, token(api.ScopeOperator))
+			c.Assert(status, qt.Equals, http.StatusOK)
+		})
+	}
+
+	// without authenticator the administrative endpoints are rejected,
+	// unless they are explicitly served without authentication
+	for insecure, want := range map[bool]int{false: http.StatusUnauthorized, true: http.StatusOK} {
+		apiService := NewAPI(store, "127.0.0.1", 0)
+		apiService.SetInsecureNoAuth(insecure)
+		c.Assert(apiService.Start(context.Background()), qt.IsNil)
+		host, port := apiService.HostPort()
+		resp, err := http.Post(fmt.Sprintf("http://%s:%d%s", host, port, api.NewCensusEndpoint), "application/json", nil)
+		c.Assert(err, qt.IsNil)
+		c.Assert(resp.Body.Close(), qt.IsNil)
+		c.Assert(resp.StatusCode, qt.Equals, want, qt.Commentf("insecure %v", insecure))
+		apiService.Stop()
+	}
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+const (
+	// censusFetchTimeout is the maximum time to fetch a census dump.
+	censusFetchTimeout = 2 * time.Minute
+	// maxCensusDumpSize is the maximum size in bytes of a census dump.
+	maxCensusDumpSize = 1 << 30 // 1 GiB
+)
+
+// bootstrapCensus imports the census of the process provided from its census
+// URI if the census root is unknown. The census is published once imported
+// and its root is retained on behalf of the process. It does nothing if the
+// process has no census URI or the root is already known. The token holder
+// censuses are built from the chain instead, see bootstrapTokenCensus.
+func (pm *ProcessMonitor) bootstrapCensus(ctx context.Context, proc *types.Process) error {
+	if proc.Census != nil && proc.Census.CensusOrigin == types.CensusOriginERC20 {
+		return pm.bootstrapTokenCensus(ctx, proc)
+	}
+	if proc.Census == nil || len(proc.Census.CensusRoot) == 0 || proc.Census.CensusURI == "" {
+		return nil
+	}
+	// serialize the imports, so the processes that share a census import it
+	// once
+	pm.censusMu.Lock()
+	defer pm.censusMu.Unlock()
+
+	censusDB := pm.storage.CensusDB()
+	root := proc.Census.CensusRoot
+	if !censusDB.KnownRoot(root) {
+		dump, err := fetchCensusDump(ctx, &pm.censusFetch, proc.Census.CensusURI)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(dump.Root, root) {
+			return fmt.Errorf("%w: expected %x, got %x", census.ErrCensusRootMismatch, root, dump.Root)
+		}
+		if !census.ProvableHashType(dump.HashType) {
+			return fmt.Errorf("%w: %s", census.ErrHashTypeNotProvable, dump.HashType)
+		}
+		ref, err := censusDB.Import(uuid.New(), dump)
+		if err != nil {
+			return fmt.Errorf("could not import census: %w", err)
+		}
+		if _, err := censusDB.Publish(ref.ID); err != nil {
+			return fmt.Errorf("could not publish imported census: %w", err)
+		}
+		log.Infow("census imported from process census URI", "processID", proc.ID.String(),
+			"root", proc.Census.CensusRoot.String(), "uri", proc.Census.CensusURI)
+	}
+	if _, err := censusDB.RetainRoot(root, proc.ID); err != nil {
+		return fmt.Errorf("could not retain census root: %w", err)
+	}
+	return nil
+}
+
+// CensusFetchConfig restricts the census URIs that the census dumps of the
+// processes are fetched from. The URIs are set on chain by anyone who
+// creates a process, so by default only the HTTPS URIs of hosts with public
+// addresses are fetched.
+type CensusFetchConfig struct {
+	// AllowFile allows the file:// census URIs, read from the local
+	// filesystem of the sequencer.
+	AllowFile bool
+	// AllowHTTP allows the plain http:// census URIs.
+	AllowHTTP bool
+	// AllowedHosts restricts the hosts that the census dumps are fetched
+	// from. If empty, any host with a public address is allowed. The hosts
+	// listed are trusted, so they are allowed even if their address is
+	// private.
+	AllowedHosts []string
+}
+
+// ErrCensusURINotAllowed is returned when the census URI of a process is
+// not allowed by the CensusFetchConfig of the ProcessMonitor.
+var ErrCensusURINotAllowed = fmt.Errorf("census URI not allowed")
+
+// checkURI returns ErrCensusURINotAllowed if the census dumps cannot be
+// fetched from the URI provided.
+func (cfg *CensusFetchConfig) checkURI(u *url.URL) error {
+	switch u.Scheme {
+	case "file":
+		if !cfg.AllowFile {
+			return fmt.Errorf("%w: file URIs are disabled", ErrCensusURINotAllowed)
+		}
+		return nil
+	case "https":
+	case "http":
+		if !cfg.AllowHTTP {
+			return fmt.Errorf("%w: plain HTTP URIs are disabled", ErrCensusURINotAllowed)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported scheme %q", ErrCensusURINotAllowed, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: no host", ErrCensusURINotAllowed)
+	}
+	if len(cfg.AllowedHosts) > 0 && !slices.Contains(cfg.AllowedHosts, u.Hostname()) {
+		return fmt.Errorf("%w: host %q is not allowed", ErrCensusURINotAllowed, u.Hostname())
+	}
+	return nil
+}
+
+// httpClient returns the HTTP client used to fetch the census dumps, which
+// checks the URI of every redirect. If no hosts are listed, it only dials the
+// public addresses, so the census URIs cannot reach the internal services of
+// the sequencer network.
+func (cfg *CensusFetchConfig) httpClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if len(cfg.AllowedHosts) == 0 {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip, err := netip.ParseAddr(host); err != nil || !isPublicAddr(ip) {
+				return fmt.Errorf("%w: address %s is not public", ErrCensusURINotAllowed, host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would dial the hosts on behalf of the client, skipping the
+	// address check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("too many redirects")
+			}
+			return cfg.checkURI(req.URL)
+		},
+	}
+}
+
+// specialPurposePrefixes are the special-purpose address blocks of the IANA
+// registries that are not reachable on the public internet, or that might
+// reach the network of the sequencer, such as the shared address space of the
+// carrier-grade NATs or the IPv4/IPv6 translation prefixes.
+var specialPurposePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // this network
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link local
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved and broadcast
+	netip.MustParsePrefix("::/127"),          // unspecified and loopback
+	netip.MustParsePrefix("64:ff9b::/96"),    // IPv4/IPv6 translation
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local IPv4/IPv6 translation
+	netip.MustParsePrefix("100::/64"),        // discard only
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+	netip.MustParsePrefix("3fff::/20"),       // documentation
+	netip.MustParsePrefix("5f00::/16"),       // segment routing
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+	netip.MustParsePrefix("fe80::/10"),       // link local
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+}
+
+// isPublicAddr returns true if the address provided is a global unicast
+// address that does not belong to any special-purpose block. The IPv4-mapped
+// IPv6 addresses are checked as IPv4 addresses.
+func isPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range specialPurposePrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchCensusDump reads the census dump from the URI provided, which can be
+// a file:// or an http(s):// URI allowed by the configuration provided.
+func fetchCensusDump(ctx context.Context, cfg *CensusFetchConfig, uri string) (*census.CensusDump, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid census URI: %w", err)
+	}
+	if err := cfg.checkURI(u); err != nil {
+		return nil, err
+	}
+	var r io.ReadCloser
+	switch u.Scheme {
+	case "file":
+		if r, err = os.Open(u.Path); err != nil {
+			return nil, fmt.Errorf("could not open census file: %w", err)
+		}
+	default:
+		ctx, cancel := context.WithTimeout(ctx, censusFetchTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := cfg.httpClient().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch census: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("could not fetch census: unexpected status %d", resp.StatusCode)
+		}
+		r = resp.Body
+	}
+	defer r.Close()
+	dump := &census.CensusDump{}
+	if err := json.NewDecoder(io.LimitReader(r, maxCensusDumpSize)).Decode(dump); err != nil {
+		return nil, fmt.Errorf("%w: %v", census.ErrInvalidCensusDump, err)
+	}
+	return dump, nil
+}
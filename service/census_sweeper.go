@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
+)
+
+// DefaultCensusSweepConfig is the census garbage collection configuration
+// used by the sequencer unless another one is provided.
+var DefaultCensusSweepConfig = census.SweepConfig{
+	Interval:    10 * time.Minute,
+	IdleTimeout: 30 * time.Minute,
+	Retention:   7 * 24 * time.Hour,
+}
+
+// CensusSweeperService represents a service that periodically unloads the
+// idle censuses from memory and deletes the abandoned ones. The report of
+// the last sweep is exposed by the census metrics of the storage.
+type CensusSweeperService struct {
+	storage *storage.Storage
+	conf    census.SweepConfig
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	// wg tracks the sweeping goroutine, so Stop returns once it is done with
+	// the storage.
+	wg sync.WaitGroup
+}
+
+// NewCensusSweeper creates a new CensusSweeperService for the censuses of
+// the storage provided, with the configuration provided.
+func NewCensusSweeper(stg *storage.Storage, conf census.SweepConfig) *CensusSweeperService {
+	return &CensusSweeperService{
+		storage: stg,
+		conf:    conf,
+	}
+}
+
+// Start begins the census garbage collection. It returns an error if the
+// service is already running or the configuration is invalid.
+func (css *CensusSweeperService) Start(ctx context.Context) error {
+	css.mu.Lock()
+	defer css.mu.Unlock()
+
+	if css.cancel != nil {
+		return fmt.Errorf("census sweeper service already running")
+	}
+	if css.conf.Interval <= 0 {
+		return fmt.Errorf("invalid census sweep interval %s", css.conf.Interval)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	css.cancel = cancel
+	css.wg.Add(1)
+	go css.sweep(ctx)
+	return nil
+}
+
+// Stop halts the census garbage collection and waits for the sweep in
+// progress, if any.
+func (css *CensusSweeperService) Stop() {
+	css.mu.Lock()
+	defer css.mu.Unlock()
+
+	if css.cancel != nil {
+		css.cancel()
+		css.cancel = nil
+	}
+	css.wg.Wait()
+}
+
+// sweep sweeps the censuses every interval until the context is done.
+func (css *CensusSweeperService) sweep(ctx context.Context) {
+	defer css.wg.Done()
+	ticker := time.NewTicker(css.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := css.storage.SweepCensuses(css.conf); err != nil {
+				log.Warnw("census sweep failed", "error", err.Error())
+			}
+		}
+	}
+}
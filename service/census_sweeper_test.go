@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/google/uuid"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
+	"go.vocdoni.io/dvote/db/metadb"
+)
+
+func TestCensusSweeperService(t *testing.T) {
+	c := qt.New(t)
+
+	stg := storage.New(metadb.NewTest(t))
+	ref, err := stg.CensusDB().New(uuid.New())
+	c.Assert(err, qt.IsNil)
+
+	sweeper := NewCensusSweeper(stg, census.SweepConfig{
+		Interval:    50 * time.Millisecond,
+		IdleTimeout: time.Nanosecond,
+		Retention:   time.Nanosecond,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c.Assert(sweeper.Start(ctx), qt.IsNil)
+	defer sweeper.Stop()
+	c.Assert(sweeper.Start(ctx), qt.IsNotNil)
+
+	// the abandoned census is unloaded and then deleted
+	for stg.CensusDB().Exists(ref.ID) {
+		select {
+		case <-ctx.Done():
+			c.Fatal("timeout waiting for the census to be swept")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	c.Assert(stg.CensusDB().LastSweepReport(), qt.Not(qt.IsNil))
+
+	// an invalid interval is rejected
+	c.Assert(NewCensusSweeper(stg, census.SweepConfig{}).Start(ctx), qt.IsNotNil)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -12,14 +13,23 @@ import (
 // MockContracts implements a mock version of web3.Contracts for testing
 type MockContracts struct {
 	processes []*types.Process
+	changes   []*types.ProcessChange
+	created   map[string]*types.Process
+	nonce     uint64
 	chainID   uint64
 	mu        sync.Mutex
 }
 
 func NewMockContracts() *MockContracts {
+	return NewMockChainContracts(1)
+}
+
+// NewMockChainContracts creates a new MockContracts for the chainID provided.
+func NewMockChainContracts(chainID uint64) *MockContracts {
 	return &MockContracts{
 		processes: make([]*types.Process, 0),
-		chainID:   1,
+		created:   make(map[string]*types.Process),
+		chainID:   chainID,
 	}
 }
 
@@ -36,7 +46,14 @@ func (m *MockContracts) MonitorProcessCreation(ctx context.Context, interval tim
 			case <-ticker.C:
 				m.mu.Lock()
 				for _, proc := range m.processes {
-					ch <- proc
+					// send a copy, as a real chain does, since the
+					// created process keeps being modified
+					sent := *proc
+					if proc.Census != nil {
+						census := *proc.Census
+						sent.Census = &census
+					}
+					ch <- &sent
 				}
 				m.processes = nil // Clear after sending
 				m.mu.Unlock()
@@ -46,21 +63,174 @@ func (m *MockContracts) MonitorProcessCreation(ctx context.Context, interval tim
 	return ch, nil
 }
 
+// MonitorProcessChanges sends the changes of the created processes made
+// since the previous tick.
+func (m *MockContracts) MonitorProcessChanges(ctx context.Context, interval time.Duration) (<-chan *types.ProcessChange, error) {
+	ch := make(chan *types.ProcessChange)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.mu.Lock()
+				changes := m.changes
+				m.changes = nil
+				m.mu.Unlock()
+				for _, change := range changes {
+					select {
+					case ch <- change:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Process returns a copy of the created process with the given ID.
+func (m *MockContracts) Process(processID []byte) (*types.Process, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	process, ok := m.created[new(types.ProcessID).SetBytes(processID).String()]
+	if !ok {
+		return nil, fmt.Errorf("process not found")
+	}
+	p := *process
+	if process.Census != nil {
+		census := *process.Census
+		p.Census = &census
+	}
+	return &p, nil
+}
+
 func (m *MockContracts) CreateProcess(process *types.Process) (*types.ProcessID, *common.Hash, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	pid := types.ProcessID{
 		Address: process.OrganizationId,
-		Nonce:   uint64(len(m.processes)),
+		Nonce:   m.nonce,
 		ChainID: uint32(m.chainID),
 	}
+	m.nonce++
 	process.ID = pid.Marshal()
 	m.processes = append(m.processes, process)
+	m.created[pid.String()] = process
 	hash := common.HexToHash("0x1234567890")
 	return &pid, &hash, nil
 }
 
+func (m *MockContracts) SetProcessStatus(processID []byte, status uint8) (*common.Hash, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	process, err := m.ongoingProcess(processID)
+	if err != nil {
+		return nil, err
+	}
+	if process.Status == status {
+		return nil, fmt.Errorf("status must differ")
+	}
+	process.Status = status
+	m.changes = append(m.changes, &types.ProcessChange{ProcessID: processID, Status: &status})
+	hash := common.HexToHash("0x1234567891")
+	return &hash, nil
+}
+
+// SetProcessCensus replaces the census of the process with the given ID. As
+// the ProcessRegistry contract does, the max votes are only updated if they
+// increase.
+func (m *MockContracts) SetProcessCensus(processID []byte, census *types.Census) (*common.Hash, error) {
+	if census == nil {
+		return nil, fmt.Errorf("nil census")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	process, err := m.ongoingProcess(processID)
+	if err != nil {
+		return nil, err
+	}
+	updated := *census
+	if process.Census != nil && process.Census.MaxVotes != nil && (updated.MaxVotes == nil ||
+		updated.MaxVotes.MathBigInt().Cmp(process.Census.MaxVotes.MathBigInt()) < 0) {
+		updated.MaxVotes = process.Census.MaxVotes
+	}
+	process.Census = &updated
+	hash := common.HexToHash("0x1234567892")
+	return &hash, nil
+}
+
+func (m *MockContracts) EndProcess(processID []byte) (*common.Hash, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	process, err := m.ongoingProcess(processID)
+	if err != nil {
+		return nil, err
+	}
+	status := types.ProcessStatusEnded
+	process.Status = status
+	m.changes = append(m.changes, &types.ProcessChange{ProcessID: processID, Status: &status})
+	hash := common.HexToHash("0x1234567893")
+	return &hash, nil
+}
+
+// SetProcessStateRoot sets the state root of the process with the given ID,
+// as the state transitions submitted to the ProcessRegistry contract do.
+func (m *MockContracts) SetProcessStateRoot(processID []byte, stateRoot types.HexBytes) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	process, err := m.ongoingProcess(processID)
+	if err != nil {
+		return err
+	}
+	process.StateRoot = stateRoot
+	m.changes = append(m.changes, &types.ProcessChange{ProcessID: processID, StateRoot: stateRoot})
+	return nil
+}
+
+// SetProcessResults sets the results of the process with the given ID and
+// its status to ProcessStatusResults, as the ProcessRegistry contract does.
+func (m *MockContracts) SetProcessResults(processID []byte, results []*types.BigInt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	process, ok := m.created[new(types.ProcessID).SetBytes(processID).String()]
+	if !ok {
+		return fmt.Errorf("process not found")
+	}
+	if process.Status == types.ProcessStatusResults || process.Status == types.ProcessStatusCanceled {
+		return fmt.Errorf("process results cannot be set")
+	}
+	status := types.ProcessStatusResults
+	process.Status = status
+	process.Result = results
+	m.changes = append(m.changes, &types.ProcessChange{ProcessID: processID, Status: &status})
+	return nil
+}
+
+// ongoingProcess returns the created process with the given ID if it is ready
+// or paused, as the ProcessRegistry contract requires to update it.
+func (m *MockContracts) ongoingProcess(processID []byte) (*types.Process, error) {
+	process, ok := m.created[new(types.ProcessID).SetBytes(processID).String()]
+	if !ok {
+		return nil, fmt.Errorf("process not found")
+	}
+	if process.Status != types.ProcessStatusReady && process.Status != types.ProcessStatusPaused {
+		return nil, fmt.Errorf("process terminated")
+	}
+	return process, nil
+}
+
 func (m *MockContracts) AccountAddress() common.Address {
 	return common.HexToAddress("0x1234567890123456789012345678901234567890")
 }
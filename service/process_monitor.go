@@ -2,50 +2,123 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/vocdoni/arbo/memdb"
+	"github.com/vocdoni/vocdoni-z-sandbox/circuits/voteverifier"
 	"github.com/vocdoni/vocdoni-z-sandbox/log"
 	"github.com/vocdoni/vocdoni-z-sandbox/storage"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 )
 
 // ProcessMonitor represents a service that monitors new voting processes
-// and stores them in the storage queue.
+// and stores them in the storage queue. It can follow several chains at once,
+// each one with its own ContractsService, and routes the operations over a
+// process to the chain encoded in its process ID.
 type ProcessMonitor struct {
-	contracts ContractsService
-	storage   *storage.Storage
-	interval  time.Duration
-	mu        sync.Mutex
-	cancel    context.CancelFunc
+	// chains maps the chainID to the ContractsService of that chain.
+	chains map[uint32]ContractsService
+	// defaultChain is used for any chainID when the monitor is created for a
+	// single chain.
+	defaultChain ContractsService
+	storage      *storage.Storage
+	interval     time.Duration
+	mu           sync.Mutex
+	cancel       context.CancelFunc
+	// wg tracks the monitoring and census bootstrap goroutines, so Stop
+	// returns once they are done with the storage.
+	wg sync.WaitGroup
+	// censusMu serializes the imports of the process censuses.
+	censusMu sync.Mutex
+	// censusFetch restricts the census URIs of the processes.
+	censusFetch CensusFetchConfig
 }
 
 // ContractsService defines the interface for web3 contract operations.
 type ContractsService interface {
 	MonitorProcessCreation(ctx context.Context, interval time.Duration) (<-chan *types.Process, error)
+	MonitorProcessChanges(ctx context.Context, interval time.Duration) (<-chan *types.ProcessChange, error)
+	Process(processID []byte) (*types.Process, error)
 	CreateProcess(process *types.Process) (*types.ProcessID, *common.Hash, error)
+	SetProcessStatus(processID []byte, status uint8) (*common.Hash, error)
+	SetProcessCensus(processID []byte, census *types.Census) (*common.Hash, error)
+	EndProcess(processID []byte) (*common.Hash, error)
 	AccountAddress() common.Address
 	WaitTx(hash common.Hash, timeout time.Duration) error
 }
 
-// NewProcessMonitor creates a new ProcessMonitor service. If storage is nil, it uses a memory storage.
+// processTxTimeout is the time to wait for the process management
+// transactions to be mined.
+const processTxTimeout = 2 * time.Minute
+
+// ErrUnknownChain is returned when a process belongs to a chain that is not
+// followed by the ProcessMonitor.
+var ErrUnknownChain = fmt.Errorf("unknown chain")
+
+// NewProcessMonitor creates a new ProcessMonitor service for a single chain.
+// Every process is routed to the contracts provided. If storage is nil, it
+// uses a memory storage.
 func NewProcessMonitor(contracts ContractsService, stg *storage.Storage, interval time.Duration) *ProcessMonitor {
+	pm := NewMultiChainProcessMonitor(nil, stg, interval)
+	pm.defaultChain = contracts
+	return pm
+}
+
+// NewMultiChainProcessMonitor creates a new ProcessMonitor service that
+// follows every chain provided, where the key is the chainID and the value
+// the ContractsService of the chain. If storage is nil, it uses a memory
+// storage.
+func NewMultiChainProcessMonitor(chains map[uint32]ContractsService, stg *storage.Storage, interval time.Duration) *ProcessMonitor {
 	if stg == nil {
 		kv := memdb.New()
 		stg = storage.New(kv)
 	}
-	return &ProcessMonitor{
-		contracts: contracts,
-		storage:   stg,
-		interval:  interval,
+	pm := &ProcessMonitor{
+		chains:   make(map[uint32]ContractsService, len(chains)),
+		storage:  stg,
+		interval: interval,
 	}
+	for chainID, contracts := range chains {
+		pm.chains[chainID] = contracts
+	}
+	return pm
+}
+
+// Contracts returns the ContractsService of the chain of the process ID
+// provided. It returns ErrUnknownChain if the chain is not followed.
+func (pm *ProcessMonitor) Contracts(pid *types.ProcessID) (ContractsService, error) {
+	return pm.chainContracts(pid.ChainID)
+}
+
+// chainContracts returns the ContractsService of the chainID provided. It
+// returns ErrUnknownChain if the chain is not followed.
+func (pm *ProcessMonitor) chainContracts(chainID uint32) (ContractsService, error) {
+	if contracts, ok := pm.chains[chainID]; ok {
+		return contracts, nil
+	}
+	if pm.defaultChain != nil {
+		return pm.defaultChain, nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrUnknownChain, chainID)
+}
+
+// SetCensusFetchConfig sets the restrictions of the census URIs that the
+// census dumps of the processes are fetched from. By default, only the HTTPS
+// URIs of hosts with public addresses are allowed. It must be called before
+// Start.
+func (pm *ProcessMonitor) SetCensusFetchConfig(cfg CensusFetchConfig) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.censusFetch = cfg
 }
 
-// Start begins monitoring for new processes. It returns an error if the service
-// is already running or if it fails to start monitoring.
+// Start begins monitoring for new processes on every chain. It returns an
+// error if the service is already running or if it fails to start monitoring
+// any of the chains.
 func (pm *ProcessMonitor) Start(ctx context.Context) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -57,17 +130,37 @@ func (pm *ProcessMonitor) Start(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	pm.cancel = cancel
 
-	newProcChan, err := pm.contracts.MonitorProcessCreation(ctx, pm.interval)
-	if err != nil {
-		pm.cancel = nil
-		return fmt.Errorf("failed to start process monitoring: %w", err)
+	chains := make(map[uint32]ContractsService, len(pm.chains)+1)
+	if pm.defaultChain != nil {
+		chains[0] = pm.defaultChain
 	}
-
-	go pm.monitorProcesses(ctx, newProcChan)
+	for chainID, contracts := range pm.chains {
+		chains[chainID] = contracts
+	}
+	for chainID, contracts := range chains {
+		newProcChan, err := contracts.MonitorProcessCreation(ctx, pm.interval)
+		if err != nil {
+			pm.cancel()
+			pm.cancel = nil
+			return fmt.Errorf("failed to start process monitoring on chain %d: %w", chainID, err)
+		}
+		changesChan, err := contracts.MonitorProcessChanges(ctx, pm.interval)
+		if err != nil {
+			pm.cancel()
+			pm.cancel = nil
+			return fmt.Errorf("failed to start process changes monitoring on chain %d: %w", chainID, err)
+		}
+		pm.wg.Add(2)
+		go pm.monitorProcesses(ctx, chainID, newProcChan)
+		go pm.monitorProcessChanges(ctx, chainID, contracts, changesChan)
+	}
+	pm.wg.Add(1)
+	go pm.monitorExpiredProcesses(ctx)
 	return nil
 }
 
-// Stop halts the monitoring service.
+// Stop halts the monitoring service and waits for its background work to
+// finish.
 func (pm *ProcessMonitor) Stop() {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -76,23 +169,263 @@ func (pm *ProcessMonitor) Stop() {
 		pm.cancel()
 		pm.cancel = nil
 	}
+	pm.wg.Wait()
 }
 
-func (pm *ProcessMonitor) monitorProcesses(ctx context.Context, newProcChan <-chan *types.Process) {
+// monitorProcesses stores the new processes received from the channel
+// provided. If chainID is not zero, the processes whose ID does not belong to
+// that chain are discarded.
+func (pm *ProcessMonitor) monitorProcesses(ctx context.Context, chainID uint32, newProcChan <-chan *types.Process) {
+	defer pm.wg.Done()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case proc := <-newProcChan:
-			if _, err := pm.storage.Process(new(types.ProcessID).SetBytes(proc.ID)); err == nil {
+		case proc, ok := <-newProcChan:
+			if !ok {
+				return
+			}
+			pid := new(types.ProcessID).SetBytes(proc.ID)
+			if chainID != 0 && pid.ChainID != chainID {
+				log.Warnw("process from unexpected chain", "processID", proc.ID.String(),
+					"chainID", chainID, "processChainID", pid.ChainID)
+				continue
+			}
+			if proc.Census == nil {
+				log.Warnw("process without census", "processID", proc.ID.String())
+				continue
+			}
+			if err := voteverifier.CheckCensusOrigin(proc.Census.CensusOrigin); err != nil {
+				// its ballots could not be proven, so it is not stored
+				log.Warnw("unsupported process census", "processID", proc.ID.String(), "error", err.Error())
+				continue
+			}
+			if _, err := pm.storage.Process(pid); err == nil {
 				// Process already exists
 				log.Warnw("process already exists", "processID", proc.ID.String())
 				continue
 			}
-			log.Debugw("new process found", "processID", proc.ID.String())
+			log.Debugw("new process found", "processID", proc.ID.String(), "chainID", pid.ChainID)
 			if err := pm.storage.SetProcess(proc); err != nil {
 				log.Warnw("failed to store process", "processID", proc.ID.String(), "error", err.Error())
+				continue
+			}
+			// the census might be fetched from a remote source, so it is
+			// imported in the background
+			pm.wg.Add(1)
+			go func(proc *types.Process) {
+				defer pm.wg.Done()
+				if err := pm.bootstrapCensus(ctx, proc); err != nil {
+					log.Warnw("failed to bootstrap process census", "processID", proc.ID.String(),
+						"censusURI", proc.Census.CensusURI, "error", err.Error())
+				}
+			}(proc)
+		}
+	}
+}
+
+// monitorProcessChanges applies to the stored processes the changes received
+// from the channel provided, so their events are published. If chainID is not
+// zero, the changes of processes that do not belong to that chain are
+// discarded. The results of the processes are read from the contracts
+// provided once their status changes to ProcessStatusResults.
+func (pm *ProcessMonitor) monitorProcessChanges(ctx context.Context, chainID uint32, contracts ContractsService, changesChan <-chan *types.ProcessChange) {
+	defer pm.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change, ok := <-changesChan:
+			if !ok {
+				return
 			}
+			pid := new(types.ProcessID).SetBytes(change.ProcessID)
+			if chainID != 0 && pid.ChainID != chainID {
+				continue
+			}
+			if err := pm.applyProcessChange(contracts, pid, change); err != nil {
+				if !errors.Is(err, storage.ErrNotFound) {
+					log.Warnw("failed to apply process change", "processID", pid.String(), "error", err.Error())
+				}
+				continue
+			}
+			log.Debugw("process change applied", "processID", pid.String())
 		}
 	}
 }
+
+// applyProcessChange applies the change provided to the stored process with
+// the given ID.
+func (pm *ProcessMonitor) applyProcessChange(contracts ContractsService, pid *types.ProcessID, change *types.ProcessChange) error {
+	var results []*types.BigInt
+	if change.Status != nil && *change.Status == types.ProcessStatusResults {
+		process, err := contracts.Process(pid.Marshal())
+		if err != nil {
+			return fmt.Errorf("failed to get process results: %w", err)
+		}
+		results = process.Result
+	}
+	return pm.storage.UpdateProcess(pid, func(p *types.Process) error {
+		if change.Status != nil {
+			p.Status = *change.Status
+		}
+		if len(results) > 0 {
+			p.Result = results
+		}
+		if change.StateRoot != nil {
+			p.StateRoot = change.StateRoot
+		}
+		if change.Duration != nil {
+			p.Duration = *change.Duration
+		}
+		return nil
+	})
+}
+
+// monitorExpiredProcesses ends every interval the stored processes whose
+// duration is over, since the contract does not report it.
+func (pm *ProcessMonitor) monitorExpiredProcesses(ctx context.Context) {
+	defer pm.wg.Done()
+	ticker := time.NewTicker(pm.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := pm.endExpiredProcesses(time.Now()); err != nil {
+				log.Warnw("failed to end expired processes", "error", err.Error())
+			}
+		}
+	}
+}
+
+// endExpiredProcesses sets the status of the ongoing stored processes whose
+// duration is over at the time provided to ProcessStatusEnded.
+func (pm *ProcessMonitor) endExpiredProcesses(now time.Time) error {
+	pids, err := pm.storage.ListProcesses()
+	if err != nil {
+		return err
+	}
+	expired := func(p *types.Process) bool {
+		ongoing := p.Status == types.ProcessStatusReady || p.Status == types.ProcessStatusPaused
+		return ongoing && p.Duration > 0 && !now.Before(p.StartTime.Add(p.Duration))
+	}
+	for _, pidBytes := range pids {
+		pid := new(types.ProcessID).SetBytes(pidBytes)
+		p, err := pm.storage.Process(pid)
+		if err != nil || !expired(p) {
+			continue
+		}
+		if err := pm.storage.UpdateProcess(pid, func(p *types.Process) error {
+			if !expired(p) {
+				return errProcessNotExpired
+			}
+			p.Status = types.ProcessStatusEnded
+			return nil
+		}); err != nil {
+			if !errors.Is(err, errProcessNotExpired) {
+				log.Warnw("failed to end expired process", "processID", pid.String(), "error", err.Error())
+			}
+			continue
+		}
+		log.Debugw("process expired", "processID", pid.String())
+	}
+	return nil
+}
+
+// errProcessNotExpired is returned by the update of an expired process if it
+// changed since it was listed.
+var errProcessNotExpired = errors.New("process not expired")
+
+// EndProcess ends the process with the given ID before its duration is over.
+// It waits for the transaction to be mined and then updates the local copy of
+// the process.
+func (pm *ProcessMonitor) EndProcess(pid *types.ProcessID) error {
+	contracts, err := pm.Contracts(pid)
+	if err != nil {
+		return err
+	}
+	hash, err := contracts.EndProcess(pid.Marshal())
+	if err != nil {
+		return err
+	}
+	return pm.waitAndUpdate(contracts, pid, *hash, func(p *types.Process) error {
+		p.Status = types.ProcessStatusEnded
+		return nil
+	})
+}
+
+// CancelProcess cancels the process with the given ID.
+func (pm *ProcessMonitor) CancelProcess(pid *types.ProcessID) error {
+	return pm.SetProcessStatus(pid, types.ProcessStatusCanceled)
+}
+
+// PauseProcess pauses the process with the given ID.
+func (pm *ProcessMonitor) PauseProcess(pid *types.ProcessID) error {
+	return pm.SetProcessStatus(pid, types.ProcessStatusPaused)
+}
+
+// ResumeProcess resumes the paused process with the given ID.
+func (pm *ProcessMonitor) ResumeProcess(pid *types.ProcessID) error {
+	return pm.SetProcessStatus(pid, types.ProcessStatusReady)
+}
+
+// SetProcessStatus sets the status of the process with the given ID. It waits
+// for the transaction to be mined and then updates the local copy of the
+// process.
+func (pm *ProcessMonitor) SetProcessStatus(pid *types.ProcessID, status uint8) error {
+	contracts, err := pm.Contracts(pid)
+	if err != nil {
+		return err
+	}
+	hash, err := contracts.SetProcessStatus(pid.Marshal(), status)
+	if err != nil {
+		return err
+	}
+	return pm.waitAndUpdate(contracts, pid, *hash, func(p *types.Process) error {
+		p.Status = status
+		return nil
+	})
+}
+
+// UpdateProcessCensus updates the census of the process with the given ID. It
+// waits for the transaction to be mined and then updates the local copy of
+// the process. As the contract does, the max votes are only updated if they
+// increase.
+func (pm *ProcessMonitor) UpdateProcessCensus(pid *types.ProcessID, census *types.Census) error {
+	contracts, err := pm.Contracts(pid)
+	if err != nil {
+		return err
+	}
+	hash, err := contracts.SetProcessCensus(pid.Marshal(), census)
+	if err != nil {
+		return err
+	}
+	return pm.waitAndUpdate(contracts, pid, *hash, func(p *types.Process) error {
+		if p.Census == nil {
+			p.Census = &types.Census{}
+		}
+		p.Census.CensusRoot = census.CensusRoot
+		p.Census.CensusURI = census.CensusURI
+		if census.MaxVotes != nil && (p.Census.MaxVotes == nil ||
+			p.Census.MaxVotes.MathBigInt().Cmp(census.MaxVotes.MathBigInt()) < 0) {
+			p.Census.MaxVotes = census.MaxVotes
+		}
+		return nil
+	})
+}
+
+// waitAndUpdate waits for the transaction provided to be mined by the chain
+// of the contracts provided and then applies the update function to the local
+// copy of the process.
+func (pm *ProcessMonitor) waitAndUpdate(contracts ContractsService, pid *types.ProcessID, hash common.Hash, updateFn func(*types.Process) error) error {
+	if err := contracts.WaitTx(hash, processTxTimeout); err != nil {
+		return fmt.Errorf("failed to wait for transaction %s: %w", hash.Hex(), err)
+	}
+	if err := pm.storage.UpdateProcess(pid, updateFn); err != nil {
+		return fmt.Errorf("failed to update local process %s: %w", pid.String(), err)
+	}
+	log.Debugw("process updated", "processID", pid.String(), "tx", hash.Hex())
+	return nil
+}
@@ -1,14 +1,30 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	qt "github.com/frankban/quicktest"
+	"github.com/google/uuid"
+	"github.com/vocdoni/arbo"
+	"github.com/vocdoni/vocdoni-z-sandbox/events"
 	"github.com/vocdoni/vocdoni-z-sandbox/storage"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
+	"github.com/vocdoni/vocdoni-z-sandbox/web3/simulated"
 	"go.vocdoni.io/dvote/db"
 	"go.vocdoni.io/dvote/db/metadb"
 )
@@ -79,3 +95,600 @@ func TestProcessMonitor(t *testing.T) {
 	c.Assert(proc, qt.Not(qt.IsNil))
 	c.Assert(proc.MetadataURI, qt.Equals, "https://example.com/metadata")
 }
+
+func TestProcessMonitorManagement(t *testing.T) {
+	c := qt.New(t)
+
+	store := storage.New(metadb.NewTest(t))
+	contracts := NewMockContracts()
+	monitor := NewProcessMonitor(contracts, store, 100*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	c.Assert(monitor.Start(ctx), qt.IsNil)
+	defer monitor.Stop()
+
+	pid, _, err := contracts.CreateProcess(&types.Process{
+		OrganizationId: contracts.AccountAddress(),
+		StartTime:      time.Now(),
+		Duration:       time.Hour,
+		Census: &types.Census{
+			CensusRoot: make([]byte, 32),
+			MaxVotes:   new(types.BigInt).SetUint64(100),
+			CensusURI:  "https://example.com/census",
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	// wait for the monitor to store the process
+	for {
+		if _, err := store.Process(pid); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			c.Fatal("timeout waiting for process to be stored")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	c.Assert(monitor.PauseProcess(pid), qt.IsNil)
+	proc, err := store.Process(pid)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proc.Status, qt.Equals, types.ProcessStatusPaused)
+
+	newRoot := []byte{0x01, 0x02, 0x03}
+	c.Assert(monitor.UpdateProcessCensus(pid, &types.Census{
+		CensusRoot: newRoot,
+		MaxVotes:   new(types.BigInt).SetUint64(50),
+		CensusURI:  "https://example.com/census2",
+	}), qt.IsNil)
+	proc, err = store.Process(pid)
+	c.Assert(err, qt.IsNil)
+	c.Assert([]byte(proc.Census.CensusRoot), qt.DeepEquals, newRoot)
+	c.Assert(proc.Census.CensusURI, qt.Equals, "https://example.com/census2")
+	c.Assert(proc.Census.MaxVotes.MathBigInt().Uint64(), qt.Equals, uint64(100))
+	// the contracts keep the max votes too
+	onChain := contracts.created[pid.String()]
+	c.Assert([]byte(onChain.Census.CensusRoot), qt.DeepEquals, newRoot)
+	c.Assert(onChain.Census.MaxVotes.MathBigInt().Uint64(), qt.Equals, uint64(100))
+
+	// the max votes increase
+	c.Assert(monitor.UpdateProcessCensus(pid, &types.Census{
+		CensusRoot: newRoot,
+		MaxVotes:   new(types.BigInt).SetUint64(200),
+		CensusURI:  "https://example.com/census2",
+	}), qt.IsNil)
+	proc, err = store.Process(pid)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proc.Census.MaxVotes.MathBigInt().Uint64(), qt.Equals, uint64(200))
+	c.Assert(onChain.Census.MaxVotes.MathBigInt().Uint64(), qt.Equals, uint64(200))
+
+	c.Assert(monitor.EndProcess(pid), qt.IsNil)
+	proc, err = store.Process(pid)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proc.Status, qt.Equals, types.ProcessStatusEnded)
+
+	// terminated processes cannot be updated
+	c.Assert(monitor.ResumeProcess(pid), qt.IsNotNil)
+}
+
+func TestProcessMonitorMultiChain(t *testing.T) {
+	c := qt.New(t)
+
+	store := storage.New(metadb.NewTest(t))
+	chainA := NewMockChainContracts(1)
+	chainB := NewMockChainContracts(5)
+	monitor := NewMultiChainProcessMonitor(map[uint32]ContractsService{
+		1: chainA,
+		5: chainB,
+	}, store, 100*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	c.Assert(monitor.Start(ctx), qt.IsNil)
+	defer monitor.Stop()
+
+	newProcess := func(contracts *MockContracts) *types.ProcessID {
+		pid, _, err := contracts.CreateProcess(&types.Process{
+			OrganizationId: contracts.AccountAddress(),
+			StartTime:      time.Now(),
+			Duration:       time.Hour,
+			Census: &types.Census{
+				CensusRoot: make([]byte, 32),
+				MaxVotes:   new(types.BigInt).SetUint64(100),
+				CensusURI:  "https://example.com/census",
+			},
+		})
+		c.Assert(err, qt.IsNil)
+		return pid
+	}
+	pidA := newProcess(chainA)
+	pidB := newProcess(chainB)
+	c.Assert(pidA.ChainID, qt.Equals, uint32(1))
+	c.Assert(pidB.ChainID, qt.Equals, uint32(5))
+
+	// wait for the monitor to store the processes of both chains
+	for _, pid := range []*types.ProcessID{pidA, pidB} {
+		for {
+			if _, err := store.Process(pid); err == nil {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				c.Fatal("timeout waiting for process to be stored")
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+
+	// the operations are routed to the chain of the process
+	contracts, err := monitor.Contracts(pidB)
+	c.Assert(err, qt.IsNil)
+	c.Assert(contracts, qt.Equals, ContractsService(chainB))
+	c.Assert(monitor.EndProcess(pidB), qt.IsNil)
+	c.Assert(chainB.created[pidB.String()].Status, qt.Equals, types.ProcessStatusEnded)
+	c.Assert(chainA.created[pidA.String()].Status, qt.Equals, types.ProcessStatusReady)
+	proc, err := store.Process(pidB)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proc.Status, qt.Equals, types.ProcessStatusEnded)
+
+	// processes of unknown chains are rejected
+	unknown := &types.ProcessID{Address: pidA.Address, Nonce: 0, ChainID: 7}
+	_, err = monitor.Contracts(unknown)
+	c.Assert(err, qt.ErrorIs, ErrUnknownChain)
+	c.Assert(monitor.EndProcess(unknown), qt.ErrorIs, ErrUnknownChain)
+}
+
+func TestProcessMonitorCensusBootstrap(t *testing.T) {
+	c := qt.New(t)
+
+	// build the censuses elsewhere and publish their dumps in a file and
+	// over HTTP
+	remote := census.NewCensusDB(metadb.NewTest(t))
+	keys := [][]byte{}
+	values := [][]byte{}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("participant-%d", i)))
+		values = append(values, []byte{1})
+	}
+	newDump := func(n int, hashType string) (*census.CensusDump, []byte) {
+		ref, err := remote.NewWithHashType(uuid.New(), hashType)
+		c.Assert(err, qt.IsNil)
+		_, err = ref.InsertBatch(keys[:n], values[:n])
+		c.Assert(err, qt.IsNil)
+		dump, err := remote.Export(ref.ID)
+		c.Assert(err, qt.IsNil)
+		data, err := json.Marshal(dump)
+		c.Assert(err, qt.IsNil)
+		return dump, data
+	}
+	dump, dumpData := newDump(10, "")
+	dump2, dumpData2 := newDump(3, "")
+	dumpPoseidon, dumpDataPoseidon := newDump(3, string(arbo.HashFunctionPoseidon.Type()))
+	dumpFile := filepath.Join(t.TempDir(), "census.json")
+	c.Assert(os.WriteFile(dumpFile, dumpData, 0o600), qt.IsNil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/census1":
+			_, _ = w.Write(dumpData)
+		case "/census2":
+			_, _ = w.Write(dumpData2)
+		case "/census3":
+			_, _ = w.Write(dumpDataPoseidon)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	store := storage.New(metadb.NewTest(t))
+	contracts := NewMockContracts()
+	monitor := NewProcessMonitor(contracts, store, 100*time.Millisecond)
+	srvURL, err := url.Parse(srv.URL)
+	c.Assert(err, qt.IsNil)
+	monitor.SetCensusFetchConfig(CensusFetchConfig{
+		AllowFile:    true,
+		AllowHTTP:    true,
+		AllowedHosts: []string{srvURL.Hostname()},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	c.Assert(monitor.Start(ctx), qt.IsNil)
+	defer monitor.Stop()
+
+	newProcess := func(root []byte, uri string) *types.ProcessID {
+		pid, _, err := contracts.CreateProcess(&types.Process{
+			OrganizationId: contracts.AccountAddress(),
+			StartTime:      time.Now(),
+			Duration:       time.Hour,
+			Census: &types.Census{
+				CensusRoot: root,
+				MaxVotes:   new(types.BigInt).SetUint64(100),
+				CensusURI:  uri,
+			},
+		})
+		c.Assert(err, qt.IsNil)
+		return pid
+	}
+	waitRetained := func(root []byte, pid *types.ProcessID) {
+		for {
+			if snapshot, err := store.CensusDB().Snapshot(root); err == nil {
+				if _, ok := snapshot.Holders[hex.EncodeToString(pid.Marshal())]; ok {
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				c.Fatal("timeout waiting for the census to be imported")
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+
+	// the census is imported from the file and the proofs are available
+	pidFile := newProcess(dump.Root, "file://"+dumpFile)
+	waitRetained(dump.Root, pidFile)
+	proof, err := store.CensusDB().ProofByRoot(dump.Root, keys[2])
+	c.Assert(err, qt.IsNil)
+	c.Assert(store.CensusDB().VerifyProof(proof), qt.IsTrue)
+	published, err := store.CensusDB().PublishedCensus(dump.Root)
+	c.Assert(err, qt.IsNil)
+	c.Assert(published.IsLocked(), qt.IsTrue)
+
+	// a process with a known root does not import it again but retains it
+	pidKnown := newProcess(dump.Root, srv.URL+"/census1")
+	waitRetained(dump.Root, pidKnown)
+	c.Assert(store.CensusDB().RetainedRoots(published.ID), qt.HasLen, 1)
+
+	// the census is also fetched over HTTP
+	pidHTTP := newProcess(dump2.Root, srv.URL+"/census2")
+	waitRetained(dump2.Root, pidHTTP)
+	size, err := store.CensusDB().SizeByRoot(dump2.Root)
+	c.Assert(err, qt.IsNil)
+	c.Assert(size, qt.Equals, 3)
+
+	// a census that does not match the process root is not imported
+	wrongRoot := make([]byte, len(dump.Root))
+	pidWrong := newProcess(wrongRoot, srv.URL+"/census1")
+	err = monitor.bootstrapCensus(ctx, &types.Process{
+		ID:     pidWrong.Marshal(),
+		Census: &types.Census{CensusRoot: wrongRoot, CensusURI: srv.URL + "/census1"},
+	})
+	c.Assert(err, qt.ErrorIs, census.ErrCensusRootMismatch)
+	c.Assert(store.CensusDB().KnownRoot(wrongRoot), qt.IsFalse)
+
+	// a census whose proofs cannot be proven by the circuits is not imported
+	err = monitor.bootstrapCensus(ctx, &types.Process{
+		ID:     pidWrong.Marshal(),
+		Census: &types.Census{CensusRoot: dumpPoseidon.Root, CensusURI: srv.URL + "/census3"},
+	})
+	c.Assert(err, qt.ErrorIs, census.ErrHashTypeNotProvable)
+	c.Assert(store.CensusDB().KnownRoot(dumpPoseidon.Root), qt.IsFalse)
+}
+
+func TestFetchCensusDumpRestrictions(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	dumpFile := filepath.Join(t.TempDir(), "census.json")
+	c.Assert(os.WriteFile(dumpFile, []byte("{}"), 0o600), qt.IsNil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file://"+dumpFile, http.StatusFound)
+	}))
+	defer srv.Close()
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer tlsSrv.Close()
+
+	// by default, only the HTTPS URIs of public hosts are fetched
+	cfg := &CensusFetchConfig{}
+	for _, uri := range []string{
+		"file://" + dumpFile,
+		srv.URL,
+		"ftp://example.com/census",
+		"https:///census",
+		tlsSrv.URL,
+		"https://localhost/census",
+	} {
+		_, err := fetchCensusDump(ctx, cfg, uri)
+		c.Assert(err, qt.ErrorIs, ErrCensusURINotAllowed, qt.Commentf("%s", uri))
+	}
+
+	// the hosts listed are trusted, and the rest are not allowed
+	cfg = &CensusFetchConfig{AllowHTTP: true, AllowedHosts: []string{"127.0.0.1"}}
+	_, err := fetchCensusDump(ctx, cfg, "http://example.com/census")
+	c.Assert(err, qt.ErrorIs, ErrCensusURINotAllowed)
+	// the redirects are checked too
+	_, err = fetchCensusDump(ctx, cfg, srv.URL)
+	c.Assert(err, qt.ErrorIs, ErrCensusURINotAllowed)
+
+	// the file URIs are allowed explicitly
+	cfg = &CensusFetchConfig{AllowFile: true}
+	_, err = fetchCensusDump(ctx, cfg, "file://"+dumpFile)
+	c.Assert(err, qt.IsNil)
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	c := qt.New(t)
+	for addr, public := range map[string]bool{
+		"8.8.8.8":              true,
+		"2606:4700:4700::1111": true,
+		"::ffff:8.8.8.8":       true,
+		"0.0.0.0":              false,
+		"10.1.2.3":             false,
+		"100.64.0.1":           false,
+		"100.127.255.254":      false,
+		"127.0.0.1":            false,
+		"169.254.169.254":      false,
+		"172.16.0.1":           false,
+		"192.0.0.170":          false,
+		"192.0.2.1":            false,
+		"192.168.1.1":          false,
+		"198.18.0.1":           false,
+		"224.0.0.1":            false,
+		"255.255.255.255":      false,
+		"::1":                  false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:100.64.0.1":    false,
+		"64:ff9b::a00:1":       false,
+		"64:ff9b:1::1":         false,
+		"2001:db8::1":          false,
+		"2001::1":              false,
+		"2002:a00:1::1":        false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+		"ff02::1":              false,
+		"100::1":               false,
+		"5f00::1":              false,
+		"3fff::1":              false,
+		"64:ff9b::8.8.8.8":     false,
+		"fe80::1%eth0":         false,
+		"2001:4860:4860::8888": true,
+		"2001:200::1":          true,
+		"2606:4700:4700::1001": true,
+	} {
+		c.Assert(isPublicAddr(netip.MustParseAddr(addr)), qt.Equals, public, qt.Commentf("%s", addr))
+	}
+}
+
+func TestProcessMonitorStop(t *testing.T) {
+	c := qt.New(t)
+
+	store := storage.New(metadb.NewTest(t))
+	contracts := NewMockContracts()
+	monitor := NewProcessMonitor(contracts, store, 100*time.Millisecond)
+	c.Assert(monitor.Start(context.Background()), qt.IsNil)
+
+	// hold the census imports, so the bootstrap of the new process blocks
+	monitor.censusMu.Lock()
+	pid, _, err := contracts.CreateProcess(&types.Process{
+		OrganizationId: contracts.AccountAddress(),
+		StartTime:      time.Now(),
+		Duration:       time.Hour,
+		Census: &types.Census{
+			CensusRoot: make([]byte, 32),
+			MaxVotes:   new(types.BigInt).SetUint64(100),
+			CensusURI:  "http://127.0.0.1:1/census",
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	for {
+		if _, err := store.Process(pid); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Stop waits for the census bootstrap in progress
+	stopped := make(chan struct{})
+	go func() {
+		monitor.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		c.Fatal("the monitor stopped before the census bootstrap finished")
+	case <-time.After(200 * time.Millisecond):
+	}
+	monitor.censusMu.Unlock()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		c.Fatal("timeout waiting for the monitor to stop")
+	}
+}
+
+func TestProcessMonitorTokenCensus(t *testing.T) {
+	c := qt.New(t)
+
+	// deploy a token on a simulated chain and distribute it
+	sim, err := simulated.New(3)
+	c.Assert(err, qt.IsNil)
+	t.Cleanup(func() { _ = sim.Close() })
+	owner, alice, bob := sim.Accounts[0], sim.Accounts[1], sim.Accounts[2]
+	token, err := sim.DeployToken(owner, big.NewInt(1000))
+	c.Assert(err, qt.IsNil)
+	_, err = token.Transfer(owner, alice.Address(), big.NewInt(300))
+	c.Assert(err, qt.IsNil)
+	snapshotBlock, err := token.Transfer(alice, bob.Address(), big.NewInt(100))
+	c.Assert(err, qt.IsNil)
+	_, err = token.Transfer(owner, bob.Address(), big.NewInt(50))
+	c.Assert(err, qt.IsNil)
+	tokenCensus := &types.TokenCensus{ChainID: simulated.ChainID, Token: token.Address, Block: snapshotBlock}
+
+	store := storage.New(metadb.NewTest(t))
+	monitor := NewProcessMonitor(sim.Contracts, store, 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	c.Assert(monitor.Start(ctx), qt.IsNil)
+	defer monitor.Stop()
+
+	orgAddr := sim.Contracts.AccountAddress()
+	txHash, err := sim.Contracts.CreateOrganization(orgAddr, &types.OrganizationInfo{Name: "token holders"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(sim.Contracts.WaitTx(txHash, 5*time.Second), qt.IsNil)
+	newProcess := func(root []byte) *types.ProcessID {
+		pid, hash, err := sim.Contracts.CreateProcess(&types.Process{
+			OrganizationId: orgAddr,
+			EncryptionKey:  &types.EncryptionKey{X: big.NewInt(1), Y: big.NewInt(2)},
+			StateRoot:      make([]byte, 32),
+			StartTime:      time.Now().Add(time.Minute),
+			Duration:       time.Hour,
+			MetadataURI:    "https://example.com/metadata",
+			BallotMode: &types.BallotMode{
+				MaxCount:     2,
+				MaxValue:     new(types.BigInt).SetUint64(100),
+				MinValue:     new(types.BigInt).SetUint64(0),
+				MaxTotalCost: new(types.BigInt).SetUint64(0),
+				MinTotalCost: new(types.BigInt).SetUint64(0),
+			},
+			Census: &types.Census{
+				CensusOrigin: types.CensusOriginERC20,
+				CensusRoot:   root,
+				MaxVotes:     new(types.BigInt).SetUint64(100),
+				CensusURI:    tokenCensus.URI(),
+			},
+		})
+		c.Assert(err, qt.IsNil)
+		c.Assert(sim.Contracts.WaitTx(*hash, 5*time.Second), qt.IsNil)
+		return pid
+	}
+	waitRetained := func(pid *types.ProcessID) []byte {
+		for {
+			if proc, err := store.Process(pid); err == nil && len(bytes.Trim(proc.Census.CensusRoot, "\x00")) > 0 {
+				snapshot, err := store.CensusDB().Snapshot(proc.Census.CensusRoot)
+				if err == nil {
+					if _, ok := snapshot.Holders[hex.EncodeToString(pid.Marshal())]; ok {
+						return proc.Census.CensusRoot
+					}
+				}
+			}
+			select {
+			case <-ctx.Done():
+				c.Fatal("timeout waiting for the token census")
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+
+	// the census is built for a process without census root, which gets
+	// the root of the census built
+	pid := newProcess(make([]byte, 32))
+	root := waitRetained(pid)
+	published, err := store.CensusDB().PublishedCensus(root)
+	c.Assert(err, qt.IsNil)
+	c.Assert(published.PublishedSize, qt.Equals, 3)
+	proof, err := store.CensusDB().ProofByRoot(root, alice.Address().Bytes())
+	c.Assert(err, qt.IsNil)
+	c.Assert(store.CensusDB().VerifyProof(proof), qt.IsTrue)
+	c.Assert(proof.Weight.MathBigInt().Int64(), qt.Equals, int64(200))
+
+	// anyone can check the root from the balances of the holders at the block
+	ref, err := census.NewCensusDB(metadb.NewTest(t)).New(uuid.New())
+	c.Assert(err, qt.IsNil)
+	for _, holder := range sim.Accounts {
+		balance, err := token.BalanceOf(holder.Address(), new(big.Int).SetUint64(snapshotBlock))
+		c.Assert(err, qt.IsNil)
+		c.Assert(ref.Insert(holder.Address().Bytes(), arbo.BigIntToBytes(ref.HashLen(), balance)), qt.IsNil)
+	}
+	c.Assert(ref.Root(), qt.DeepEquals, root)
+
+	// a process with the known root retains the same census
+	pidKnown := newProcess(root)
+	c.Assert(waitRetained(pidKnown), qt.DeepEquals, root)
+	c.Assert(store.CensusDB().RetainedRoots(published.ID), qt.HasLen, 1)
+
+	// the census of a token of a chain that is not followed is rejected,
+	// instead of being built from the balances of the followed chain
+	otherChain := *tokenCensus
+	otherChain.ChainID = simulated.ChainID + 1
+	_, err = monitor.buildTokenCensus(ctx, &otherChain)
+	c.Assert(err, qt.ErrorMatches, ".*unknown chain: 1338")
+	otherChain.ChainID = math.MaxUint32 + 1
+	_, err = monitor.buildTokenCensus(ctx, &otherChain)
+	c.Assert(err, qt.ErrorIs, ErrUnknownChain)
+}
+
+func TestProcessMonitorEvents(t *testing.T) {
+	c := qt.New(t)
+
+	store := storage.New(metadb.NewTest(t))
+	contracts := NewMockContracts()
+	monitor := NewProcessMonitor(contracts, store, 50*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	c.Assert(monitor.Start(ctx), qt.IsNil)
+	defer monitor.Stop()
+
+	newProcess := func(start time.Time, duration time.Duration) *types.ProcessID {
+		pid, _, err := contracts.CreateProcess(&types.Process{
+			OrganizationId: contracts.AccountAddress(),
+			StartTime:      start,
+			Duration:       duration,
+			Census: &types.Census{
+				CensusRoot: make([]byte, 32),
+				MaxVotes:   new(types.BigInt).SetUint64(100),
+				CensusURI:  "https://example.com/census",
+			},
+		})
+		c.Assert(err, qt.IsNil)
+		for {
+			if _, err := store.Process(pid); err == nil {
+				return pid
+			}
+			select {
+			case <-ctx.Done():
+				c.Fatal("timeout waiting for process to be stored")
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+	nextEvent := func(sub *events.Subscription) *events.Event {
+		select {
+		case e := <-sub.C:
+			return e
+		case <-ctx.Done():
+			c.Fatal("timeout waiting for process event")
+		}
+		return nil
+	}
+
+	// the state root and the results set on chain are published
+	pid := newProcess(time.Now(), time.Hour)
+	_, sub := store.Events().Subscribe(pid.Marshal(), 0)
+	defer store.Events().Unsubscribe(sub)
+	c.Assert(contracts.SetProcessStateRoot(pid.Marshal(), []byte{0xaa}), qt.IsNil)
+	e := nextEvent(sub)
+	c.Assert(e.Type, qt.Equals, events.StateRoot)
+	c.Assert([]byte(e.Data.(*events.StateRootData).StateRoot), qt.DeepEquals, []byte{0xaa})
+	c.Assert(contracts.SetProcessResults(pid.Marshal(), []*types.BigInt{new(types.BigInt).SetUint64(7)}), qt.IsNil)
+	e = nextEvent(sub)
+	c.Assert(e.Type, qt.Equals, events.ProcessEnded)
+	c.Assert(e.Data.(*events.ProcessStatusData).Status, qt.Equals, types.ProcessStatusResults)
+	e = nextEvent(sub)
+	c.Assert(e.Type, qt.Equals, events.ResultsReady)
+	c.Assert(e.Data.(*events.ResultsData).Results[0].MathBigInt().Uint64(), qt.Equals, uint64(7))
+	proc, err := store.Process(pid)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proc.Status, qt.Equals, types.ProcessStatusResults)
+
+	// a status changed on chain by another account is published
+	pid = newProcess(time.Now(), time.Hour)
+	_, sub = store.Events().Subscribe(pid.Marshal(), 0)
+	defer store.Events().Unsubscribe(sub)
+	_, err = contracts.SetProcessStatus(pid.Marshal(), types.ProcessStatusCanceled)
+	c.Assert(err, qt.IsNil)
+	e = nextEvent(sub)
+	c.Assert(e.Type, qt.Equals, events.ProcessEnded)
+	c.Assert(e.Data.(*events.ProcessStatusData).Status, qt.Equals, types.ProcessStatusCanceled)
+
+	// a process whose duration is over is ended
+	pid = newProcess(time.Now(), time.Second)
+	_, sub = store.Events().Subscribe(pid.Marshal(), 0)
+	defer store.Events().Unsubscribe(sub)
+	e = nextEvent(sub)
+	c.Assert(e.Type, qt.Equals, events.ProcessEnded)
+	c.Assert(e.Data.(*events.ProcessStatusData).Status, qt.Equals, types.ProcessStatusEnded)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/vocdoni/arbo"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+// TokenBalancesService is implemented by the ContractsService of the chains
+// that can compute the balances of the holders of ERC-20 tokens, such as
+// web3.Contracts. It must return an error if it has no endpoint of the
+// chainID provided, instead of computing the balances on another chain.
+type TokenBalancesService interface {
+	TokenBalances(ctx context.Context, chainID uint64, token common.Address, fromBlock, atBlock uint64) (map[common.Address]*big.Int, error)
+}
+
+// bootstrapTokenCensus builds the census of the holders of the ERC-20 token
+// of the census URI of the process provided, where the key of each holder is
+// its address and the weight its balance at the block of the URI. Anyone can
+// rebuild the census from the chain to check its root. If the process has a
+// census root, the census built must match it, otherwise (the root is empty
+// or zero, as the contract stores it) the root of the census built becomes
+// the census root of the local copy of the process. The census is published
+// and its root retained on behalf of the process.
+func (pm *ProcessMonitor) bootstrapTokenCensus(ctx context.Context, proc *types.Process) error {
+	tc, err := types.ParseTokenCensusURI(proc.Census.CensusURI)
+	if err != nil {
+		return err
+	}
+	// serialize the builds, so the processes that share a census build it
+	// once
+	pm.censusMu.Lock()
+	defer pm.censusMu.Unlock()
+
+	censusDB := pm.storage.CensusDB()
+	root := proc.Census.CensusRoot
+	unset := len(bytes.Trim(root, "\x00")) == 0
+	if unset {
+		root = nil
+	}
+	if unset || !censusDB.KnownRoot(root) {
+		ref, err := pm.buildTokenCensus(ctx, tc)
+		if err != nil {
+			return err
+		}
+		builtRoot := ref.Root()
+		if !unset && !bytes.Equal(builtRoot, root) {
+			if err := censusDB.Del(ref.ID); err != nil {
+				log.Warnw("could not delete token census", "census", ref.ID.String(), "error", err.Error())
+			}
+			return fmt.Errorf("%w: expected %x, got %x", census.ErrCensusRootMismatch, root, builtRoot)
+		}
+		if _, err := censusDB.PublishedCensus(builtRoot); err == nil {
+			// the same census was already built for another process
+			if err := censusDB.Del(ref.ID); err != nil {
+				log.Warnw("could not delete token census", "census", ref.ID.String(), "error", err.Error())
+			}
+		} else if !errors.Is(err, census.ErrCensusNotPublished) {
+			return err
+		} else if _, err := censusDB.Publish(ref.ID); err != nil {
+			return fmt.Errorf("could not publish token census: %w", err)
+		}
+		log.Infow("token census built", "processID", proc.ID.String(), "root", hex.EncodeToString(builtRoot),
+			"uri", proc.Census.CensusURI)
+		root = builtRoot
+	}
+	if unset {
+		// the new root is retained by the storage on behalf of the process
+		return pm.storage.UpdateProcess(new(types.ProcessID).SetBytes(proc.ID), func(p *types.Process) error {
+			p.Census.CensusRoot = root
+			return nil
+		})
+	}
+	if _, err := censusDB.RetainRoot(root, proc.ID); err != nil {
+		return fmt.Errorf("could not retain census root: %w", err)
+	}
+	return nil
+}
+
+// buildTokenCensus creates a new census with the holders of the token census
+// provided, using the ContractsService of its chain to compute the balances.
+// The ContractsService of a single chain monitor is asked for any chain, so it
+// must reject the chains it does not follow.
+func (pm *ProcessMonitor) buildTokenCensus(ctx context.Context, tc *types.TokenCensus) (*census.CensusRef, error) {
+	if tc.ChainID > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownChain, tc.ChainID)
+	}
+	contracts, err := pm.chainContracts(uint32(tc.ChainID))
+	if err != nil {
+		return nil, err
+	}
+	balancesService, ok := contracts.(TokenBalancesService)
+	if !ok {
+		return nil, fmt.Errorf("chain %d can not compute token balances", tc.ChainID)
+	}
+	balances, err := balancesService.TokenBalances(ctx, tc.ChainID, tc.Token, tc.FromBlock, tc.Block)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute token balances: %w", err)
+	}
+	ref, err := pm.storage.CensusDB().New(uuid.New())
+	if err != nil {
+		return nil, err
+	}
+	keys := make([][]byte, 0, len(balances))
+	values := make([][]byte, 0, len(balances))
+	for holder, balance := range balances {
+		keys = append(keys, holder.Bytes())
+		values = append(values, arbo.BigIntToBytes(ref.HashLen(), balance))
+	}
+	invalid, err := ref.InsertBatch(keys, values)
+	if err == nil && len(invalid) > 0 {
+		err = fmt.Errorf("failed to insert %d token holders", len(invalid))
+	}
+	if err != nil {
+		if err := pm.storage.CensusDB().Del(ref.ID); err != nil {
+			log.Warnw("could not delete token census", "census", ref.ID.String(), "error", err.Error())
+		}
+		return nil, err
+	}
+	return ref, nil
+}
@@ -5,12 +5,18 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/vocdoni/vocdoni-z-sandbox/events"
 	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
 	"go.vocdoni.io/dvote/db/prefixeddb"
 )
 
-// PushBallot stores a new ballot into the pending ballots queue.
+// PushBallot stores a new ballot into the pending ballots queue and counts it
+// as accepted in the stats of its process.
 func (s *Storage) PushBallot(b *Ballot) error {
+	s.globalLock.Lock()
+	defer s.globalLock.Unlock()
+
 	val, err := encodeArtifact(b)
 	if err != nil {
 		return fmt.Errorf("encode ballot: %w", err)
@@ -21,7 +27,16 @@ func (s *Storage) PushBallot(b *Ballot) error {
 		wTx.Discard()
 		return err
 	}
-	return wTx.Commit()
+	if err := wTx.Commit(); err != nil {
+		return err
+	}
+	if err := s.updateProcessStats(b.ProcessID, func(stats *ProcessStats) {
+		stats.BallotsAccepted++
+	}); err != nil {
+		return err
+	}
+	s.publishBallotStatus(b.ProcessID, b.Nullifier, b.Address, events.BallotPending)
+	return nil
 }
 
 // NextBallot returns the next non-reserved ballot, creates a reservation, and
@@ -64,7 +79,8 @@ func (s *Storage) NextBallot() (*Ballot, []byte, error) {
 
 // MarkBallotDone called after we have processed the ballot. We push the
 // verified ballot to the next queue. In this scenario, next stage is
-// verifiedBallot so we do not store the original ballot.
+// verifiedBallot so we do not store the original ballot. The ballot is counted
+// as verified in the stats of its process.
 func (s *Storage) MarkBallotDone(k []byte, vb *VerifiedBallot) error {
 	s.globalLock.Lock()
 	defer s.globalLock.Unlock()
@@ -91,7 +107,16 @@ func (s *Storage) MarkBallotDone(k []byte, vb *VerifiedBallot) error {
 		wTx.Discard()
 		return err
 	}
-	return wTx.Commit()
+	if err := wTx.Commit(); err != nil {
+		return err
+	}
+	if err := s.updateProcessStats(vb.ProcessID, func(stats *ProcessStats) {
+		stats.BallotsVerified++
+	}); err != nil {
+		return err
+	}
+	s.publishBallotStatus(vb.ProcessID, vb.Nullifier, vb.Address, events.BallotVerified)
+	return nil
 }
 
 // PullVerifiedBallots returns a list of non-reserved verified ballots for a
@@ -175,7 +200,13 @@ func (s *Storage) PushBallotBatch(abb *AggregatorBallotBatch) error {
 		wTx.Discard()
 		return err
 	}
-	return wTx.Commit()
+	if err := wTx.Commit(); err != nil {
+		return err
+	}
+	for _, b := range abb.Ballots {
+		s.publishBallotStatus(abb.ProcessID, b.Nullifier, b.Address, events.BallotAggregated)
+	}
+	return nil
 }
 
 // NextBallotBatch returns the next aggregated ballot batch for a given
@@ -232,15 +263,35 @@ func (s *Storage) MarkVerifiedBallotDone(k []byte) error {
 }
 
 // MarkBallotBatchDone called after processing aggregator batch. For simplicity,
-// we just remove it from aggregator queue and reservation.
+// we just remove it from aggregator queue and reservation. The batch is
+// published as settled.
 func (s *Storage) MarkBallotBatchDone(k []byte) error {
 	s.globalLock.Lock()
 	defer s.globalLock.Unlock()
+	abb := &AggregatorBallotBatch{}
+	if err := s.getArtifact(aggregBatchPrefix, k, abb); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Warnw("could not read settled batch", "key", hex.EncodeToString(k), "error", err.Error())
+		}
+		abb = nil
+	}
 	if err := s.deleteArtifact(aggregBatchReservPrefix, k); err != nil && !errors.Is(err, ErrNotFound) {
 		return err
 	}
 	if err := s.deleteArtifact(aggregBatchPrefix, k); err != nil && !errors.Is(err, ErrNotFound) {
 		return err
 	}
+	if abb != nil {
+		s.events.Publish(abb.ProcessID, events.BatchSettled, &events.BatchData{Ballots: len(abb.Ballots)})
+	}
 	return nil
 }
+
+// publishBallotStatus publishes the new status of the ballot provided.
+func (s *Storage) publishBallotStatus(processID, nullifier, address types.HexBytes, status string) {
+	s.events.Publish(processID, events.BallotStatus, &events.BallotStatusData{
+		Nullifier: nullifier,
+		Address:   address,
+		Status:    status,
+	})
+}
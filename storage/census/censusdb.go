@@ -2,6 +2,7 @@ package census
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/gob"
 	"encoding/hex"
 	"errors"
@@ -20,6 +21,9 @@ import (
 const (
 	censusDBprefix          = "cs_"
 	censusDBreferencePrefix = "cr_"
+
+	// authTokenSize is the size in bytes of the census management tokens.
+	authTokenSize = 32
 )
 
 var (
@@ -33,15 +37,18 @@ var (
 	ErrCensusIsLocked = fmt.Errorf("census is locked")
 	// ErrKeyNotFound is returned when a key is not found in the Merkle tree.
 	ErrKeyNotFound = fmt.Errorf("key not found")
+	// ErrEmptyValue is returned when a leaf is inserted or updated with an
+	// empty value, which is reserved to the removed leaves.
+	ErrEmptyValue = fmt.Errorf("empty leaf value")
 
 	defaultHashFunction = arbo.HashFunctionMiMC_BLS12_377
 )
 
 // updateRootRequest is used to update the root of a census tree.
 type updateRootRequest struct {
-	censusID uuid.UUID
-	newRoot  []byte
-	done     chan struct{}
+	ref     *CensusRef
+	newRoot []byte
+	done    chan struct{}
 }
 
 // rootKey converts a root (a byte slice) to its canonical hexadecimal string.
@@ -51,14 +58,22 @@ func rootKey(root []byte) string {
 
 // CensusDB is a safe and persistent database of census trees.
 // It maintains an in‑memory index mapping Merkle tree roots (in hexadecimal form)
-// to census IDs.
+// to census IDs, and the snapshots of the roots retained, which remain
+// available after the census tree is modified.
 type CensusDB struct {
 	mu           sync.RWMutex
 	db           db.Database
 	loadedCensus map[uuid.UUID]*CensusRef
-	rootIndex    map[string]uuid.UUID // maps hex(root) to censusID
+	rootIndex    map[string]uuid.UUID     // maps hex(root) to censusID
+	snapshots    map[string]*RootSnapshot // maps hex(root) to its snapshot
+	// treeLocks contains the tree mutex of each census loaded since it was
+	// created or the database opened, which outlives the unloading of the
+	// census, so every reference to a census shares it.
+	treeLocks map[uuid.UUID]*sync.Mutex
 
 	updateRootChan chan *updateRootRequest
+	// lastSweep is the report of the last sweep.
+	lastSweep *SweepReport
 }
 
 // NewCensusDB creates a new CensusDB object.
@@ -68,15 +83,20 @@ func NewCensusDB(db db.Database) *CensusDB {
 		db:             db,
 		loadedCensus:   make(map[uuid.UUID]*CensusRef),
 		rootIndex:      make(map[string]uuid.UUID),
+		snapshots:      make(map[string]*RootSnapshot),
+		treeLocks:      make(map[uuid.UUID]*sync.Mutex),
 		updateRootChan: make(chan *updateRootRequest, 100),
 	}
+	if err := c.loadSnapshots(); err != nil {
+		log.Warnw("error loading census root snapshots", "err", err)
+	}
 
 	// Start the root update worker.
 	go func() {
 		for req := range c.updateRootChan {
-			if err := c.updateRoot(req.censusID, req.newRoot); err != nil {
+			if err := c.updateRoot(req.ref, req.newRoot); err != nil {
 				log.Warnw("error updating census root",
-					"id", hex.EncodeToString(req.censusID[:]),
+					"id", hex.EncodeToString(req.ref.ID[:]),
 					"err", err)
 			}
 			if req.done != nil {
@@ -88,9 +108,28 @@ func NewCensusDB(db db.Database) *CensusDB {
 	return c
 }
 
-// New creates a new census and adds it to the database.
-// It returns ErrCensusAlreadyExists if a census with the given ID is already present.
+// New creates a new census with the default hash function and adds it to the
+// database. It returns ErrCensusAlreadyExists if a census with the given ID is
+// already present.
 func (c *CensusDB) New(censusID uuid.UUID) (*CensusRef, error) {
+	return c.newCensus(censusID, "", nil)
+}
+
+// NewWithHashType creates a new census like New, using the hash function of
+// the type provided for its tree. If the type is empty, the default hash
+// function is used. It returns ErrUnsupportedHashType if the hash type is not
+// supported.
+func (c *CensusDB) NewWithHashType(censusID uuid.UUID, hashType string) (*CensusRef, error) {
+	return c.newCensus(censusID, hashType, nil)
+}
+
+// newCensus creates a new census with the hash type and the authentication
+// token hash provided and adds it to the database.
+func (c *CensusDB) newCensus(censusID uuid.UUID, hashType string, authTokenHash []byte) (*CensusRef, error) {
+	hashFn, err := HashFunction(hashType)
+	if err != nil {
+		return nil, err
+	}
 	key := append([]byte(censusDBreferencePrefix), censusID[:]...)
 
 	c.mu.Lock()
@@ -111,21 +150,27 @@ func (c *CensusDB) New(censusID uuid.UUID) (*CensusRef, error) {
 	ref := &CensusRef{
 		ID:        censusID,
 		MaxLevels: types.CensusTreeMaxLevels,
-		HashType:  string(defaultHashFunction.Type()),
+		HashType:  string(hashFn.Type()),
 		LastUsed:  time.Now(),
+
+		AuthTokenHash: authTokenHash,
+
+		hashFunction: hashFn,
+		treeMu:       c.treeLock(censusID),
 	}
 
 	// Create the Merkle tree.
+	treeDB := prefixeddb.NewPrefixedDatabase(c.db, censusPrefix(censusID))
 	tree, err := arbo.NewTree(arbo.Config{
-		Database:     prefixeddb.NewPrefixedDatabase(c.db, censusPrefix(censusID)),
+		Database:     treeDB,
 		MaxLevels:    types.CensusTreeMaxLevels,
-		HashFunction: defaultHashFunction,
+		HashFunction: hashFn,
 	})
-	tree.HashFunction().Type()
 	if err != nil {
 		return nil, err
 	}
 	ref.SetTree(tree)
+	ref.treeDB = treeDB
 	// Compute and update the current root.
 	root, err := tree.Root()
 	if err != nil {
@@ -151,6 +196,30 @@ func (c *CensusDB) New(censusID uuid.UUID) (*CensusRef, error) {
 	return ref, nil
 }
 
+// NewWithAuthToken creates a new census like NewWithHashType and issues a
+// secret token required to manage it, which is returned. Only the hash of the
+// token is stored, so it cannot be recovered if lost.
+func (c *CensusDB) NewWithAuthToken(censusID uuid.UUID, hashType string) (*CensusRef, string, error) {
+	token, err := newAuthToken()
+	if err != nil {
+		return nil, "", err
+	}
+	ref, err := c.newCensus(censusID, hashType, hashAuthToken(token))
+	if err != nil {
+		return nil, "", err
+	}
+	return ref, token, nil
+}
+
+// newAuthToken generates a new random census management token.
+func newAuthToken() (string, error) {
+	tokenBytes := make([]byte, authTokenSize)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("could not generate authentication token: %w", err)
+	}
+	return hex.EncodeToString(tokenBytes), nil
+}
+
 // writeReference writes a census reference to the database.
 func (c *CensusDB) writeReference(ref *CensusRef) error {
 	key := append([]byte(censusDBreferencePrefix), ref.ID[:]...)
@@ -166,21 +235,16 @@ func (c *CensusDB) writeReference(ref *CensusRef) error {
 	return wtx.Commit()
 }
 
-// HashAndTrunk computes the hash of a key and truncates it to the required length.
-// Returns nil if the hash function fails. Panics if the hash output is too short.
+// HashAndTrunk computes the hash of a key with the default hash function and
+// truncates it to the required length. Returns nil if the hash function fails.
+// Panics if the hash output is too short. Use CensusRef.HashAndTrunkKey for
+// the keys of a given census.
 func (c *CensusDB) HashAndTrunkKey(key []byte) []byte {
-	length := defaultHashFunction.Len() / 8
-	hash, err := defaultHashFunction.Hash(key)
-	if err != nil {
-		return nil
-	}
-	if len(hash) < length {
-		panic("hash function output is too short, maxlevels is too high")
-	}
-	return hash[:length]
+	return HashAndTrunkKey(defaultHashFunction, key)
 }
 
-// HashLen returns the length of the hash function output in bytes.
+// HashLen returns the length of the default hash function output in bytes.
+// Use CensusRef.HashLen for the leaves of a given census.
 func (c *CensusDB) HashLen() int {
 	return defaultHashFunction.Len()
 }
@@ -212,12 +276,18 @@ func (c *CensusDB) loadCensusRef(censusID uuid.UUID) (*CensusRef, error) {
 	c.mu.RLock()
 	if ref, exists := c.loadedCensus[censusID]; exists {
 		c.mu.RUnlock()
+		ref.touch()
 		return ref, nil
 	}
 	c.mu.RUnlock()
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	// the census might have been loaded while waiting for the lock
+	if ref, exists := c.loadedCensus[censusID]; exists {
+		ref.touch()
+		return ref, nil
+	}
 
 	key := append([]byte(censusDBreferencePrefix), censusID[:]...)
 	b, err := c.db.Get(key)
@@ -233,15 +303,23 @@ func (c *CensusDB) loadCensusRef(censusID uuid.UUID) (*CensusRef, error) {
 		return nil, err
 	}
 
+	hashFn, err := HashFunction(ref.HashType)
+	if err != nil {
+		return nil, err
+	}
+	treeDB := prefixeddb.NewPrefixedDatabase(c.db, censusPrefix(censusID))
 	tree, err := arbo.NewTree(arbo.Config{
-		Database:     prefixeddb.NewPrefixedDatabase(c.db, censusPrefix(censusID)),
+		Database:     treeDB,
 		MaxLevels:    ref.MaxLevels,
-		HashFunction: defaultHashFunction,
+		HashFunction: hashFn,
 	})
 	if err != nil {
 		return nil, err
 	}
+	ref.hashFunction = hashFn
 	ref.tree = tree
+	ref.treeDB = treeDB
+	ref.treeMu = c.treeLock(censusID)
 	root, err := tree.Root()
 	if err != nil {
 		return nil, err
@@ -263,8 +341,39 @@ func (c *CensusDB) loadCensusRef(censusID uuid.UUID) (*CensusRef, error) {
 	return &ref, nil
 }
 
-// Del removes a census from the database and memory.
+// treeLock returns the tree mutex of the census provided, creating it if the
+// census has not been loaded yet. The caller must hold the lock.
+func (c *CensusDB) treeLock(censusID uuid.UUID) *sync.Mutex {
+	mu, exists := c.treeLocks[censusID]
+	if !exists {
+		mu = &sync.Mutex{}
+		c.treeLocks[censusID] = mu
+	}
+	return mu
+}
+
+// Del removes a census from the database and memory. It returns
+// ErrCensusRootsRetained if any root of the census is still retained.
 func (c *CensusDB) Del(censusID uuid.UUID) error {
+	if retained := c.RetainedRoots(censusID); len(retained) > 0 {
+		return fmt.Errorf("%w: %d roots", ErrCensusRootsRetained, len(retained))
+	}
+	if err := c.remove(censusID); err != nil {
+		return err
+	}
+
+	go func(id uuid.UUID) {
+		if _, err := deleteCensusTreeFromDatabase(c.db, censusPrefix(id)); err != nil {
+			log.Warnw("error deleting census tree", "id", hex.EncodeToString(id[:]), "err", err)
+		}
+	}(censusID)
+
+	return nil
+}
+
+// remove removes the reference of a census from the database and memory,
+// without removing its tree.
+func (c *CensusDB) remove(censusID uuid.UUID) error {
 	key := append([]byte(censusDBreferencePrefix), censusID[:]...)
 	wtx := c.db.WriteTx()
 	if err := wtx.Delete(key); err != nil {
@@ -277,17 +386,14 @@ func (c *CensusDB) Del(censusID uuid.UUID) error {
 
 	c.mu.Lock()
 	if ref, exists := c.loadedCensus[censusID]; exists {
-		delete(c.rootIndex, rootKey(ref.currentRoot))
+		// the root might be indexed for another census with the same root
+		if rk := rootKey(ref.currentRoot); c.rootIndex[rk] == censusID {
+			delete(c.rootIndex, rk)
+		}
 		delete(c.loadedCensus, censusID)
 	}
+	delete(c.treeLocks, censusID)
 	c.mu.Unlock()
-
-	go func(id uuid.UUID) {
-		if _, err := deleteCensusTreeFromDatabase(c.db, censusPrefix(id)); err != nil {
-			log.Warnw("error deleting census tree", "id", hex.EncodeToString(id[:]), "err", err)
-		}
-	}(censusID)
-
 	return nil
 }
 
@@ -311,24 +417,33 @@ func deleteCensusTreeFromDatabase(kv db.Database, prefix []byte) (int, error) {
 }
 
 // ProofByRoot finds a census by its Merkle tree root and generates a Merkle proof for the given leafKey.
+// The root can be the current root of a census or a retained one.
 // It returns a CensusProof containing the proof components.
 func (c *CensusDB) ProofByRoot(root, leafKey []byte) (*types.CensusProof, error) {
 	rk := rootKey(root)
 	c.mu.RLock()
 	censusID, exists := c.rootIndex[rk]
 	c.mu.RUnlock()
-	if !exists {
-		return nil, fmt.Errorf("no census found with the provided root")
-	}
-	ref, err := c.Load(censusID)
-	if err != nil {
-		return nil, err
-	}
-	key, value, siblings, inclusion, err := ref.GenProof(leafKey)
-	if err != nil {
-		return nil, err
+	var key, value, siblings []byte
+	var inclusion bool
+	if exists {
+		ref, err := c.Load(censusID)
+		if err != nil {
+			return nil, err
+		}
+		if key, value, siblings, inclusion, err = ref.GenProof(leafKey); err != nil {
+			return nil, err
+		}
+	} else {
+		tree, _, err := c.snapshotTree(root)
+		if err != nil {
+			return nil, err
+		}
+		if key, value, siblings, inclusion, err = tree.GenProof(leafKey); err != nil {
+			return nil, err
+		}
 	}
-	if !inclusion {
+	if !inclusion || isTombstone(value) {
 		return nil, ErrKeyNotFound
 	}
 
@@ -341,9 +456,61 @@ func (c *CensusDB) ProofByRoot(root, leafKey []byte) (*types.CensusProof, error)
 	}, nil
 }
 
+// ProofsByRoot generates the Merkle proofs of the leaf keys provided from the
+// census tree of the given root, which is loaded once for all the keys. The
+// proofs are returned in the same order as the keys, with a nil proof for the
+// keys not found in the tree. The root can be the current root of a census or
+// a retained one. It returns ErrCensusRootNotFound if the root is unknown.
+func (c *CensusDB) ProofsByRoot(root []byte, leafKeys [][]byte) ([]*types.CensusProof, error) {
+	tree, err := c.treeByRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	proofs := make([]*types.CensusProof, len(leafKeys))
+	for i, leafKey := range leafKeys {
+		key, value, siblings, inclusion, err := tree.GenProof(leafKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not generate proof for key %x: %w", leafKey, err)
+		}
+		if !inclusion || isTombstone(value) {
+			continue
+		}
+		proofs[i] = &types.CensusProof{
+			Root:     root,
+			Key:      key,
+			Value:    value,
+			Siblings: siblings,
+			Weight:   (*types.BigInt)(arbo.BytesToBigInt(value)),
+		}
+	}
+	return proofs, nil
+}
+
+// treeByRoot returns a read-only census tree at the root provided, which can
+// be the current root of a census or a retained one. It returns
+// ErrCensusRootNotFound if the root is unknown.
+func (c *CensusDB) treeByRoot(root []byte) (*arbo.Tree, error) {
+	c.mu.RLock()
+	censusID, exists := c.rootIndex[rootKey(root)]
+	c.mu.RUnlock()
+	if !exists {
+		tree, _, err := c.snapshotTree(root)
+		return tree, err
+	}
+	ref, err := c.Load(censusID)
+	if err != nil {
+		return nil, err
+	}
+	ref.treeMu.Lock()
+	defer ref.treeMu.Unlock()
+	// the nodes of the root are kept even if the tree has been modified since
+	// the root was indexed
+	return ref.tree.Snapshot(root)
+}
+
 // VerifyProof checks the validity of a Merkle proof.
 func (c *CensusDB) VerifyProof(proof *types.CensusProof) bool {
-	if proof == nil {
+	if proof == nil || isTombstone(proof.Value) {
 		return false
 	}
 	// if weight is available, check it
@@ -352,17 +519,51 @@ func (c *CensusDB) VerifyProof(proof *types.CensusProof) bool {
 			return false
 		}
 	}
-	return VerifyProof(proof.Key, proof.Value, proof.Root, proof.Siblings)
+	hashFn, err := c.HashFunctionByRoot(proof.Root)
+	if err != nil {
+		// the census of the root is unknown, which happens with the external
+		// censuses, so the default hash function is assumed
+		hashFn = defaultHashFunction
+	}
+	return verifyProof(hashFn, proof.Key, proof.Value, proof.Root, proof.Siblings)
+}
+
+// HashFunctionByRoot returns the hash function of the census of the root
+// provided, which can be the current root of a census or a retained one. It
+// returns ErrCensusRootNotFound if the root is unknown.
+func (c *CensusDB) HashFunctionByRoot(root []byte) (arbo.HashFunction, error) {
+	rk := rootKey(root)
+	c.mu.RLock()
+	censusID, exists := c.rootIndex[rk]
+	if !exists {
+		if snapshot, ok := c.snapshots[rk]; ok {
+			censusID, exists = snapshot.CensusID, true
+		}
+	}
+	c.mu.RUnlock()
+	if !exists {
+		return nil, ErrCensusRootNotFound
+	}
+	ref, err := c.Load(censusID)
+	if err != nil {
+		return nil, err
+	}
+	return ref.HashFunction(), nil
 }
 
 // SizeByRoot returns the number of leaves in the Merkle tree with the given root.
+// The root can be the current root of a census or a retained one.
 func (c *CensusDB) SizeByRoot(root []byte) (int, error) {
 	rk := rootKey(root)
 	c.mu.RLock()
 	censusID, exists := c.rootIndex[rk]
 	c.mu.RUnlock()
 	if !exists {
-		return 0, fmt.Errorf("no census found with the provided root")
+		snapshot, err := c.Snapshot(root)
+		if err != nil {
+			return 0, err
+		}
+		return snapshot.Size, nil
 	}
 	ref, err := c.Load(censusID)
 	if err != nil {
@@ -371,28 +572,50 @@ func (c *CensusDB) SizeByRoot(root []byte) (int, error) {
 	return ref.Size(), nil
 }
 
-// updateRoot recalculates the Merkle tree root for a given census and updates the in‑memory index.
-// It acquires the CensusRef's treeMu before reading or writing currentRoot.
-func (c *CensusDB) updateRoot(censusID uuid.UUID, newRoot []byte) error {
+// updateRoot recalculates the Merkle tree root for the census of the
+// reference provided and updates the in‑memory index. If the census has been
+// unloaded while the reference was still held, the roots indexed for it are
+// replaced, so the census is loaded again on demand. It acquires the
+// CensusRef's treeMu before reading or writing currentRoot.
+func (c *CensusDB) updateRoot(ref *CensusRef, newRoot []byte) error {
+	censusID := ref.ID
 	newKey := rootKey(newRoot)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	ref, exists := c.loadedCensus[censusID]
-	if !exists {
+	if _, exists := c.treeLocks[censusID]; !exists {
+		// the census has been deleted
 		return ErrCensusNotFound
 	}
+	loaded, isLoaded := c.loadedCensus[censusID]
+	if isLoaded {
+		ref = loaded
+	}
 
 	ref.treeMu.Lock()
+	// Concurrent updates might be received out of order, so the latest root
+	// of the tree takes precedence over the one requested.
+	if latestRoot, err := ref.tree.Root(); err == nil && !bytes.Equal(latestRoot, newRoot) {
+		newRoot = latestRoot
+		newKey = rootKey(latestRoot)
+	}
 	oldKey := rootKey(ref.currentRoot)
-	if oldKey == newKey {
+	if isLoaded && oldKey == newKey {
 		ref.treeMu.Unlock()
 		return nil
 	}
 	ref.currentRoot = append([]byte(nil), newRoot...)
 	ref.treeMu.Unlock()
 
-	delete(c.rootIndex, oldKey)
+	if isLoaded {
+		delete(c.rootIndex, oldKey)
+	} else {
+		for rk, id := range c.rootIndex {
+			if id == censusID {
+				delete(c.rootIndex, rk)
+			}
+		}
+	}
 	c.rootIndex[newKey] = censusID
 	return nil
 }
@@ -9,6 +9,7 @@ import (
 
 	qt "github.com/frankban/quicktest"
 	"github.com/google/uuid"
+	"github.com/vocdoni/arbo"
 	"go.vocdoni.io/dvote/db"
 	"go.vocdoni.io/dvote/db/metadb"
 )
@@ -440,3 +441,661 @@ func TestVerifyProof(t *testing.T) {
 	ok = censusDB.VerifyProof(proof)
 	qt.Assert(t, ok, qt.IsFalse)
 }
+
+func TestRetainedRootSnapshot(t *testing.T) {
+	t.Parallel()
+	db := newDatabase(t)
+	censusDB := NewCensusDB(db)
+	censusID := uuid.New()
+	ref, err := censusDB.New(censusID)
+	qt.Assert(t, err, qt.IsNil)
+
+	// Insert the first participants and retain the root for two processes.
+	for i := 0; i < 3; i++ {
+		qt.Assert(t, ref.Insert([]byte(fmt.Sprintf("key%d", i)), []byte{byte(i + 1)}), qt.IsNil)
+	}
+	oldRoot := ref.Root()
+	snapshot, err := censusDB.RetainRoot(oldRoot, []byte("process1"))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, snapshot.Size, qt.Equals, 3)
+	qt.Assert(t, snapshot.CensusID, qt.Equals, censusID)
+	_, err = censusDB.RetainRoot(oldRoot, []byte("process2"))
+	qt.Assert(t, err, qt.IsNil)
+	// retaining twice with the same holder has no effect
+	snapshot, err = censusDB.RetainRoot(oldRoot, []byte("process2"))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, snapshot.Holders, qt.HasLen, 2)
+
+	// Append more participants, superseding the retained root.
+	qt.Assert(t, ref.Insert([]byte("key3"), []byte{4}), qt.IsNil)
+	newRoot := ref.Root()
+	qt.Assert(t, newRoot, qt.Not(qt.DeepEquals), oldRoot)
+
+	// The old root still works for proofs and size.
+	proof, err := censusDB.ProofByRoot(oldRoot, []byte("key1"))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, []byte(proof.Root), qt.DeepEquals, oldRoot)
+	qt.Assert(t, censusDB.VerifyProof(proof), qt.IsTrue)
+	_, err = censusDB.ProofByRoot(oldRoot, []byte("key3"))
+	qt.Assert(t, err, qt.ErrorIs, ErrKeyNotFound)
+	size, err := censusDB.SizeByRoot(oldRoot)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, size, qt.Equals, 3)
+	size, err = censusDB.SizeByRoot(newRoot)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, size, qt.Equals, 4)
+
+	// The snapshots survive a restart.
+	censusDB2 := NewCensusDB(db)
+	proof, err = censusDB2.ProofByRoot(oldRoot, []byte("key2"))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, censusDB2.VerifyProof(proof), qt.IsTrue)
+
+	// A census with retained roots cannot be deleted.
+	qt.Assert(t, censusDB.Del(censusID), qt.ErrorIs, ErrCensusRootsRetained)
+
+	// The root is available until every holder releases it.
+	qt.Assert(t, censusDB.ReleaseRoot(oldRoot, []byte("process1")), qt.IsNil)
+	_, err = censusDB.SizeByRoot(oldRoot)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, censusDB.ReleaseRoot(oldRoot, []byte("process2")), qt.IsNil)
+	_, err = censusDB.SizeByRoot(oldRoot)
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusRootNotFound)
+	_, err = censusDB.ProofByRoot(oldRoot, []byte("key1"))
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusRootNotFound)
+	qt.Assert(t, censusDB.RetainedRoots(censusID), qt.HasLen, 0)
+
+	// Superseded roots cannot be retained and unknown roots are reported.
+	_, err = censusDB.RetainRoot(oldRoot, []byte("process3"))
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusRootNotFound)
+}
+
+func TestPublishCensus(t *testing.T) {
+	t.Parallel()
+	db := newDatabase(t)
+	censusDB := NewCensusDB(db)
+	censusID := uuid.New()
+	ref, err := censusDB.New(censusID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ref.Insert([]byte("key1"), []byte{1}), qt.IsNil)
+	qt.Assert(t, ref.Insert([]byte("key2"), []byte{2}), qt.IsNil)
+	root := ref.Root()
+
+	// unpublished censuses are not accepted
+	_, err = censusDB.PublishedCensus(root)
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusNotPublished)
+
+	published, err := censusDB.Publish(censusID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, published.IsLocked(), qt.IsTrue)
+	qt.Assert(t, published.PublishedRoot, qt.DeepEquals, root)
+	qt.Assert(t, published.PublishedSize, qt.Equals, 2)
+	qt.Assert(t, published.PublishedAt.IsZero(), qt.IsFalse)
+	publishedAt := published.PublishedAt
+
+	// write operations are rejected
+	qt.Assert(t, ref.Insert([]byte("key3"), []byte{3}), qt.ErrorIs, ErrCensusIsLocked)
+	_, err = ref.InsertBatch([][]byte{[]byte("key3")}, [][]byte{{3}})
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusIsLocked)
+	qt.Assert(t, ref.Root(), qt.DeepEquals, root)
+
+	// publishing again has no effect
+	published, err = censusDB.Publish(censusID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, published.PublishedAt, qt.Equals, publishedAt)
+
+	// publishing again retains the root if it was not retained
+	qt.Assert(t, censusDB.ReleaseRoot(root, publishHolder(censusID)), qt.IsNil)
+	_, err = censusDB.PublishedCensus(root)
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusNotPublished)
+	published, err = censusDB.Publish(censusID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, published.PublishedAt, qt.Equals, publishedAt)
+
+	// the published census is found by its root, also after a restart
+	found, err := censusDB.PublishedCensus(root)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, found.ID, qt.Equals, censusID)
+	censusDB2 := NewCensusDB(db)
+	found, err = censusDB2.PublishedCensus(root)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, found.IsLocked(), qt.IsTrue)
+	qt.Assert(t, found.PublishedAt.Equal(publishedAt), qt.IsTrue)
+	qt.Assert(t, found.Insert([]byte("key3"), []byte{3}), qt.ErrorIs, ErrCensusIsLocked)
+	proof, err := censusDB2.ProofByRoot(root, []byte("key2"))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, censusDB2.VerifyProof(proof), qt.IsTrue)
+	size, err := censusDB2.SizeByRoot(root)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, size, qt.Equals, 2)
+}
+
+func TestCensusAuthToken(t *testing.T) {
+	t.Parallel()
+	db := newDatabase(t)
+	censusDB := NewCensusDB(db)
+	censusID := uuid.New()
+	ref, token, err := censusDB.NewWithAuthToken(censusID, "")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, token, qt.Not(qt.Equals), "")
+	qt.Assert(t, ref.AuthTokenHash, qt.Not(qt.DeepEquals), []byte(token))
+
+	qt.Assert(t, ref.CheckAuthToken(token), qt.IsNil)
+	qt.Assert(t, ref.CheckAuthToken(""), qt.ErrorIs, ErrWrongAuthenticationToken)
+	qt.Assert(t, ref.CheckAuthToken(token+"00"), qt.ErrorIs, ErrWrongAuthenticationToken)
+
+	// the token hash is persisted
+	ref2, err := NewCensusDB(db).Load(censusID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ref2.CheckAuthToken(token), qt.IsNil)
+
+	// censuses created without a token cannot be managed with one
+	ref3, err := censusDB.New(uuid.New())
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ref3.CheckAuthToken(token), qt.ErrorIs, ErrWrongAuthenticationToken)
+}
+
+func TestIterateLeavesPagination(t *testing.T) {
+	t.Parallel()
+	censusDB := NewCensusDB(newDatabase(t))
+	ref, err := censusDB.New(uuid.New())
+	qt.Assert(t, err, qt.IsNil)
+
+	keys := [][]byte{}
+	values := [][]byte{}
+	expected := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("participant-%d", i))
+		keys = append(keys, key)
+		values = append(values, []byte{byte(i + 1)})
+		expected[string(key)] = true
+	}
+	invalid, err := ref.InsertBatch(keys, values)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, invalid, qt.HasLen, 0)
+
+	// all the leaves in a single iteration
+	all := [][]byte{}
+	qt.Assert(t, ref.IterateLeaves(nil, func(key, _ []byte) bool {
+		all = append(all, key)
+		return true
+	}), qt.IsNil)
+	qt.Assert(t, all, qt.HasLen, len(keys))
+	for _, key := range all {
+		qt.Assert(t, expected[string(key)], qt.IsTrue)
+	}
+
+	// the same leaves, in the same order, requested by pages
+	for _, pageSize := range []int{1, 7, 33, 100} {
+		paged := [][]byte{}
+		var cursor []byte
+		for {
+			page := [][]byte{}
+			qt.Assert(t, ref.IterateLeaves(cursor, func(key, _ []byte) bool {
+				page = append(page, key)
+				return len(page) < pageSize
+			}), qt.IsNil)
+			paged = append(paged, page...)
+			if len(page) < pageSize {
+				break
+			}
+			cursor = page[len(page)-1]
+		}
+		qt.Assert(t, paged, qt.DeepEquals, all, qt.Commentf("page size %d", pageSize))
+	}
+}
+
+func TestUpdateAndDeleteBatch(t *testing.T) {
+	t.Parallel()
+	censusDB := NewCensusDB(newDatabase(t))
+	ref, err := censusDB.New(uuid.New())
+	qt.Assert(t, err, qt.IsNil)
+
+	keys := [][]byte{}
+	values := [][]byte{}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("participant-%d", i)))
+		values = append(values, []byte{byte(i + 1)})
+	}
+	invalid, err := ref.InsertBatch(keys, values)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, invalid, qt.HasLen, 0)
+	initialRoot := ref.Root()
+	_, err = censusDB.RetainRoot(initialRoot, []byte("holder"))
+	qt.Assert(t, err, qt.IsNil)
+
+	// update two existing keys and a missing one
+	invalid, err = ref.UpdateBatch(
+		[][]byte{keys[0], []byte("missing"), keys[1]},
+		[][]byte{{100}, {100}, {101}},
+	)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, invalid, qt.HasLen, 1)
+	qt.Assert(t, invalid[0].Index, qt.Equals, 1)
+	qt.Assert(t, invalid[0].Error, qt.ErrorIs, ErrKeyNotFound)
+	_, value, _, inclusion, err := ref.GenProof(keys[1])
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, inclusion, qt.IsTrue)
+	qt.Assert(t, value[0], qt.Equals, byte(101))
+	qt.Assert(t, ref.Size(), qt.Equals, 10)
+	updatedRoot := ref.Root()
+	qt.Assert(t, updatedRoot, qt.Not(qt.DeepEquals), initialRoot)
+	_, err = censusDB.ProofByRoot(updatedRoot, keys[0])
+	qt.Assert(t, err, qt.IsNil)
+
+	// delete two existing keys and a missing one
+	invalid, err = ref.DeleteBatch([][]byte{keys[2], []byte("missing"), keys[3]})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, invalid, qt.HasLen, 1)
+	qt.Assert(t, invalid[0].Index, qt.Equals, 1)
+	qt.Assert(t, ref.Size(), qt.Equals, 8)
+	_, _, _, inclusion, err = ref.GenProof(keys[2])
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, inclusion, qt.IsFalse)
+	_, value, _, inclusion, err = ref.GenProof(keys[0])
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, inclusion, qt.IsTrue)
+	qt.Assert(t, value[0], qt.Equals, byte(100))
+
+	// the removed keys are neither proven nor iterated
+	_, err = censusDB.ProofByRoot(ref.Root(), keys[2])
+	qt.Assert(t, err, qt.ErrorIs, ErrKeyNotFound)
+	listed := 0
+	qt.Assert(t, ref.IterateLeaves(nil, func(key, _ []byte) bool {
+		qt.Assert(t, key, qt.Not(qt.DeepEquals), keys[2])
+		listed++
+		return true
+	}), qt.IsNil)
+	qt.Assert(t, listed, qt.Equals, 8)
+	// and they cannot be updated or removed again
+	invalid, err = ref.UpdateBatch([][]byte{keys[2]}, [][]byte{{1}})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, invalid[0].Error, qt.ErrorIs, ErrKeyNotFound)
+	invalid, err = ref.DeleteBatch([][]byte{keys[2]})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, invalid[0].Error, qt.ErrorIs, ErrKeyNotFound)
+
+	// a removed key can be inserted again
+	invalid, err = ref.InsertBatch([][]byte{keys[2], []byte("new")}, [][]byte{{42}, {43}})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, invalid, qt.HasLen, 0)
+	qt.Assert(t, ref.Size(), qt.Equals, 10)
+	_, value, _, inclusion, err = ref.GenProof(keys[2])
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, inclusion, qt.IsTrue)
+	qt.Assert(t, value[0], qt.Equals, byte(42))
+	invalid, err = ref.DeleteBatch([][]byte{keys[2], []byte("new")})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, invalid, qt.HasLen, 0)
+	qt.Assert(t, ref.Size(), qt.Equals, 8)
+
+	// the removed keys are kept by the exported census
+	dump, err := censusDB.Export(ref.ID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, dump.Size, qt.Equals, 8)
+	imported, err := censusDB.Import(uuid.New(), dump)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, imported.Size(), qt.Equals, 8)
+
+	// the retained root still provides proofs of the removed keys
+	proof, err := censusDB.ProofByRoot(initialRoot, keys[2])
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, VerifyProof(proof.Key, proof.Value, proof.Root, proof.Siblings), qt.IsTrue)
+
+	// removing every leaf leaves an empty tree
+	_, err = ref.DeleteBatch(keys)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ref.Size(), qt.Equals, 0)
+
+	// locked censuses cannot be modified
+	_, err = ref.InsertBatch(keys[:1], values[:1])
+	qt.Assert(t, err, qt.IsNil)
+	_, err = censusDB.Publish(ref.ID)
+	qt.Assert(t, err, qt.IsNil)
+	_, err = ref.UpdateBatch(keys[:1], values[:1])
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusIsLocked)
+	_, err = ref.DeleteBatch(keys[:1])
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusIsLocked)
+}
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+	censusDB := NewCensusDB(newDatabase(t))
+	ref, err := censusDB.New(uuid.New())
+	qt.Assert(t, err, qt.IsNil)
+	keys := [][]byte{}
+	values := [][]byte{}
+	for i := 0; i < 20; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("participant-%d", i)))
+		values = append(values, []byte{byte(i + 1)})
+	}
+	_, err = ref.InsertBatch(keys, values)
+	qt.Assert(t, err, qt.IsNil)
+
+	dump, err := censusDB.Export(ref.ID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, []byte(dump.Root), qt.DeepEquals, ref.Root())
+	qt.Assert(t, dump.Size, qt.Equals, 20)
+
+	// import the dump in another database
+	otherDB := NewCensusDB(newDatabase(t))
+	qt.Assert(t, otherDB.KnownRoot(dump.Root), qt.IsFalse)
+	imported, err := otherDB.Import(uuid.New(), dump)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, imported.Root(), qt.DeepEquals, ref.Root())
+	qt.Assert(t, imported.Size(), qt.Equals, 20)
+	qt.Assert(t, otherDB.KnownRoot(dump.Root), qt.IsTrue)
+	proof, err := otherDB.ProofByRoot(dump.Root, keys[3])
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, otherDB.VerifyProof(proof), qt.IsTrue)
+
+	// a dump with a wrong root is rejected and the census is removed
+	tampered := *dump
+	tampered.Root = make([]byte, len(dump.Root))
+	censusID := uuid.New()
+	_, err = otherDB.Import(censusID, &tampered)
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusRootMismatch)
+	qt.Assert(t, otherDB.Exists(censusID), qt.IsFalse)
+
+	// a dump with an unsupported hash is rejected
+	tampered = *dump
+	tampered.HashType = "unknown"
+	_, err = otherDB.Import(uuid.New(), &tampered)
+	qt.Assert(t, err, qt.ErrorIs, ErrInvalidCensusDump)
+}
+
+func TestCensusHashType(t *testing.T) {
+	t.Parallel()
+	database := newDatabase(t)
+	censusDB := NewCensusDB(database)
+
+	_, err := censusDB.NewWithHashType(uuid.New(), "unknown")
+	qt.Assert(t, err, qt.ErrorIs, ErrUnsupportedHashType)
+
+	key := []byte("participant")
+	value := []byte{1}
+	roots := map[string][]byte{}
+	ids := map[string]uuid.UUID{}
+	for _, hashType := range SupportedHashTypes() {
+		ref, err := censusDB.NewWithHashType(uuid.New(), hashType)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, ref.HashType, qt.Equals, hashType)
+		qt.Assert(t, string(ref.HashFunction().Type()), qt.Equals, hashType)
+		qt.Assert(t, ref.Insert(key, value), qt.IsNil)
+		roots[hashType] = ref.Root()
+		ids[hashType] = ref.ID
+	}
+	// every hash function produces a different root for the same leaves
+	qt.Assert(t, roots, qt.HasLen, 4)
+	seen := map[string]bool{}
+	for _, root := range roots {
+		qt.Assert(t, seen[string(root)], qt.IsFalse)
+		seen[string(root)] = true
+	}
+
+	// the hash type is honored on load and by the proof verification
+	otherDB := NewCensusDB(database)
+	for hashType, root := range roots {
+		ref, err := otherDB.Load(ids[hashType])
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, string(ref.HashFunction().Type()), qt.Equals, hashType)
+		qt.Assert(t, ref.Root(), qt.DeepEquals, root)
+
+		proof, err := otherDB.ProofByRoot(root, key)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, otherDB.VerifyProof(proof), qt.IsTrue)
+		qt.Assert(t, ref.VerifyProof(proof.Key, proof.Value, proof.Root, proof.Siblings), qt.IsTrue)
+		if hashType != DefaultHashType {
+			qt.Assert(t, VerifyProof(proof.Key, proof.Value, proof.Root, proof.Siblings), qt.IsFalse)
+		}
+	}
+
+	// the dumps keep the hash type
+	dump, err := otherDB.Export(ids[string(arbo.HashFunctionPoseidon.Type())])
+	qt.Assert(t, err, qt.IsNil)
+	imported, err := NewCensusDB(newDatabase(t)).Import(uuid.New(), dump)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, imported.HashType, qt.Equals, dump.HashType)
+	qt.Assert(t, imported.Root(), qt.DeepEquals, []byte(dump.Root))
+}
+
+func TestProofsByRoot(t *testing.T) {
+	t.Parallel()
+	censusDB := NewCensusDB(newDatabase(t))
+	ref, err := censusDB.New(uuid.New())
+	qt.Assert(t, err, qt.IsNil)
+	keys := [][]byte{}
+	values := [][]byte{}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("participant-%d", i)))
+		values = append(values, []byte{byte(i + 1)})
+	}
+	_, err = ref.InsertBatch(keys, values)
+	qt.Assert(t, err, qt.IsNil)
+	root := ref.Root()
+
+	_, err = censusDB.ProofsByRoot([]byte("unknown"), keys)
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusRootNotFound)
+
+	requested := [][]byte{keys[1], []byte("missing"), keys[7]}
+	proofs, err := censusDB.ProofsByRoot(root, requested)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, proofs, qt.HasLen, 3)
+	qt.Assert(t, proofs[1], qt.IsNil)
+	for _, i := range []int{0, 2} {
+		qt.Assert(t, proofs[i], qt.IsNotNil)
+		qt.Assert(t, []byte(proofs[i].Key), qt.DeepEquals, requested[i])
+		qt.Assert(t, censusDB.VerifyProof(proofs[i]), qt.IsTrue)
+	}
+
+	// the proofs of a retained root are generated from that root, even
+	// after the census is modified
+	_, err = censusDB.RetainRoot(root, []byte("holder"))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ref.Insert([]byte("late"), []byte{1}), qt.IsNil)
+	proofs, err = censusDB.ProofsByRoot(root, [][]byte{[]byte("late"), keys[1]})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, proofs[0], qt.IsNil)
+	qt.Assert(t, proofs[1], qt.IsNotNil)
+	proofs, err = censusDB.ProofsByRoot(ref.Root(), [][]byte{[]byte("late")})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, proofs[0], qt.IsNotNil)
+}
+
+func TestSweep(t *testing.T) {
+	t.Parallel()
+	censusDB := NewCensusDB(newDatabase(t))
+
+	newCensus := func(key string) *CensusRef {
+		ref, err := censusDB.New(uuid.New())
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, ref.Insert([]byte(key), []byte{1}), qt.IsNil)
+		return ref
+	}
+	active := newCensus("active")
+	abandoned := newCensus("abandoned")
+	published := newCensus("published")
+	_, err := censusDB.Publish(published.ID)
+	qt.Assert(t, err, qt.IsNil)
+	retained := newCensus("retained")
+	_, err = censusDB.RetainRoot(retained.Root(), []byte("holder"))
+	qt.Assert(t, err, qt.IsNil)
+	referenced := newCensus("referenced")
+	referencedRoot := referenced.Root()
+
+	// only the idle censuses are unloaded
+	past := time.Now().Add(-time.Hour)
+	for _, ref := range []*CensusRef{abandoned, published, retained, referenced} {
+		ref.LastUsed = past
+	}
+	conf := SweepConfig{
+		IdleTimeout: time.Minute,
+		Retention:   30 * time.Minute,
+		ReferencedRoots: func() ([][]byte, error) {
+			return [][]byte{referencedRoot}, nil
+		},
+	}
+	report, err := censusDB.Sweep(conf)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, report.Unloaded, qt.HasLen, 4)
+	qt.Assert(t, censusDB.LastSweepReport(), qt.Equals, report)
+
+	// the abandoned census is deleted once unloaded, the rest are kept
+	qt.Assert(t, report.Deleted, qt.DeepEquals, []uuid.UUID{abandoned.ID})
+	qt.Assert(t, report.DeletedKeys > 1, qt.IsTrue)
+	qt.Assert(t, censusDB.Exists(abandoned.ID), qt.IsFalse)
+	for _, ref := range []*CensusRef{active, published, retained, referenced} {
+		qt.Assert(t, censusDB.Exists(ref.ID), qt.IsTrue)
+	}
+
+	// the unloaded censuses are loaded again on demand, by ID or by root
+	reloaded, err := censusDB.Load(referenced.ID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, reloaded, qt.Not(qt.Equals), referenced)
+	qt.Assert(t, reloaded.Root(), qt.DeepEquals, referencedRoot)
+	qt.Assert(t, time.Since(reloaded.LastUsed) < time.Minute, qt.IsTrue)
+	proof, err := censusDB.ProofByRoot(retained.Root(), []byte("retained"))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, censusDB.VerifyProof(proof), qt.IsTrue)
+
+	// a failure getting the referenced roots prevents any deletion
+	conf.ReferencedRoots = func() ([][]byte, error) {
+		return nil, fmt.Errorf("unavailable")
+	}
+	_, err = censusDB.Sweep(conf)
+	qt.Assert(t, err, qt.ErrorMatches, ".*unavailable")
+}
+
+func TestSweepThenRetainRoot(t *testing.T) {
+	t.Parallel()
+	censusDB := NewCensusDB(newDatabase(t))
+	ref, err := censusDB.New(uuid.New())
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ref.Insert([]byte("key1"), []byte{1}), qt.IsNil)
+	root := ref.Root()
+
+	time.Sleep(5 * time.Millisecond)
+	report, err := censusDB.Sweep(SweepConfig{IdleTimeout: time.Millisecond})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, report.Unloaded, qt.DeepEquals, []uuid.UUID{ref.ID})
+
+	// the root of the unloaded census is retained after loading it again
+	snapshot, err := censusDB.RetainRoot(root, []byte("holder"))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, snapshot.CensusID, qt.Equals, ref.ID)
+	qt.Assert(t, snapshot.Size, qt.Equals, 1)
+
+	// the reference held during the sweep still updates the root index
+	_, err = censusDB.Sweep(SweepConfig{IdleTimeout: time.Nanosecond})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ref.Insert([]byte("key2"), []byte{2}), qt.IsNil)
+	newRoot := ref.Root()
+	qt.Assert(t, censusDB.KnownRoot(newRoot), qt.IsTrue)
+	size, err := censusDB.SizeByRoot(newRoot)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, size, qt.Equals, 2)
+
+	// the references loaded again share the tree lock with the held one
+	reloaded, err := censusDB.Load(ref.ID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, reloaded, qt.Not(qt.Equals), ref)
+	qt.Assert(t, reloaded.treeMu, qt.Equals, ref.treeMu)
+	qt.Assert(t, reloaded.Root(), qt.DeepEquals, newRoot)
+}
+
+func TestDerive(t *testing.T) {
+	t.Parallel()
+	censusDB := NewCensusDB(newDatabase(t))
+	newSource := func(weights map[string]byte) *CensusRef {
+		ref, err := censusDB.New(uuid.New())
+		qt.Assert(t, err, qt.IsNil)
+		for key, weight := range weights {
+			qt.Assert(t, ref.Insert([]byte(key), []byte{weight}), qt.IsNil)
+		}
+		return ref
+	}
+	a := newSource(map[string]byte{"alice": 1, "bob": 2, "carol": 3})
+	b := newSource(map[string]byte{"bob": 5, "carol": 1, "dave": 4})
+	c := newSource(map[string]byte{"carol": 2, "erin": 1})
+	leaves := func(ref *CensusRef) map[string]int64 {
+		res := map[string]int64{}
+		qt.Assert(t, ref.IterateLeaves(nil, func(key, value []byte) bool {
+			res[string(key)] = arbo.BytesToBigInt(value).Int64()
+			return true
+		}), qt.IsNil)
+		return res
+	}
+	derive := func(op SetOperation, rule WeightRule, sources ...*CensusRef) *CensusRef {
+		opts := DeriveOptions{Operation: op, WeightRule: rule}
+		for _, source := range sources {
+			opts.Sources = append(opts.Sources, source.ID)
+		}
+		ref, err := censusDB.Derive(uuid.New(), opts)
+		qt.Assert(t, err, qt.IsNil)
+		return ref
+	}
+
+	qt.Assert(t, leaves(derive(SetUnion, WeightFirst, a, b)), qt.DeepEquals,
+		map[string]int64{"alice": 1, "bob": 2, "carol": 3, "dave": 4})
+	qt.Assert(t, leaves(derive(SetUnion, WeightSum, a, b, c)), qt.DeepEquals,
+		map[string]int64{"alice": 1, "bob": 7, "carol": 6, "dave": 4, "erin": 1})
+	qt.Assert(t, leaves(derive(SetUnion, WeightMax, a, b)), qt.DeepEquals,
+		map[string]int64{"alice": 1, "bob": 5, "carol": 3, "dave": 4})
+	qt.Assert(t, leaves(derive(SetIntersection, WeightFirst, b, a)), qt.DeepEquals,
+		map[string]int64{"bob": 5, "carol": 1})
+	qt.Assert(t, leaves(derive(SetIntersection, WeightSum, a, b, c)), qt.DeepEquals,
+		map[string]int64{"carol": 6})
+	qt.Assert(t, leaves(derive(SetDifference, "", a, b)), qt.DeepEquals,
+		map[string]int64{"alice": 1})
+	qt.Assert(t, leaves(derive(SetDifference, "", b, a, c)), qt.DeepEquals,
+		map[string]int64{"dave": 4})
+
+	// the derived census matches a census built with the same leaves
+	expected := newSource(map[string]byte{"alice": 1, "bob": 5, "carol": 3, "dave": 4})
+	qt.Assert(t, derive(SetUnion, WeightMax, a, b).Root(), qt.DeepEquals, expected.Root())
+	// an empty result is a valid census
+	qt.Assert(t, derive(SetDifference, "", a, derive(SetUnion, WeightFirst, a, b)).Size(), qt.Equals, 0)
+
+	// a derived census issues its own management token
+	ref, token, err := censusDB.DeriveWithAuthToken(uuid.New(),
+		DeriveOptions{Operation: SetUnion, Sources: []uuid.UUID{a.ID, b.ID}})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ref.CheckAuthToken(token), qt.IsNil)
+
+	// invalid derivations
+	for _, opts := range []DeriveOptions{
+		{Operation: SetUnion, Sources: []uuid.UUID{a.ID}},
+		{Operation: SetUnion, Sources: []uuid.UUID{a.ID, a.ID}},
+		{Operation: "xor", Sources: []uuid.UUID{a.ID, b.ID}},
+		{Operation: SetUnion, WeightRule: "min", Sources: []uuid.UUID{a.ID, b.ID}},
+	} {
+		_, err := censusDB.Derive(uuid.New(), opts)
+		qt.Assert(t, err, qt.ErrorIs, ErrInvalidDerivation)
+	}
+	_, err = censusDB.Derive(uuid.New(), DeriveOptions{Operation: SetUnion, Sources: []uuid.UUID{a.ID, uuid.New()}})
+	qt.Assert(t, err, qt.ErrorIs, ErrCensusNotFound)
+	poseidon, err := censusDB.NewWithHashType(uuid.New(), string(arbo.HashFunctionPoseidon.Type()))
+	qt.Assert(t, err, qt.IsNil)
+	_, err = censusDB.Derive(uuid.New(), DeriveOptions{Operation: SetUnion, Sources: []uuid.UUID{a.ID, poseidon.ID}})
+	qt.Assert(t, err, qt.ErrorIs, ErrInvalidDerivation)
+}
+
+func TestCensusStats(t *testing.T) {
+	t.Parallel()
+	censusDB := NewCensusDB(newDatabase(t))
+	stats, err := censusDB.Stats()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, stats, qt.DeepEquals, &Stats{})
+
+	ref, err := censusDB.New(uuid.New())
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ref.Insert([]byte("key1"), []byte{1}), qt.IsNil)
+	_, err = censusDB.New(uuid.New())
+	qt.Assert(t, err, qt.IsNil)
+	_, err = censusDB.Publish(ref.ID)
+	qt.Assert(t, err, qt.IsNil)
+
+	stats, err = censusDB.Stats()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, stats, qt.DeepEquals, &Stats{Stored: 2, Loaded: 2, Published: 1, RetainedRoots: 1})
+}
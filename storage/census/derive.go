@@ -0,0 +1,254 @@
+package census
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/google/uuid"
+	"github.com/vocdoni/arbo"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+)
+
+// ErrInvalidDerivation is returned by Derive() if the census cannot be
+// derived from the sources and options provided.
+var ErrInvalidDerivation = fmt.Errorf("invalid census derivation")
+
+// SetOperation is the set operation used to derive a census from others.
+type SetOperation string
+
+const (
+	// SetUnion derives a census with the participants of any of the sources.
+	SetUnion SetOperation = "union"
+	// SetIntersection derives a census with the participants of all the
+	// sources.
+	SetIntersection SetOperation = "intersection"
+	// SetDifference derives a census with the participants of the first
+	// source that are not in any of the rest.
+	SetDifference SetOperation = "difference"
+)
+
+// WeightRule is the rule used to combine the weights of the participants of
+// a derived census that are in more than one of its sources.
+type WeightRule string
+
+const (
+	// WeightFirst takes the weight of the first source that contains the
+	// participant, in the order of the sources. It is the default rule.
+	WeightFirst WeightRule = "first"
+	// WeightSum sums the weights of all the sources that contain the
+	// participant.
+	WeightSum WeightRule = "sum"
+	// WeightMax takes the highest weight of the sources that contain the
+	// participant.
+	WeightMax WeightRule = "max"
+)
+
+// DeriveOptions defines how a census is derived from others.
+type DeriveOptions struct {
+	Operation  SetOperation
+	WeightRule WeightRule
+	// Sources are the IDs of the censuses to derive from, at least two and
+	// sharing the same hash type, so the keys of the same participant match.
+	Sources []uuid.UUID
+}
+
+// Derive creates a new census with the ID provided and the participants
+// resulting of the set operation of the options applied to the participants
+// of the sources at their current roots. The weights of the participants in
+// several sources are combined with the weight rule of the options. The new
+// census uses the hash type of the sources. It returns ErrInvalidDerivation if
+// the options are not valid.
+func (c *CensusDB) Derive(censusID uuid.UUID, opts DeriveOptions) (*CensusRef, error) {
+	return c.derive(censusID, opts, nil)
+}
+
+// DeriveWithAuthToken derives a new census like Derive and issues a secret
+// token required to manage it, like NewWithAuthToken.
+func (c *CensusDB) DeriveWithAuthToken(censusID uuid.UUID, opts DeriveOptions) (*CensusRef, string, error) {
+	token, err := newAuthToken()
+	if err != nil {
+		return nil, "", err
+	}
+	ref, err := c.derive(censusID, opts, hashAuthToken(token))
+	if err != nil {
+		return nil, "", err
+	}
+	return ref, token, nil
+}
+
+// derive creates the census derived with the options provided, with the
+// authentication token hash provided.
+func (c *CensusDB) derive(censusID uuid.UUID, opts DeriveOptions, authTokenHash []byte) (*CensusRef, error) {
+	combine, err := weightCombiner(opts.WeightRule)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := c.deriveSources(opts.Sources)
+	if err != nil {
+		return nil, err
+	}
+	var leaves map[string][]byte
+	switch opts.Operation {
+	case SetUnion:
+		leaves, err = unionLeaves(sources, combine)
+	case SetIntersection:
+		leaves, err = intersectionLeaves(sources, combine)
+	case SetDifference:
+		leaves, err = differenceLeaves(sources)
+	default:
+		return nil, fmt.Errorf("%w: unknown set operation %q", ErrInvalidDerivation, opts.Operation)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := c.newCensus(censusID, sources[0].HashType, authTokenHash)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([][]byte, 0, len(leaves))
+	values := make([][]byte, 0, len(leaves))
+	for key, value := range leaves {
+		if len(value) > ref.HashLen() {
+			err = fmt.Errorf("%w: combined weight of %x overflows", ErrInvalidDerivation, key)
+			break
+		}
+		keys = append(keys, []byte(key))
+		values = append(values, value)
+	}
+	if err == nil && len(keys) > 0 {
+		var invalid []arbo.Invalid
+		invalid, err = ref.InsertBatch(keys, values)
+		if err == nil && len(invalid) > 0 {
+			err = fmt.Errorf("failed to insert %d derived participants", len(invalid))
+		}
+	}
+	if err != nil {
+		if dErr := c.Del(censusID); dErr != nil {
+			log.Warnw("could not delete derived census", "id", censusID.String(), "err", dErr)
+		}
+		return nil, err
+	}
+	log.Infow("census derived", "id", censusID.String(), "operation", opts.Operation,
+		"weightRule", opts.WeightRule, "sources", len(sources), "size", len(keys))
+	return ref, nil
+}
+
+// deriveSources loads the sources of a derived census and checks that there
+// are at least two, without duplicates and sharing the same hash type.
+func (c *CensusDB) deriveSources(ids []uuid.UUID) ([]*CensusRef, error) {
+	if len(ids) < 2 {
+		return nil, fmt.Errorf("%w: at least two sources are required", ErrInvalidDerivation)
+	}
+	sources := make([]*CensusRef, 0, len(ids))
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return nil, fmt.Errorf("%w: duplicated source %s", ErrInvalidDerivation, id)
+		}
+		seen[id] = true
+		ref, err := c.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		if len(sources) > 0 && ref.HashType != sources[0].HashType {
+			return nil, fmt.Errorf("%w: source %s uses hash type %s instead of %s",
+				ErrInvalidDerivation, id, ref.HashType, sources[0].HashType)
+		}
+		sources = append(sources, ref)
+	}
+	return sources, nil
+}
+
+// weightCombiner returns the function that combines the weights of a
+// participant in two sources with the rule provided. The weights are encoded
+// as the values of the census leaves.
+func weightCombiner(rule WeightRule) (func(first, other []byte) []byte, error) {
+	switch rule {
+	case WeightFirst, "":
+		return func(first, _ []byte) []byte { return first }, nil
+	case WeightSum:
+		return func(first, other []byte) []byte {
+			sum := new(big.Int).Add(arbo.BytesToBigInt(first), arbo.BytesToBigInt(other))
+			return arbo.BigIntToBytes(max(len(first), len(other), (sum.BitLen()+7)/8), sum)
+		}, nil
+	case WeightMax:
+		return func(first, other []byte) []byte {
+			if arbo.BytesToBigInt(other).Cmp(arbo.BytesToBigInt(first)) > 0 {
+				return other
+			}
+			return first
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown weight rule %q", ErrInvalidDerivation, rule)
+	}
+}
+
+// sourceLeaves returns the leaves of the census provided, indexed by key.
+func sourceLeaves(ref *CensusRef) (map[string][]byte, error) {
+	leaves := make(map[string][]byte)
+	err := ref.IterateLeaves(nil, func(key, value []byte) bool {
+		leaves[string(key)] = append([]byte{}, value...)
+		return true
+	})
+	return leaves, err
+}
+
+func unionLeaves(sources []*CensusRef, combine func(first, other []byte) []byte) (map[string][]byte, error) {
+	result, err := sourceLeaves(sources[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources[1:] {
+		err := source.IterateLeaves(nil, func(key, value []byte) bool {
+			if current, ok := result[string(key)]; ok {
+				result[string(key)] = combine(current, value)
+			} else {
+				result[string(key)] = append([]byte{}, value...)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func intersectionLeaves(sources []*CensusRef, combine func(first, other []byte) []byte) (map[string][]byte, error) {
+	result, err := sourceLeaves(sources[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources[1:] {
+		next := make(map[string][]byte)
+		err := source.IterateLeaves(nil, func(key, value []byte) bool {
+			if current, ok := result[string(key)]; ok {
+				next[string(key)] = combine(current, value)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		result = next
+	}
+	return result, nil
+}
+
+func differenceLeaves(sources []*CensusRef) (map[string][]byte, error) {
+	result, err := sourceLeaves(sources[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources[1:] {
+		err := source.IterateLeaves(nil, func(key, _ []byte) bool {
+			delete(result, string(key))
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
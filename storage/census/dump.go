@@ -0,0 +1,127 @@
+package census
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+var (
+	// ErrInvalidCensusDump is returned by Import() if the dump cannot be
+	// imported in the local database.
+	ErrInvalidCensusDump = fmt.Errorf("invalid census dump")
+	// ErrCensusRootMismatch is returned by Import() if the root of the
+	// imported tree does not match the root of the dump.
+	ErrCensusRootMismatch = fmt.Errorf("census root mismatch")
+)
+
+// CensusDump is the portable representation of a census, which contains the
+// arbo dump of the leaves of the tree and the metadata required to rebuild
+// it. It is encoded as JSON to be published, for example, in the census URI
+// of a process.
+type CensusDump struct {
+	CensusID  uuid.UUID      `json:"censusId"`
+	MaxLevels int            `json:"maxLevels"`
+	HashType  string         `json:"hashType"`
+	Root      types.HexBytes `json:"root"`
+	Size      int            `json:"size"`
+	Dump      []byte         `json:"dump"`
+}
+
+// Export returns the dump of the census provided at its current root.
+func (c *CensusDB) Export(censusID uuid.UUID) (*CensusDump, error) {
+	ref, err := c.Load(censusID)
+	if err != nil {
+		return nil, err
+	}
+	ref.treeMu.Lock()
+	defer ref.treeMu.Unlock()
+	root, err := ref.tree.Root()
+	if err != nil {
+		return nil, err
+	}
+	size, err := ref.size()
+	if err != nil {
+		return nil, err
+	}
+	dump, err := ref.tree.Dump(root)
+	if err != nil {
+		return nil, fmt.Errorf("could not dump census tree: %w", err)
+	}
+	return &CensusDump{
+		CensusID:  censusID,
+		MaxLevels: ref.MaxLevels,
+		HashType:  ref.HashType,
+		Root:      root,
+		Size:      size,
+		Dump:      dump,
+	}, nil
+}
+
+// Import creates a new census with the ID provided and the leaves of the
+// dump. The root of the rebuilt tree must match the root of the dump,
+// otherwise the census is removed and ErrCensusRootMismatch is returned.
+func (c *CensusDB) Import(censusID uuid.UUID, dump *CensusDump) (*CensusRef, error) {
+	if dump == nil {
+		return nil, fmt.Errorf("%w: nil dump", ErrInvalidCensusDump)
+	}
+	if dump.MaxLevels != types.CensusTreeMaxLevels {
+		return nil, fmt.Errorf("%w: unsupported max levels %d", ErrInvalidCensusDump, dump.MaxLevels)
+	}
+	if _, err := HashFunction(dump.HashType); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCensusDump, err)
+	}
+	ref, err := c.NewWithHashType(censusID, dump.HashType)
+	if err != nil {
+		return nil, err
+	}
+	ref.treeMu.Lock()
+	err = ref.tree.ImportDump(dump.Dump)
+	var root []byte
+	var size int
+	if err == nil {
+		err = ref.countTombstones()
+	}
+	if err == nil {
+		root, err = ref.tree.Root()
+	}
+	if err == nil {
+		size, err = ref.size()
+	}
+	ref.treeMu.Unlock()
+	if err == nil && !bytes.Equal(root, dump.Root) {
+		err = fmt.Errorf("%w: expected %x, got %x", ErrCensusRootMismatch, dump.Root, root)
+	}
+	if err == nil && dump.Size != 0 && size != dump.Size {
+		err = fmt.Errorf("%w: expected %d leaves, got %d", ErrInvalidCensusDump, dump.Size, size)
+	}
+	if err != nil {
+		if rErr := c.remove(censusID); rErr != nil {
+			log.Warnw("could not remove census after import error", "id", censusID.String(), "err", rErr)
+		} else if _, rErr := deleteCensusTreeFromDatabase(c.db, censusPrefix(censusID)); rErr != nil {
+			log.Warnw("error deleting census tree", "id", censusID.String(), "err", rErr)
+		}
+		return nil, err
+	}
+	if err := ref.sendUpdateRoot(root); err != nil {
+		return nil, err
+	}
+	log.Infow("census imported", "id", censusID.String(), "root", rootKey(root), "size", size)
+	return ref, nil
+}
+
+// KnownRoot returns true if the root provided is the current root of a
+// census or a retained one.
+func (c *CensusDB) KnownRoot(root []byte) bool {
+	rk := rootKey(root)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, exists := c.rootIndex[rk]; exists {
+		return true
+	}
+	_, exists := c.snapshots[rk]
+	return exists
+}
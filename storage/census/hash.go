@@ -0,0 +1,77 @@
+package census
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vocdoni/arbo"
+)
+
+// ErrUnsupportedHashType is returned when a census uses a hash function that
+// is not supported.
+var ErrUnsupportedHashType = fmt.Errorf("unsupported census hash type")
+
+// DefaultHashType is the hash function used by the censuses created without
+// an explicit hash type, and by the censuses created before the hash type was
+// configurable.
+var DefaultHashType = string(defaultHashFunction.Type())
+
+// ErrHashTypeNotProvable is returned when the proofs of a census cannot be
+// verified by the vote verifier circuit because of its hash function.
+var ErrHashTypeNotProvable = fmt.Errorf("census hash type cannot be proven by the circuits")
+
+// ProvableHashType returns true if the census proofs of the hash type provided
+// can be verified by the vote verifier circuit, which only supports the
+// default hash type.
+func ProvableHashType(hashType string) bool {
+	return hashType == "" || hashType == DefaultHashType
+}
+
+// hashFunctions contains the hash functions supported by the census trees,
+// indexed by their type.
+var hashFunctions = map[string]arbo.HashFunction{
+	string(arbo.HashFunctionMiMC_BLS12_377.Type()): arbo.HashFunctionMiMC_BLS12_377,
+	string(arbo.HashFunctionMiMC_BN254.Type()):     arbo.HashFunctionMiMC_BN254,
+	string(arbo.HashFunctionPoseidon.Type()):       arbo.HashFunctionPoseidon,
+	string(arbo.HashFunctionBlake2b.Type()):        arbo.HashFunctionBlake2b,
+}
+
+// HashFunction returns the census hash function of the type provided. If the
+// type is empty, the default hash function is returned. It returns
+// ErrUnsupportedHashType if the hash type is not supported.
+func HashFunction(hashType string) (arbo.HashFunction, error) {
+	if hashType == "" {
+		return defaultHashFunction, nil
+	}
+	hashFn, ok := hashFunctions[hashType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedHashType, hashType)
+	}
+	return hashFn, nil
+}
+
+// SupportedHashTypes returns the sorted list of the hash types supported by
+// the census trees.
+func SupportedHashTypes() []string {
+	types := make([]string, 0, len(hashFunctions))
+	for hashType := range hashFunctions {
+		types = append(types, hashType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// HashAndTrunkKey computes the hash of a key with the hash function provided
+// and truncates it to the required length. Returns nil if the hash function
+// fails. Panics if the hash output is too short.
+func HashAndTrunkKey(hashFn arbo.HashFunction, key []byte) []byte {
+	length := hashFn.Len() / 8
+	hash, err := hashFn.Hash(key)
+	if err != nil {
+		return nil
+	}
+	if len(hash) < length {
+		panic("hash function output is too short, maxlevels is too high")
+	}
+	return hash[:length]
+}
@@ -0,0 +1,108 @@
+package census
+
+import "github.com/vocdoni/arbo"
+
+// IterateLeaves iterates over the leaves of the census tree at its current
+// root, in the order of the tree, calling the function provided with the key
+// and the value of each leaf until it returns false. If after is not nil,
+// only the leaves placed after the leaf with that key are visited, so it can
+// be used as a cursor to paginate the leaves. The removed leaves are skipped.
+// The tree is not locked during
+// the iteration, the leaves inserted after the call are not visited.
+func (cr *CensusRef) IterateLeaves(after []byte, f func(key, value []byte) bool) error {
+	cr.treeMu.Lock()
+	root, err := cr.tree.Root()
+	if err != nil {
+		cr.treeMu.Unlock()
+		return err
+	}
+	snapshot, err := cr.tree.Snapshot(root)
+	cr.treeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return iterateLeaves(snapshot, after, f)
+}
+
+// iterateLeaves iterates over the leaves of the tree provided placed after
+// the key provided (if any), calling the function provided until it returns
+// false. The subtrees placed before the key are not visited.
+func iterateLeaves(tree *arbo.Tree, after []byte, f func(key, value []byte) bool) error {
+	// path holds the path of the current node, and visited the number of
+	// nodes visited on each level since their parent was visited, which
+	// tells if the current node is the left or the right child.
+	path := []bool{}
+	visited := map[int]int{}
+	done := false
+	return tree.IterateWithStop(nil, func(level int, _, v []byte) bool {
+		if done {
+			return true
+		}
+		if level > 1 {
+			path = append(path[:level-2], visited[level] == 1)
+			visited[level]++
+		}
+		switch v[0] {
+		case arbo.PrefixValueIntermediate:
+			visited[level+1] = 0
+			// skip the subtrees placed before the cursor
+			return after != nil && comparePathPrefix(path, after) < 0
+		case arbo.PrefixValueLeaf:
+			key, value := arbo.ReadLeafValue(v)
+			if after != nil && compareKeyPaths(key, after) <= 0 {
+				return false
+			}
+			if isTombstone(value) {
+				return false
+			}
+			if !f(key, value) {
+				done = true
+			}
+		}
+		return false
+	})
+}
+
+// keyPathBit returns the bit n of the path of the key provided, as computed
+// by arbo to place the leaves in the tree.
+func keyPathBit(key []byte, n int) bool {
+	if n/8 >= len(key) {
+		return false
+	}
+	return key[n/8]&(1<<(n%8)) != 0
+}
+
+// comparePathPrefix compares the path prefix provided with the same prefix of
+// the path of the key provided. It returns -1 if the prefix is placed before
+// the key, 0 if it contains the key and 1 if it is placed after the key.
+func comparePathPrefix(prefix []bool, key []byte) int {
+	for n, bit := range prefix {
+		if kb := keyPathBit(key, n); bit != kb {
+			if kb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// compareKeyPaths compares the paths of the keys provided, which define the
+// order of the leaves in the tree. It returns -1 if a is placed before b, 0 if
+// they have the same path and 1 if a is placed after b.
+func compareKeyPaths(a, b []byte) int {
+	bits := len(a)
+	if len(b) > bits {
+		bits = len(b)
+	}
+	for n := 0; n < bits*8; n++ {
+		ab, bb := keyPathBit(a, n), keyPathBit(b, n)
+		if ab != bb {
+			if bb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
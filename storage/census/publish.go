@@ -0,0 +1,121 @@
+package census
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+)
+
+// ErrCensusNotPublished is returned when a census root does not belong to a
+// published census.
+var ErrCensusNotPublished = fmt.Errorf("census is not published")
+
+// publishHolderPrefix is the prefix of the holders used to retain the roots
+// of the published censuses.
+const publishHolderPrefix = "published/"
+
+// publishHolder returns the holder used to retain the root of a published
+// census.
+func publishHolder(censusID uuid.UUID) []byte {
+	return append([]byte(publishHolderPrefix), censusID[:]...)
+}
+
+// Publish freezes the census provided into a read-only snapshot addressed by
+// its current root. Any later write operation over the census returns
+// ErrCensusIsLocked. It records the publish time, root and size, which are
+// available in the returned reference. The root is retained before the
+// reference is stored, so a stored published census is always addressable by
+// its root. Publishing an already published census has no effect other than
+// retaining its root again if needed.
+func (c *CensusDB) Publish(censusID uuid.UUID) (*CensusRef, error) {
+	ref, err := c.Load(censusID)
+	if err != nil {
+		return nil, err
+	}
+	ref.treeMu.Lock()
+	if !ref.PublishedAt.IsZero() {
+		root := ref.PublishedRoot
+		ref.treeMu.Unlock()
+		// a previous publish might have failed to retain the root
+		if _, err := c.RetainRoot(root, publishHolder(censusID)); err != nil {
+			return nil, fmt.Errorf("could not retain published root: %w", err)
+		}
+		return ref, nil
+	}
+	root, err := ref.tree.Root()
+	if err != nil {
+		ref.treeMu.Unlock()
+		return nil, err
+	}
+	size, err := ref.size()
+	if err != nil {
+		ref.treeMu.Unlock()
+		return nil, err
+	}
+	// the census is locked from now on, so its root cannot change
+	ref.PublishedAt = time.Now()
+	ref.PublishedRoot = root
+	ref.PublishedSize = size
+	ref.treeMu.Unlock()
+
+	// keep the published root addressable even when the census is unloaded
+	if _, err := c.RetainRoot(root, publishHolder(censusID)); err != nil {
+		ref.unpublish()
+		return nil, fmt.Errorf("could not retain published root: %w", err)
+	}
+	if err := c.writeReference(ref); err != nil {
+		if err := c.ReleaseRoot(root, publishHolder(censusID)); err != nil {
+			log.Warnw("could not release published root", "id", censusID.String(), "error", err.Error())
+		}
+		ref.unpublish()
+		return nil, fmt.Errorf("could not store published census: %w", err)
+	}
+	log.Infow("census published", "id", censusID.String(), "root", rootKey(root), "size", size)
+	return ref, nil
+}
+
+// unpublish unlocks the census of the reference after a failed publish.
+func (cr *CensusRef) unpublish() {
+	cr.treeMu.Lock()
+	defer cr.treeMu.Unlock()
+	cr.PublishedAt = time.Time{}
+	cr.PublishedRoot = nil
+	cr.PublishedSize = 0
+}
+
+// PublishedCensus returns the published census of the root provided. It
+// returns ErrCensusNotPublished if the root does not belong to a published
+// census.
+func (c *CensusDB) PublishedCensus(root []byte) (*CensusRef, error) {
+	snapshot, err := c.Snapshot(root)
+	if err != nil {
+		if errors.Is(err, ErrCensusRootNotFound) {
+			return nil, ErrCensusNotPublished
+		}
+		return nil, err
+	}
+	// several censuses might share the same root, look for the one published
+	for holder := range snapshot.Holders {
+		h, err := hex.DecodeString(holder)
+		if err != nil || !bytes.HasPrefix(h, []byte(publishHolderPrefix)) {
+			continue
+		}
+		censusID, err := uuid.FromBytes(h[len(publishHolderPrefix):])
+		if err != nil {
+			continue
+		}
+		ref, err := c.Load(censusID)
+		if err != nil {
+			return nil, err
+		}
+		if ref.IsLocked() && bytes.Equal(ref.PublishedRoot, root) {
+			return ref, nil
+		}
+	}
+	return nil, ErrCensusNotPublished
+}
@@ -1,14 +1,37 @@
 package census
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/vocdoni/arbo"
+	"go.vocdoni.io/dvote/db"
 )
 
+// tombstonesKey is the key of the tree database where the number of removed
+// leaves of the tree is stored.
+const tombstonesKey = "tombstones"
+
+// tombstoneValue is the value of the removed leaves. Since arbo does not
+// support removing leaves, they are kept in the tree with an empty value,
+// which no participant can have, and they are skipped by the proofs, the
+// iterations and the size of the census.
+var tombstoneValue = []byte{}
+
+// isTombstone returns true if the leaf value provided is the one of a removed
+// leaf.
+func isTombstone(value []byte) bool {
+	return len(value) == 0
+}
+
 // CensusRef is a reference to a census. It holds the Merkle tree.
 // All accesses to the underlying tree (and its currentRoot) are protected by treeMu.
 type CensusRef struct {
@@ -18,10 +41,31 @@ type CensusRef struct {
 	LastUsed    time.Time
 	currentRoot []byte
 	tree        *arbo.Tree `gob:"-"`
-	// treeMu protects all access to the underlying Merkle tree.
-	treeMu sync.Mutex `gob:"-"`
+	// treeDB is the database of the Merkle tree.
+	treeDB db.Database `gob:"-"`
+	// hashFunction is the hash function of the Merkle tree, defined by
+	// HashType.
+	hashFunction arbo.HashFunction `gob:"-"`
+	// treeMu protects all access to the underlying Merkle tree. It is shared
+	// by every reference to the same census, so a reference unloaded while
+	// still held and the one loaded again do not modify the tree
+	// concurrently.
+	treeMu *sync.Mutex `gob:"-"`
 	// updateRootRequest is the channel to send asynchronous root update requests.
 	updateRootRequest chan *updateRootRequest `gob:"-"`
+
+	// PublishedAt is the time the census was published, it is zero if the
+	// census is not published. Once published, the census is locked and its
+	// tree cannot be modified.
+	PublishedAt time.Time
+	// PublishedRoot and PublishedSize are the root and the number of leaves
+	// of the tree when the census was published.
+	PublishedRoot []byte
+	PublishedSize int
+
+	// AuthTokenHash is the hash of the secret token required to manage the
+	// census. If it is empty, the census cannot be managed with a token.
+	AuthTokenHash []byte
 }
 
 // Tree returns the underlying arbo.Tree pointer.
@@ -30,6 +74,30 @@ func (cr *CensusRef) Tree() *arbo.Tree {
 	return cr.tree
 }
 
+// HashFunction returns the hash function of the census tree.
+func (cr *CensusRef) HashFunction() arbo.HashFunction {
+	return cr.hashFunction
+}
+
+// HashLen returns the length of the census hash function output in bytes,
+// which is the length of the leaf values.
+func (cr *CensusRef) HashLen() int {
+	return cr.hashFunction.Len()
+}
+
+// HashAndTrunkKey computes the hash of a key with the census hash function
+// and truncates it to the required length. Returns nil if the hash function
+// fails.
+func (cr *CensusRef) HashAndTrunkKey(key []byte) []byte {
+	return HashAndTrunkKey(cr.hashFunction, key)
+}
+
+// VerifyProof verifies a Merkle proof for the given leaf key with the census
+// hash function.
+func (cr *CensusRef) VerifyProof(key, value, root, siblings []byte) bool {
+	return verifyProof(cr.hashFunction, key, value, root, siblings)
+}
+
 // SetTree sets the arbo.Tree pointer.
 func (cr *CensusRef) SetTree(tree *arbo.Tree) {
 	cr.tree = tree
@@ -39,20 +107,59 @@ func (cr *CensusRef) SetTree(tree *arbo.Tree) {
 func (cr *CensusRef) sendUpdateRoot(newRoot []byte) error {
 	done := make(chan struct{})
 	req := &updateRootRequest{
-		censusID: cr.ID,
-		newRoot:  newRoot,
-		done:     done,
+		ref:     cr,
+		newRoot: newRoot,
+		done:    done,
 	}
 	cr.updateRootRequest <- req
 	<-done
 	return nil
 }
 
-// Insert safely inserts a key/value pair into the Merkle tree.
+// CheckAuthToken checks the management token provided against the hash stored
+// in the census reference. It returns ErrWrongAuthenticationToken if the
+// token does not match or the census has no token.
+func (cr *CensusRef) CheckAuthToken(token string) error {
+	if len(cr.AuthTokenHash) == 0 || token == "" {
+		return ErrWrongAuthenticationToken
+	}
+	if subtle.ConstantTimeCompare(hashAuthToken(token), cr.AuthTokenHash) != 1 {
+		return ErrWrongAuthenticationToken
+	}
+	return nil
+}
+
+// hashAuthToken returns the hash of the management token provided.
+func hashAuthToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// IsLocked returns true if the census does not allow write operations, which
+// happens once it is published.
+func (cr *CensusRef) IsLocked() bool {
+	cr.treeMu.Lock()
+	defer cr.treeMu.Unlock()
+	return !cr.PublishedAt.IsZero()
+}
+
+// Insert safely inserts a key/value pair into the Merkle tree. If the key was
+// removed, its leaf is restored with the value provided.
 // It holds treeMu during the Add and Root calls.
+// It returns ErrCensusIsLocked if the census is published.
 func (cr *CensusRef) Insert(key, value []byte) error {
+	if isTombstone(value) {
+		return ErrEmptyValue
+	}
 	cr.treeMu.Lock()
-	err := cr.tree.Add(key, value)
+	if !cr.PublishedAt.IsZero() {
+		cr.treeMu.Unlock()
+		return ErrCensusIsLocked
+	}
+	restored, err := cr.restoreLeaves([][]byte{key}, [][]byte{value})
+	if err == nil && len(restored) == 0 {
+		err = cr.tree.Add(key, value)
+	}
 	if err != nil {
 		cr.treeMu.Unlock()
 		return err
@@ -66,13 +173,182 @@ func (cr *CensusRef) Insert(key, value []byte) error {
 }
 
 // InsertBatch safely inserts a batch of key/value pairs into the Merkle tree.
+// The leaves of the keys that were removed are restored with the values
+// provided.
+// It returns ErrCensusIsLocked if the census is published.
 func (cr *CensusRef) InsertBatch(keys, values [][]byte) ([]arbo.Invalid, error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("keys and values length mismatch")
+	}
 	cr.treeMu.Lock()
-	invalid, err := cr.tree.AddBatch(keys, values)
+	if !cr.PublishedAt.IsZero() {
+		cr.treeMu.Unlock()
+		return nil, ErrCensusIsLocked
+	}
+	restored, err := cr.restoreLeaves(keys, values)
+	if err != nil {
+		cr.treeMu.Unlock()
+		return nil, err
+	}
+	// the rest of the keys are added, keeping their index in the batch
+	invalid := []arbo.Invalid{}
+	addKeys, addValues, indexes := [][]byte{}, [][]byte{}, []int{}
+	for i := range keys {
+		switch {
+		case restored[i]:
+		case isTombstone(values[i]):
+			invalid = append(invalid, arbo.Invalid{Index: i, Error: ErrEmptyValue})
+		default:
+			addKeys = append(addKeys, keys[i])
+			addValues = append(addValues, values[i])
+			indexes = append(indexes, i)
+		}
+	}
+	// arbo adds the batches from the stored tree, so the restored leaves
+	// are committed before
+	addInvalid, err := cr.tree.AddBatch(addKeys, addValues)
 	if err != nil {
 		cr.treeMu.Unlock()
+		return nil, err
+	}
+	for _, inv := range addInvalid {
+		invalid = append(invalid, arbo.Invalid{Index: indexes[inv.Index], Error: inv.Error})
+	}
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].Index < invalid[j].Index })
+	newRoot, err := cr.tree.Root()
+	cr.treeMu.Unlock()
+	if err != nil {
 		return invalid, err
 	}
+	return invalid, cr.sendUpdateRoot(newRoot)
+}
+
+// restoreLeaves sets the values provided to the removed leaves of the keys
+// provided and returns the keys restored, by their index. The caller must
+// hold treeMu.
+func (cr *CensusRef) restoreLeaves(keys, values [][]byte) (map[int]bool, error) {
+	restored := map[int]bool{}
+	if tombstones, err := cr.tombstones(cr.treeDB); err != nil || tombstones == 0 {
+		return restored, err
+	}
+	wTx := cr.treeDB.WriteTx()
+	defer wTx.Discard()
+	for i, key := range keys {
+		if isTombstone(values[i]) {
+			continue
+		}
+		_, value, err := cr.tree.GetWithTx(wTx, key)
+		if err != nil || !isTombstone(value) {
+			continue
+		}
+		if err := cr.tree.UpdateWithTx(wTx, key, values[i]); err != nil {
+			return nil, err
+		}
+		restored[i] = true
+	}
+	if len(restored) == 0 {
+		return restored, nil
+	}
+	if err := cr.addTombstones(wTx, -len(restored)); err != nil {
+		return nil, err
+	}
+	return restored, wTx.Commit()
+}
+
+// UpdateBatch safely updates the values of a batch of existing keys of the
+// Merkle tree. The keys that cannot be updated, such as the ones not found in
+// the tree, are returned as invalid and the rest are updated.
+// It returns ErrCensusIsLocked if the census is published.
+func (cr *CensusRef) UpdateBatch(keys, values [][]byte) ([]arbo.Invalid, error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("keys and values length mismatch")
+	}
+	cr.treeMu.Lock()
+	if !cr.PublishedAt.IsZero() {
+		cr.treeMu.Unlock()
+		return nil, ErrCensusIsLocked
+	}
+	wTx := cr.treeDB.WriteTx()
+	defer wTx.Discard()
+	invalid := []arbo.Invalid{}
+	for i := range keys {
+		if isTombstone(values[i]) {
+			invalid = append(invalid, arbo.Invalid{Index: i, Error: ErrEmptyValue})
+			continue
+		}
+		// the removed leaves are not updated
+		_, value, err := cr.tree.GetWithTx(wTx, keys[i])
+		if err == nil && isTombstone(value) {
+			err = ErrKeyNotFound
+		}
+		if err == nil {
+			err = cr.tree.UpdateWithTx(wTx, keys[i], values[i])
+		}
+		if err != nil {
+			if errors.Is(err, arbo.ErrKeyNotFound) {
+				err = ErrKeyNotFound
+			}
+			invalid = append(invalid, arbo.Invalid{Index: i, Error: err})
+		}
+	}
+	if len(invalid) == len(keys) {
+		cr.treeMu.Unlock()
+		return invalid, nil
+	}
+	if err := wTx.Commit(); err != nil {
+		cr.treeMu.Unlock()
+		return nil, err
+	}
+	newRoot, err := cr.tree.Root()
+	cr.treeMu.Unlock()
+	if err != nil {
+		return invalid, err
+	}
+	return invalid, cr.sendUpdateRoot(newRoot)
+}
+
+// DeleteBatch safely removes a batch of keys from the Merkle tree. The keys
+// not found in the tree are returned as invalid and the rest are removed.
+// Since arbo does not support removing leaves, the value of their leaves is
+// replaced by an empty value, so removing a key costs the same as updating
+// it. The removed keys can be inserted again.
+// It returns ErrCensusIsLocked if the census is published.
+func (cr *CensusRef) DeleteBatch(keys [][]byte) ([]arbo.Invalid, error) {
+	cr.treeMu.Lock()
+	if !cr.PublishedAt.IsZero() {
+		cr.treeMu.Unlock()
+		return nil, ErrCensusIsLocked
+	}
+	wTx := cr.treeDB.WriteTx()
+	defer wTx.Discard()
+	invalid := []arbo.Invalid{}
+	for i, key := range keys {
+		_, value, err := cr.tree.GetWithTx(wTx, key)
+		if err == nil && isTombstone(value) {
+			err = ErrKeyNotFound
+		}
+		if err == nil {
+			err = cr.tree.UpdateWithTx(wTx, key, tombstoneValue)
+		}
+		if err != nil {
+			if errors.Is(err, arbo.ErrKeyNotFound) {
+				err = ErrKeyNotFound
+			}
+			invalid = append(invalid, arbo.Invalid{Index: i, Error: err})
+		}
+	}
+	if len(invalid) == len(keys) {
+		cr.treeMu.Unlock()
+		return invalid, nil
+	}
+	err := cr.addTombstones(wTx, len(keys)-len(invalid))
+	if err == nil {
+		err = wTx.Commit()
+	}
+	if err != nil {
+		cr.treeMu.Unlock()
+		return nil, err
+	}
 	newRoot, err := cr.tree.Root()
 	cr.treeMu.Unlock()
 	if err != nil {
@@ -81,6 +357,74 @@ func (cr *CensusRef) InsertBatch(keys, values [][]byte) ([]arbo.Invalid, error)
 	return invalid, cr.sendUpdateRoot(newRoot)
 }
 
+// tombstones returns the number of removed leaves of the tree. The caller
+// must hold treeMu.
+func (cr *CensusRef) tombstones(rTx db.Reader) (int, error) {
+	b, err := rTx.Get([]byte(tombstonesKey))
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.LittleEndian.Uint64(b)), nil
+}
+
+// addTombstones adds the number provided, which can be negative, to the
+// number of removed leaves of the tree. The caller must hold treeMu.
+func (cr *CensusRef) addTombstones(wTx db.WriteTx, n int) error {
+	count, err := cr.tombstones(wTx)
+	if err != nil {
+		return err
+	}
+	return cr.setTombstones(wTx, count+n)
+}
+
+// setTombstones sets the number of removed leaves of the tree. The caller
+// must hold treeMu.
+func (cr *CensusRef) setTombstones(wTx db.WriteTx, count int) error {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(count))
+	return wTx.Set([]byte(tombstonesKey), b)
+}
+
+// countTombstones counts the removed leaves of the tree and stores their
+// number, which is required once the tree is imported from a dump. The caller
+// must hold treeMu.
+func (cr *CensusRef) countTombstones() error {
+	count := 0
+	if err := cr.tree.IterateWithStop(nil, func(_ int, _, v []byte) bool {
+		if v[0] == arbo.PrefixValueLeaf {
+			if _, value := arbo.ReadLeafValue(v); isTombstone(value) {
+				count++
+			}
+		}
+		return false
+	}); err != nil {
+		return err
+	}
+	wTx := cr.treeDB.WriteTx()
+	defer wTx.Discard()
+	if err := cr.setTombstones(wTx, count); err != nil {
+		return err
+	}
+	return wTx.Commit()
+}
+
+// size returns the number of leaves of the tree that are not removed. The
+// caller must hold treeMu.
+func (cr *CensusRef) size() (int, error) {
+	nLeafs, err := cr.tree.GetNLeafs()
+	if err != nil {
+		return 0, err
+	}
+	tombstones, err := cr.tombstones(cr.treeDB)
+	if err != nil {
+		return 0, err
+	}
+	return nLeafs - tombstones, nil
+}
+
 // Root safely returns the current Merkle tree root.
 func (cr *CensusRef) Root() []byte {
 	cr.treeMu.Lock()
@@ -96,7 +440,7 @@ func (cr *CensusRef) Root() []byte {
 func (cr *CensusRef) Size() int {
 	cr.treeMu.Lock()
 	defer cr.treeMu.Unlock()
-	size, err := cr.tree.GetNLeafs()
+	size, err := cr.size()
 	if err != nil {
 		return 0
 	}
@@ -108,12 +452,24 @@ func (cr *CensusRef) Size() int {
 func (cr *CensusRef) GenProof(key []byte) ([]byte, []byte, []byte, bool, error) {
 	cr.treeMu.Lock()
 	defer cr.treeMu.Unlock()
-	return cr.tree.GenProof(key)
+	key, value, siblings, inclusion, err := cr.tree.GenProof(key)
+	if err != nil {
+		return nil, nil, nil, false, err
+	}
+	// the removed leaves are not included
+	return key, value, siblings, inclusion && !isTombstone(value), nil
 }
 
-// VerifyProof verifies a Merkle proof for the given leaf key.
+// VerifyProof verifies a Merkle proof for the given leaf key with the default
+// hash function.
 func VerifyProof(key, value, root, siblings []byte) bool {
-	valid, err := arbo.CheckProof(defaultHashFunction, key, value, root, siblings)
+	return verifyProof(defaultHashFunction, key, value, root, siblings)
+}
+
+// verifyProof verifies a Merkle proof for the given leaf key with the hash
+// function provided.
+func verifyProof(hashFn arbo.HashFunction, key, value, root, siblings []byte) bool {
+	valid, err := arbo.CheckProof(hashFn, key, value, root, siblings)
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,264 @@
+package census
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vocdoni/arbo"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"go.vocdoni.io/dvote/db"
+	"go.vocdoni.io/dvote/db/prefixeddb"
+)
+
+const censusDBsnapshotPrefix = "cn_"
+
+var (
+	// ErrCensusRootNotFound is returned when no census or snapshot is found
+	// for a root.
+	ErrCensusRootNotFound = fmt.Errorf("no census found with the provided root")
+	// ErrCensusRootsRetained is returned by Del() if some roots of the census
+	// are still retained.
+	ErrCensusRootsRetained = fmt.Errorf("census roots are retained")
+)
+
+// RootSnapshot is an immutable view of a census tree at a given root. It is
+// kept while any holder (such as a process) retains it, even if the census
+// tree is modified afterwards. Since the tree nodes are content addressed and
+// never removed on insertion, the snapshot only records the census that holds
+// the nodes and the size of the tree at that root.
+type RootSnapshot struct {
+	CensusID   uuid.UUID
+	Root       []byte
+	Size       int
+	RetainedAt time.Time
+	// Holders contains the identifiers of the holders retaining the root.
+	Holders map[string]struct{}
+}
+
+// RetainRoot keeps an immutable snapshot of the census root provided on
+// behalf of the holder provided (for example the process ID that references
+// the root). The root must be the current root of a census or an already
+// retained one. Retaining the same root several times with the same holder
+// has no effect. It returns ErrCensusRootNotFound if the root is unknown.
+func (c *CensusDB) RetainRoot(root, holder []byte) (*RootSnapshot, error) {
+	rk := rootKey(root)
+	c.mu.RLock()
+	_, retained := c.snapshots[rk]
+	censusID, indexed := c.rootIndex[rk]
+	c.mu.RUnlock()
+
+	var ref *CensusRef
+	if !retained {
+		if !indexed {
+			return nil, ErrCensusRootNotFound
+		}
+		// the census might have been unloaded, so it is loaded again
+		var err error
+		if ref, err = c.Load(censusID); err != nil {
+			return nil, err
+		}
+	}
+	return c.retainRoot(ref, root, holder)
+}
+
+// retainRoot retains the root provided on behalf of the holder provided. If
+// the root is not retained yet, it must be the current root of the census of
+// the reference provided, which can be nil if the root is known to be
+// retained.
+func (c *CensusDB) retainRoot(ref *CensusRef, root, holder []byte) (*RootSnapshot, error) {
+	rk := rootKey(root)
+	hk := rootKey(holder)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot, exists := c.snapshots[rk]
+	if !exists {
+		if ref == nil {
+			// the root has been released meanwhile
+			return nil, ErrCensusRootNotFound
+		}
+		// the root and the size must be read atomically
+		ref.treeMu.Lock()
+		currentRoot, err := ref.tree.Root()
+		if err != nil {
+			ref.treeMu.Unlock()
+			return nil, err
+		}
+		size, err := ref.size()
+		ref.treeMu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(currentRoot, root) {
+			// the root has been superseded before being retained
+			return nil, ErrCensusRootNotFound
+		}
+		snapshot = &RootSnapshot{
+			CensusID:   ref.ID,
+			Root:       append([]byte(nil), root...),
+			Size:       size,
+			RetainedAt: time.Now(),
+			Holders:    make(map[string]struct{}),
+		}
+	}
+	if _, held := snapshot.Holders[hk]; held {
+		return snapshot.copy(), nil
+	}
+	snapshot.Holders[hk] = struct{}{}
+	if err := c.writeSnapshot(snapshot); err != nil {
+		delete(snapshot.Holders, hk)
+		return nil, err
+	}
+	c.snapshots[rk] = snapshot
+	log.Debugw("census root retained", "root", rk, "holder", hk, "holders", len(snapshot.Holders))
+	return snapshot.copy(), nil
+}
+
+// ReleaseRoot releases the census root retained by the holder provided. Once
+// no holder retains the root, the snapshot is removed and the root is only
+// available while it is the current root of its census. Releasing a root not
+// retained by the holder has no effect.
+func (c *CensusDB) ReleaseRoot(root, holder []byte) error {
+	rk := rootKey(root)
+	hk := rootKey(holder)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot, exists := c.snapshots[rk]
+	if !exists {
+		return nil
+	}
+	if _, held := snapshot.Holders[hk]; !held {
+		return nil
+	}
+	delete(snapshot.Holders, hk)
+	if len(snapshot.Holders) > 0 {
+		if err := c.writeSnapshot(snapshot); err != nil {
+			snapshot.Holders[hk] = struct{}{}
+			return err
+		}
+		return nil
+	}
+	wtx := c.db.WriteTx()
+	defer wtx.Discard()
+	if err := wtx.Delete(snapshotKey(root)); err != nil {
+		snapshot.Holders[hk] = struct{}{}
+		return err
+	}
+	if err := wtx.Commit(); err != nil {
+		snapshot.Holders[hk] = struct{}{}
+		return err
+	}
+	delete(c.snapshots, rk)
+	log.Debugw("census root released", "root", rk)
+	return nil
+}
+
+// Snapshot returns the snapshot of the retained root provided. It returns
+// ErrCensusRootNotFound if the root is not retained.
+func (c *CensusDB) Snapshot(root []byte) (*RootSnapshot, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snapshot, exists := c.snapshots[rootKey(root)]
+	if !exists {
+		return nil, ErrCensusRootNotFound
+	}
+	return snapshot.copy(), nil
+}
+
+// RetainedRoots returns the snapshots of the roots retained for the census
+// provided.
+func (c *CensusDB) RetainedRoots(censusID uuid.UUID) []*RootSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snapshots := []*RootSnapshot{}
+	for _, snapshot := range c.snapshots {
+		if snapshot.CensusID == censusID {
+			snapshots = append(snapshots, snapshot.copy())
+		}
+	}
+	return snapshots
+}
+
+// snapshotTree returns a read-only census tree at the retained root provided
+// and its snapshot. It returns ErrCensusRootNotFound if the root is not
+// retained.
+func (c *CensusDB) snapshotTree(root []byte) (*arbo.Tree, *RootSnapshot, error) {
+	snapshot, err := c.Snapshot(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	ref, err := c.Load(snapshot.CensusID)
+	if err != nil {
+		return nil, nil, err
+	}
+	ref.treeMu.Lock()
+	defer ref.treeMu.Unlock()
+	tree, err := ref.tree.Snapshot(snapshot.Root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load census snapshot: %w", err)
+	}
+	return tree, snapshot, nil
+}
+
+// writeSnapshot writes a root snapshot to the database.
+func (c *CensusDB) writeSnapshot(snapshot *RootSnapshot) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snapshot); err != nil {
+		return err
+	}
+	wtx := c.db.WriteTx()
+	defer wtx.Discard()
+	if err := wtx.Set(snapshotKey(snapshot.Root), buf.Bytes()); err != nil {
+		return err
+	}
+	return wtx.Commit()
+}
+
+// loadSnapshots reads the root snapshots stored in the database.
+func (c *CensusDB) loadSnapshots() error {
+	database := prefixeddb.NewPrefixedReader(c.db, []byte(censusDBsnapshotPrefix))
+	var decodeErr error
+	if err := database.Iterate(nil, func(_, v []byte) bool {
+		snapshot := &RootSnapshot{}
+		if err := gob.NewDecoder(bytes.NewReader(v)).Decode(snapshot); err != nil {
+			decodeErr = err
+			return false
+		}
+		if snapshot.Holders == nil {
+			snapshot.Holders = make(map[string]struct{})
+		}
+		c.snapshots[rootKey(snapshot.Root)] = snapshot
+		return true
+	}); err != nil && !errors.Is(err, db.ErrKeyNotFound) {
+		return err
+	}
+	return decodeErr
+}
+
+// copy returns a copy of the snapshot that can be used outside the CensusDB
+// lock.
+func (s *RootSnapshot) copy() *RootSnapshot {
+	holders := make(map[string]struct{}, len(s.Holders))
+	for h := range s.Holders {
+		holders[h] = struct{}{}
+	}
+	return &RootSnapshot{
+		CensusID:   s.CensusID,
+		Root:       append([]byte(nil), s.Root...),
+		Size:       s.Size,
+		RetainedAt: s.RetainedAt,
+		Holders:    holders,
+	}
+}
+
+// snapshotKey returns the database key of the snapshot of the root provided.
+func snapshotKey(root []byte) []byte {
+	return append([]byte(censusDBsnapshotPrefix), root...)
+}
@@ -0,0 +1,33 @@
+package census
+
+// Stats are the counters of the censuses of a CensusDB.
+type Stats struct {
+	// Stored is the number of censuses stored in the database.
+	Stored int
+	// Loaded is the number of censuses loaded in memory.
+	Loaded int
+	// Published is the number of stored censuses that are published.
+	Published int
+	// RetainedRoots is the number of census root snapshots retained.
+	RetainedRoots int
+}
+
+// Stats returns the counters of the censuses. The stored censuses are read
+// from the database without loading them.
+func (c *CensusDB) Stats() (*Stats, error) {
+	refs, err := c.storedReferences()
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{Stored: len(refs)}
+	for _, ref := range refs {
+		if !ref.PublishedAt.IsZero() {
+			stats.Published++
+		}
+	}
+	c.mu.RLock()
+	stats.Loaded = len(c.loadedCensus)
+	stats.RetainedRoots = len(c.snapshots)
+	c.mu.RUnlock()
+	return stats, nil
+}
@@ -0,0 +1,252 @@
+package census
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vocdoni/arbo"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"go.vocdoni.io/dvote/db"
+	"go.vocdoni.io/dvote/db/prefixeddb"
+)
+
+// SweepConfig configures the census garbage collection.
+type SweepConfig struct {
+	// Interval is the time between sweeps of the background sweeper.
+	Interval time.Duration
+	// IdleTimeout is the time since the last use after which a census is
+	// unloaded from memory. If zero, the censuses are never unloaded.
+	IdleTimeout time.Duration
+	// Retention is the time since the last use after which an unpublished
+	// census is deleted. If zero, the censuses are never deleted.
+	Retention time.Duration
+	// ReferencedRoots returns the census roots referenced by the stored
+	// processes. The censuses with any of these roots are never deleted. If
+	// it fails, no census is deleted on that sweep.
+	ReferencedRoots func() ([][]byte, error)
+}
+
+// SweepReport describes the resources reclaimed by a sweep.
+type SweepReport struct {
+	StartedAt time.Time
+	Duration  time.Duration
+	// Unloaded contains the IDs of the censuses unloaded from memory.
+	Unloaded []uuid.UUID
+	// Deleted contains the IDs of the censuses deleted.
+	Deleted []uuid.UUID
+	// DeletedKeys is the number of database keys removed with the deleted
+	// censuses.
+	DeletedKeys int
+}
+
+// touch updates the last use time of the census.
+func (cr *CensusRef) touch() {
+	cr.treeMu.Lock()
+	cr.LastUsed = time.Now()
+	cr.treeMu.Unlock()
+}
+
+// StartSweeper runs Sweep every interval of the configuration provided
+// until the context is done. The report of the last sweep is available with
+// LastSweepReport.
+func (c *CensusDB) StartSweeper(ctx context.Context, conf SweepConfig) error {
+	if conf.Interval <= 0 {
+		return fmt.Errorf("invalid sweep interval %s", conf.Interval)
+	}
+	go func() {
+		ticker := time.NewTicker(conf.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := c.Sweep(conf); err != nil {
+					log.Warnw("census sweep failed", "err", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// LastSweepReport returns the report of the last sweep, or nil if no sweep
+// has been done yet.
+func (c *CensusDB) LastSweepReport() *SweepReport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastSweep
+}
+
+// Sweep unloads from memory the censuses idle for longer than the idle
+// timeout, and deletes the unpublished censuses that are not loaded, have not
+// been used for longer than the retention period, have no retained roots and
+// whose root is not referenced by any process. It returns the report of what
+// was reclaimed.
+func (c *CensusDB) Sweep(conf SweepConfig) (*SweepReport, error) {
+	report := &SweepReport{StartedAt: time.Now()}
+	if conf.IdleTimeout > 0 {
+		if err := c.unloadIdle(report, conf.IdleTimeout); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Retention > 0 {
+		if err := c.deleteExpired(report, conf); err != nil {
+			return nil, err
+		}
+	}
+	report.Duration = time.Since(report.StartedAt)
+	c.mu.Lock()
+	c.lastSweep = report
+	c.mu.Unlock()
+	if len(report.Unloaded) > 0 || len(report.Deleted) > 0 {
+		log.Infow("census sweep done",
+			"unloaded", len(report.Unloaded),
+			"deleted", len(report.Deleted),
+			"deletedKeys", report.DeletedKeys,
+			"duration", report.Duration.String())
+	}
+	return report, nil
+}
+
+// unloadIdle removes from memory the censuses not used for the idle time
+// provided. Their references are stored with the last use time, and their
+// roots remain indexed, so every lookup by root loads them again on demand.
+// The censuses whose tree is in use are not unloaded.
+func (c *CensusDB) unloadIdle(report *SweepReport, idle time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for censusID, ref := range c.loadedCensus {
+		if !ref.treeMu.TryLock() {
+			continue
+		}
+		idleFor := time.Since(ref.LastUsed)
+		ref.treeMu.Unlock()
+		if idleFor < idle {
+			continue
+		}
+		if err := c.writeReference(ref); err != nil {
+			return fmt.Errorf("could not store census %s: %w", censusID, err)
+		}
+		delete(c.loadedCensus, censusID)
+		report.Unloaded = append(report.Unloaded, censusID)
+	}
+	return nil
+}
+
+// deleteExpired deletes the unpublished censuses not loaded and not used
+// for the retention period of the configuration provided.
+func (c *CensusDB) deleteExpired(report *SweepReport, conf SweepConfig) error {
+	referenced := map[string]bool{}
+	if conf.ReferencedRoots != nil {
+		roots, err := conf.ReferencedRoots()
+		if err != nil {
+			return fmt.Errorf("could not get referenced census roots: %w", err)
+		}
+		for _, root := range roots {
+			referenced[rootKey(root)] = true
+		}
+	}
+	refs, err := c.storedReferences()
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if !ref.PublishedAt.IsZero() || time.Since(ref.LastUsed) < conf.Retention {
+			continue
+		}
+		if len(c.RetainedRoots(ref.ID)) > 0 {
+			continue
+		}
+		root, err := c.storedRoot(ref)
+		if err != nil {
+			log.Warnw("could not read census root", "id", ref.ID.String(), "err", err)
+			continue
+		}
+		if referenced[rootKey(root)] {
+			continue
+		}
+		deleted, err := c.removeUnloaded(ref.ID)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			continue
+		}
+		count, err := deleteCensusTreeFromDatabase(c.db, censusPrefix(ref.ID))
+		if err != nil {
+			log.Warnw("error deleting census tree", "id", ref.ID.String(), "err", err)
+		}
+		report.Deleted = append(report.Deleted, ref.ID)
+		report.DeletedKeys += count + 1
+	}
+	return nil
+}
+
+// removeUnloaded removes the reference of the census provided if it is not
+// loaded, and the roots indexed for it. It returns false if the census is
+// loaded, so it is in use.
+func (c *CensusDB) removeUnloaded(censusID uuid.UUID) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, loaded := c.loadedCensus[censusID]; loaded {
+		return false, nil
+	}
+	wtx := c.db.WriteTx()
+	defer wtx.Discard()
+	if err := wtx.Delete(append([]byte(censusDBreferencePrefix), censusID[:]...)); err != nil {
+		return false, err
+	}
+	if err := wtx.Commit(); err != nil {
+		return false, err
+	}
+	delete(c.treeLocks, censusID)
+	for rk, id := range c.rootIndex {
+		if id == censusID {
+			delete(c.rootIndex, rk)
+		}
+	}
+	return true, nil
+}
+
+// storedReferences returns the census references stored in the database.
+func (c *CensusDB) storedReferences() ([]*CensusRef, error) {
+	refs := []*CensusRef{}
+	var decodeErr error
+	database := prefixeddb.NewPrefixedReader(c.db, []byte(censusDBreferencePrefix))
+	if err := database.Iterate(nil, func(_, v []byte) bool {
+		ref := &CensusRef{}
+		if err := gob.NewDecoder(bytes.NewReader(v)).Decode(ref); err != nil {
+			decodeErr = err
+			return false
+		}
+		refs = append(refs, ref)
+		return true
+	}); err != nil && !errors.Is(err, db.ErrKeyNotFound) {
+		return nil, err
+	}
+	return refs, decodeErr
+}
+
+// storedRoot returns the current root of the tree of the stored census
+// reference provided, without loading the census.
+func (c *CensusDB) storedRoot(ref *CensusRef) ([]byte, error) {
+	hashFn, err := HashFunction(ref.HashType)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := arbo.NewTree(arbo.Config{
+		Database:     prefixeddb.NewPrefixedDatabase(c.db, censusPrefix(ref.ID)),
+		MaxLevels:    ref.MaxLevels,
+		HashFunction: hashFn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tree.Root()
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+)
+
+// SweepCensuses runs a single census garbage collection with the
+// configuration provided and returns its report. The censuses whose root is
+// referenced by a stored process are never deleted.
+func (s *Storage) SweepCensuses(conf census.SweepConfig) (*census.SweepReport, error) {
+	conf.ReferencedRoots = s.processCensusRoots
+	return s.censusDB.Sweep(conf)
+}
+
+// processCensusRoots returns the census roots of the stored processes.
+func (s *Storage) processCensusRoots() ([][]byte, error) {
+	pids, err := s.ListProcesses()
+	if err != nil {
+		return nil, err
+	}
+	roots := [][]byte{}
+	for _, pid := range pids {
+		p, err := s.Process(new(types.ProcessID).SetBytes(pid))
+		if err != nil {
+			return nil, err
+		}
+		if p.Census != nil && len(p.Census.CensusRoot) > 0 {
+			roots = append(roots, p.Census.CensusRoot)
+		}
+	}
+	return roots, nil
+}
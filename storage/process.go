@@ -1,11 +1,17 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/vocdoni/vocdoni-z-sandbox/crypto/ethereum"
+	"github.com/vocdoni/vocdoni-z-sandbox/events"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
+	"go.vocdoni.io/dvote/db/prefixeddb"
 )
 
 // Process retrieves the process data from the storage.
@@ -18,15 +24,155 @@ func (s *Storage) Process(pid *types.ProcessID) (*types.Process, error) {
 	return p, nil
 }
 
-// SeProcess stores a process and its metadata into the storage.
+// SeProcess stores a process and its metadata into the storage, replacing the
+// previous one if any. If the census root of the process belongs to a local
+// census, the root is retained so the proofs remain available even if the
+// census is modified afterwards. If the process already exists and its census
+// root changes, the previous root is released.
 func (s *Storage) SetProcess(data *types.Process) error {
 	if data == nil {
 		return fmt.Errorf("nil process data")
 	}
-	return s.setArtifact(processPrefix, data.ID, data)
+	s.globalLock.Lock()
+	defer s.globalLock.Unlock()
+
+	var oldRoot, newRoot []byte
+	old := &types.Process{}
+	exists := true
+	if err := s.getArtifact(processPrefix, data.ID, old); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		exists = false
+	}
+	if exists && old.Census != nil {
+		oldRoot = old.Census.CensusRoot
+	}
+	if data.Census != nil {
+		newRoot = data.Census.CensusRoot
+	}
+	censusChanged := !exists || !bytes.Equal(oldRoot, newRoot)
+	if censusChanged {
+		if err := s.retainProcessCensus(data.ID, data.Census); err != nil {
+			return err
+		}
+	}
+	if err := s.writeProcess(data); err != nil {
+		return err
+	}
+	if censusChanged && len(oldRoot) > 0 {
+		if err := s.censusDB.ReleaseRoot(oldRoot, data.ID); err != nil {
+			log.Warnw("could not release process census root", "processId", data.ID.String(), "error", err)
+		}
+	}
+	return nil
+}
+
+// UpdateProcess applies the update function provided to the process with the
+// given ID and stores the result. It returns ErrNotFound if the process does
+// not exist. If the update function returns an error, the process is not
+// modified. If the census root changes, the new root is retained and the
+// previous one is released.
+func (s *Storage) UpdateProcess(pid *types.ProcessID, updateFn func(*types.Process) error) error {
+	s.globalLock.Lock()
+	defer s.globalLock.Unlock()
+
+	p := &types.Process{}
+	if err := s.getArtifact(processPrefix, pid.Marshal(), p); err != nil {
+		return err
+	}
+	var oldRoot []byte
+	if p.Census != nil {
+		oldRoot = append([]byte(nil), p.Census.CensusRoot...)
+	}
+	old := processEventState{
+		status:    p.Status,
+		stateRoot: append([]byte(nil), p.StateRoot...),
+		results:   len(p.Result) > 0,
+	}
+	if err := updateFn(p); err != nil {
+		return err
+	}
+	censusChanged := p.Census != nil && !bytes.Equal(oldRoot, p.Census.CensusRoot)
+	if censusChanged {
+		if err := s.retainProcessCensus(pid.Marshal(), p.Census); err != nil {
+			return err
+		}
+	}
+	p.ID = pid.Marshal()
+	if err := s.writeProcess(p); err != nil {
+		return err
+	}
+	if censusChanged && len(oldRoot) > 0 {
+		if err := s.censusDB.ReleaseRoot(oldRoot, pid.Marshal()); err != nil {
+			log.Warnw("could not release process census root", "processId", pid.String(), "error", err)
+		}
+	}
+	s.publishProcessChanges(&old, p)
+	return nil
+}
+
+// writeProcess stores the process provided, replacing the previous one if
+// any, and updates its index. The caller must hold globalLock.
+func (s *Storage) writeProcess(p *types.Process) error {
+	data, err := encodeArtifact(p)
+	if err != nil {
+		return err
+	}
+	wTx := prefixeddb.NewPrefixedWriteTx(s.db.WriteTx(), processPrefix)
+	if err := wTx.Set(p.ID, data); err != nil {
+		wTx.Discard()
+		return err
+	}
+	if err := wTx.Commit(); err != nil {
+		return err
+	}
+	return s.setProcessIndex(p)
+}
+
+// processEventState is the part of a process whose changes are published as
+// events.
+type processEventState struct {
+	status    uint8
+	stateRoot []byte
+	results   bool
+}
+
+// publishProcessChanges publishes the events of the changes of the process
+// provided since the previous state provided.
+func (s *Storage) publishProcessChanges(old *processEventState, p *types.Process) {
+	if !bytes.Equal(old.stateRoot, p.StateRoot) {
+		s.events.Publish(p.ID, events.StateRoot, &events.StateRootData{StateRoot: p.StateRoot})
+	}
+	ended := func(status uint8) bool {
+		return status == types.ProcessStatusEnded || status == types.ProcessStatusCanceled ||
+			status == types.ProcessStatusResults
+	}
+	if ended(p.Status) && !ended(old.status) {
+		s.events.Publish(p.ID, events.ProcessEnded, &events.ProcessStatusData{Status: p.Status})
+	}
+	if len(p.Result) > 0 && !old.results {
+		s.events.Publish(p.ID, events.ResultsReady, &events.ResultsData{Results: p.Result})
+	}
+}
+
+// retainProcessCensus retains the census root of the process provided if it
+// belongs to a local census. The roots of external censuses are ignored.
+func (s *Storage) retainProcessCensus(pid []byte, c *types.Census) error {
+	if c == nil || len(c.CensusRoot) == 0 {
+		return nil
+	}
+	if _, err := s.censusDB.RetainRoot(c.CensusRoot, pid); err != nil {
+		if errors.Is(err, census.ErrCensusRootNotFound) {
+			return nil
+		}
+		return fmt.Errorf("could not retain census root: %w", err)
+	}
+	return nil
 }
 
 // ListProcesses returns the list of process IDs stored in the storage (by SetProcessMetadata) as a list of byte slices.
+// Use ListProcessSummaries to filter and paginate them.
 func (s *Storage) ListProcesses() ([][]byte, error) {
 	pids, err := s.listArtifacts(processPrefix)
 	if err != nil {
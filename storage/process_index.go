@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+	"go.vocdoni.io/dvote/db/prefixeddb"
+)
+
+// processIndexEntry is the summary of a process stored in the process index,
+// so the processes can be listed and filtered without decoding them. It is
+// keyed by the process ID, so the entries are sorted by chain ID,
+// organization and nonce.
+type processIndexEntry struct {
+	Status    uint8          `cbor:"0,keyasint,omitempty"`
+	StartTime int64          `cbor:"1,keyasint,omitempty"`
+	Duration  int64          `cbor:"2,keyasint,omitempty"`
+	StateRoot types.HexBytes `cbor:"3,keyasint,omitempty"`
+}
+
+// ProcessFilter defines the processes listed by ListProcessSummaries. The
+// zero value lists every process.
+type ProcessFilter struct {
+	// ChainID and OrganizationID restrict the list to the processes of the
+	// chain and organization provided, if they are not nil.
+	ChainID        *uint32
+	OrganizationID *common.Address
+	// Status restricts the list to the processes with the status provided,
+	// if it is not nil.
+	Status *uint8
+	// From and To restrict the list to the processes whose voting period
+	// overlaps the time window provided, if they are not zero.
+	From time.Time
+	To   time.Time
+	// After is the ID of the last process of the previous page, the list
+	// starts with the next process.
+	After []byte
+	// Limit is the maximum number of processes listed, no limit if zero.
+	Limit int
+}
+
+// match returns true if the process of the index entry provided passes the
+// status and time window filters.
+func (f *ProcessFilter) match(e *processIndexEntry) bool {
+	if f.Status != nil && e.Status != *f.Status {
+		return false
+	}
+	if !f.To.IsZero() && e.StartTime > f.To.UnixNano() {
+		return false
+	}
+	if !f.From.IsZero() && e.StartTime+e.Duration < f.From.UnixNano() {
+		return false
+	}
+	return true
+}
+
+// prefix returns the prefix of the process IDs selected by the chain ID and
+// organization filters. The organization is only part of the prefix if the
+// chain ID is provided too.
+func (f *ProcessFilter) prefix() []byte {
+	if f.ChainID == nil {
+		return nil
+	}
+	prefix := binary.BigEndian.AppendUint32(nil, *f.ChainID)
+	if f.OrganizationID != nil {
+		prefix = append(prefix, f.OrganizationID.Bytes()...)
+	}
+	return prefix
+}
+
+// ListProcessSummaries returns the summaries of the processes that pass the
+// filter provided, sorted by process ID. The processes are read from the
+// process index, so they are not decoded.
+func (s *Storage) ListProcessSummaries(filter *ProcessFilter) ([]*ProcessSummary, error) {
+	if filter == nil {
+		filter = &ProcessFilter{}
+	}
+	type indexed struct {
+		pid   []byte
+		entry processIndexEntry
+	}
+	var matches []indexed
+	var decodeErr error
+	rd := prefixeddb.NewPrefixedReader(s.db, processIndexPrefix)
+	prefix := filter.prefix()
+	if err := rd.Iterate(prefix, func(k, v []byte) bool {
+		pid := append(append([]byte(nil), prefix...), k...)
+		if filter.After != nil && bytes.Compare(pid, filter.After) <= 0 {
+			return true
+		}
+		if filter.OrganizationID != nil && !bytes.Equal(processOrganization(pid), filter.OrganizationID.Bytes()) {
+			return true
+		}
+		var e processIndexEntry
+		if err := decodeArtifact(v, &e); err != nil {
+			decodeErr = fmt.Errorf("could not decode process index entry %x: %w", pid, err)
+			return false
+		}
+		if !filter.match(&e) {
+			return true
+		}
+		matches = append(matches, indexed{pid: pid, entry: e})
+		return filter.Limit == 0 || len(matches) < filter.Limit
+	}); err != nil {
+		return nil, fmt.Errorf("could not iterate process index: %w", err)
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	summaries := make([]*ProcessSummary, 0, len(matches))
+	for _, m := range matches {
+		summary, err := s.processSummary(m.pid, &m.entry)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// processSummary returns the summary of the process with the ID and index
+// entry provided, including its ballot counters and queue depths.
+func (s *Storage) processSummary(pid []byte, e *processIndexEntry) (*ProcessSummary, error) {
+	id := types.ProcessID{}
+	if err := id.Unmarshal(pid); err != nil {
+		return nil, fmt.Errorf("invalid indexed process ID %x: %w", pid, err)
+	}
+	stats, err := s.ProcessStats(pid)
+	if err != nil {
+		return nil, err
+	}
+	var startTime time.Time
+	if e.StartTime != 0 {
+		startTime = time.Unix(0, e.StartTime).UTC()
+	}
+	return &ProcessSummary{
+		ID:                pid,
+		ChainID:           id.ChainID,
+		OrganizationID:    id.Address,
+		Status:            e.Status,
+		StartTime:         startTime,
+		Duration:          time.Duration(e.Duration),
+		StateRoot:         e.StateRoot,
+		BallotsAccepted:   stats.BallotsAccepted,
+		BallotsVerified:   stats.BallotsVerified,
+		PendingBallots:    stats.BallotsAccepted - stats.BallotsVerified,
+		VerifiedBallots:   s.CountVerifiedBallots(pid),
+		AggregatedBatches: s.countAggregatedBatches(pid),
+	}, nil
+}
+
+// ProcessStats returns the ballot counters of the process with the ID
+// provided. The counters are zero if no ballot has been received yet.
+func (s *Storage) ProcessStats(pid []byte) (*ProcessStats, error) {
+	stats := &ProcessStats{}
+	if err := s.getArtifact(processStatsPrefix, pid, stats); err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// updateProcessStats applies the update function provided to the ballot
+// counters of the process with the ID provided. The caller must hold the
+// global lock.
+func (s *Storage) updateProcessStats(pid []byte, updateFn func(*ProcessStats)) error {
+	stats, err := s.ProcessStats(pid)
+	if err != nil {
+		return err
+	}
+	updateFn(stats)
+	data, err := encodeArtifact(stats)
+	if err != nil {
+		return err
+	}
+	wTx := prefixeddb.NewPrefixedWriteTx(s.db.WriteTx(), processStatsPrefix)
+	if err := wTx.Set(pid, data); err != nil {
+		wTx.Discard()
+		return err
+	}
+	return wTx.Commit()
+}
+
+// countAggregatedBatches returns the number of aggregated batches of the
+// process provided waiting to be processed.
+func (s *Storage) countAggregatedBatches(pid []byte) int {
+	s.globalLock.Lock()
+	defer s.globalLock.Unlock()
+
+	count := 0
+	if err := prefixeddb.NewPrefixedReader(s.db, aggregBatchPrefix).Iterate(pid, func(_, _ []byte) bool {
+		count++
+		return true
+	}); err != nil {
+		log.Warnw("failed to count aggregated batches", "error", err.Error())
+	}
+	return count
+}
+
+// setProcessIndex stores the index entry of the process provided.
+func (s *Storage) setProcessIndex(p *types.Process) error {
+	data, err := encodeArtifact(&processIndexEntry{
+		Status:    p.Status,
+		StartTime: processStartTime(p),
+		Duration:  int64(p.Duration),
+		StateRoot: p.StateRoot,
+	})
+	if err != nil {
+		return err
+	}
+	wTx := prefixeddb.NewPrefixedWriteTx(s.db.WriteTx(), processIndexPrefix)
+	if err := wTx.Set(p.ID, data); err != nil {
+		wTx.Discard()
+		return err
+	}
+	return wTx.Commit()
+}
+
+// indexProcesses creates the index entries of the stored processes that are
+// not indexed yet, such as the processes stored by previous versions.
+func (s *Storage) indexProcesses() error {
+	pids, err := s.listArtifacts(processPrefix)
+	if err != nil {
+		return err
+	}
+	rd := prefixeddb.NewPrefixedReader(s.db, processIndexPrefix)
+	indexed := 0
+	for _, pid := range pids {
+		if _, err := rd.Get(pid); err == nil {
+			continue
+		}
+		p := &types.Process{}
+		if err := s.getArtifact(processPrefix, pid, p); err != nil {
+			return err
+		}
+		p.ID = pid
+		if err := s.setProcessIndex(p); err != nil {
+			return err
+		}
+		indexed++
+	}
+	if indexed > 0 {
+		log.Infow("processes indexed", "count", indexed)
+	}
+	return nil
+}
+
+// processStartTime returns the start time of the process provided as the
+// nanoseconds since the Unix epoch, or zero if it is not set.
+func processStartTime(p *types.Process) int64 {
+	if p.StartTime.IsZero() {
+		return 0
+	}
+	return p.StartTime.UnixNano()
+}
+
+// processOrganization returns the organization address encoded in the
+// process ID provided.
+func processOrganization(pid []byte) []byte {
+	if len(pid) < 4+common.AddressLength {
+		return nil
+	}
+	return pid[4 : 4+common.AddressLength]
+}
@@ -1,12 +1,16 @@
 package storage
 
 import (
+	"math/big"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	qt "github.com/frankban/quicktest"
+	"github.com/google/uuid"
+	"github.com/vocdoni/vocdoni-z-sandbox/events"
+	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 	"go.vocdoni.io/dvote/db"
 	"go.vocdoni.io/dvote/db/metadb"
@@ -135,3 +139,210 @@ func TestProcess(t *testing.T) {
 	c.Assert(hash2, qt.Not(qt.IsNil))
 	c.Assert(hash2, qt.Not(qt.DeepEquals), hash1)
 }
+
+func TestProcessRetainsCensusRoot(t *testing.T) {
+	c := qt.New(t)
+	st := New(metadb.NewTest(t))
+
+	ref, err := st.CensusDB().New(uuid.New())
+	c.Assert(err, qt.IsNil)
+	c.Assert(ref.Insert([]byte("key1"), []byte{1}), qt.IsNil)
+	root1 := ref.Root()
+
+	pid := &types.ProcessID{Address: common.Address{}, Nonce: 1, ChainID: 1}
+	c.Assert(st.SetProcess(&types.Process{
+		ID:     pid.Marshal(),
+		Census: &types.Census{CensusRoot: root1},
+	}), qt.IsNil)
+
+	// appending participants does not break the census of the process
+	c.Assert(ref.Insert([]byte("key2"), []byte{2}), qt.IsNil)
+	root2 := ref.Root()
+	size, err := st.CensusDB().SizeByRoot(root1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(size, qt.Equals, 1)
+
+	// updating the census of the process releases the previous root
+	c.Assert(st.UpdateProcess(pid, func(p *types.Process) error {
+		p.Census.CensusRoot = root2
+		return nil
+	}), qt.IsNil)
+	_, err = st.CensusDB().SizeByRoot(root1)
+	c.Assert(err, qt.ErrorIs, census.ErrCensusRootNotFound)
+	snapshot, err := st.CensusDB().Snapshot(root2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(snapshot.Size, qt.Equals, 2)
+
+	// overwriting the process releases the previous root too, and storing
+	// the same root again does not retain it twice
+	c.Assert(ref.Insert([]byte("key3"), []byte{3}), qt.IsNil)
+	root3 := ref.Root()
+	for range 2 {
+		c.Assert(st.SetProcess(&types.Process{
+			ID:     pid.Marshal(),
+			Census: &types.Census{CensusRoot: root3},
+		}), qt.IsNil)
+	}
+	_, err = st.CensusDB().SizeByRoot(root2)
+	c.Assert(err, qt.ErrorIs, census.ErrCensusRootNotFound)
+	c.Assert(ref.Insert([]byte("key4"), []byte{4}), qt.IsNil)
+	c.Assert(st.SetProcess(&types.Process{ID: pid.Marshal()}), qt.IsNil)
+	_, err = st.CensusDB().SizeByRoot(root3)
+	c.Assert(err, qt.ErrorIs, census.ErrCensusRootNotFound)
+
+	// processes with external census roots are stored
+	pid2 := &types.ProcessID{Address: common.Address{}, Nonce: 2, ChainID: 1}
+	c.Assert(st.SetProcess(&types.Process{
+		ID:     pid2.Marshal(),
+		Census: &types.Census{CensusRoot: []byte{0x01, 0x02}},
+	}), qt.IsNil)
+}
+
+func TestSweepCensusesKeepsProcessCensus(t *testing.T) {
+	c := qt.New(t)
+	st := New(metadb.NewTest(t))
+
+	ref, err := st.CensusDB().New(uuid.New())
+	c.Assert(err, qt.IsNil)
+	c.Assert(ref.Insert([]byte("key1"), []byte{1}), qt.IsNil)
+	root := ref.Root()
+	pid := &types.ProcessID{Address: common.Address{}, Nonce: 1, ChainID: 1}
+	c.Assert(st.SetProcess(&types.Process{
+		ID:     pid.Marshal(),
+		Census: &types.Census{CensusRoot: root},
+	}), qt.IsNil)
+	// drop the retention to check the process reference on its own
+	c.Assert(st.CensusDB().ReleaseRoot(root, pid.Marshal()), qt.IsNil)
+
+	unused, err := st.CensusDB().New(uuid.New())
+	c.Assert(err, qt.IsNil)
+	c.Assert(unused.Insert([]byte("key2"), []byte{1}), qt.IsNil)
+
+	ref.LastUsed = time.Now().Add(-time.Hour)
+	unused.LastUsed = time.Now().Add(-time.Hour)
+	report, err := st.SweepCensuses(census.SweepConfig{
+		IdleTimeout: time.Minute,
+		Retention:   time.Minute,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(report.Unloaded, qt.HasLen, 2)
+	c.Assert(report.Deleted, qt.DeepEquals, []uuid.UUID{unused.ID})
+	c.Assert(st.CensusDB().Exists(ref.ID), qt.IsTrue)
+}
+
+func TestListProcessSummaries(t *testing.T) {
+	c := qt.New(t)
+	st := New(metadb.NewTest(t))
+
+	org1, org2 := common.Address{1}, common.Address{2}
+	start := time.Now().Truncate(time.Second)
+	pids := []*types.ProcessID{
+		{Address: org1, Nonce: 1, ChainID: 1},
+		{Address: org1, Nonce: 2, ChainID: 1},
+		{Address: org2, Nonce: 1, ChainID: 1},
+		{Address: org1, Nonce: 1, ChainID: 2},
+	}
+	for i, pid := range pids {
+		c.Assert(st.SetProcess(&types.Process{
+			ID:        pid.Marshal(),
+			StateRoot: []byte{byte(i)},
+			StartTime: start.Add(time.Duration(i) * time.Hour),
+			Duration:  time.Hour,
+		}), qt.IsNil)
+	}
+	ended := types.ProcessStatusEnded
+	c.Assert(st.UpdateProcess(pids[1], func(p *types.Process) error {
+		p.Status = ended
+		p.StateRoot = []byte{0xff}
+		return nil
+	}), qt.IsNil)
+
+	ids := func(summaries []*ProcessSummary) []string {
+		list := []string{}
+		for _, s := range summaries {
+			list = append(list, s.ID.String())
+		}
+		return list
+	}
+	all, err := st.ListProcessSummaries(nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(all, qt.HasLen, 4)
+	c.Assert(all[1].Status, qt.Equals, ended)
+	c.Assert(all[1].StateRoot, qt.DeepEquals, types.HexBytes{0xff})
+	c.Assert(all[3].ChainID, qt.Equals, uint32(2))
+
+	// filter by chain and organization
+	chainID := uint32(1)
+	list, err := st.ListProcessSummaries(&ProcessFilter{ChainID: &chainID, OrganizationID: &org1})
+	c.Assert(err, qt.IsNil)
+	c.Assert(ids(list), qt.DeepEquals, ids(all[:2]))
+	list, err = st.ListProcessSummaries(&ProcessFilter{OrganizationID: &org1})
+	c.Assert(err, qt.IsNil)
+	c.Assert(ids(list), qt.DeepEquals, []string{all[0].ID.String(), all[1].ID.String(), all[3].ID.String()})
+
+	// filter by status and time window
+	list, err = st.ListProcessSummaries(&ProcessFilter{Status: &ended})
+	c.Assert(err, qt.IsNil)
+	c.Assert(ids(list), qt.DeepEquals, ids(all[1:2]))
+	list, err = st.ListProcessSummaries(&ProcessFilter{
+		From: start.Add(130 * time.Minute),
+		To:   start.Add(170 * time.Minute),
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(ids(list), qt.DeepEquals, ids(all[2:3]))
+
+	// paginate
+	list, err = st.ListProcessSummaries(&ProcessFilter{Limit: 3})
+	c.Assert(err, qt.IsNil)
+	c.Assert(ids(list), qt.DeepEquals, ids(all[:3]))
+	list, err = st.ListProcessSummaries(&ProcessFilter{Limit: 3, After: list[2].ID})
+	c.Assert(err, qt.IsNil)
+	c.Assert(ids(list), qt.DeepEquals, ids(all[3:]))
+
+	// the ballots are counted through the queues
+	pid := pids[0].Marshal()
+	c.Assert(st.PushBallot(&Ballot{ProcessID: pid, Nullifier: []byte{1}}), qt.IsNil)
+	c.Assert(st.PushBallot(&Ballot{ProcessID: pid, Nullifier: []byte{2}}), qt.IsNil)
+	_, key, err := st.NextBallot()
+	c.Assert(err, qt.IsNil)
+	c.Assert(st.MarkBallotDone(key, &VerifiedBallot{ProcessID: pid, VoterWeight: big.NewInt(1)}), qt.IsNil)
+	list, err = st.ListProcessSummaries(&ProcessFilter{Limit: 1})
+	c.Assert(err, qt.IsNil)
+	c.Assert(list[0].BallotsAccepted, qt.Equals, 2)
+	c.Assert(list[0].BallotsVerified, qt.Equals, 1)
+	c.Assert(list[0].PendingBallots, qt.Equals, 1)
+	c.Assert(list[0].VerifiedBallots, qt.Equals, 1)
+	c.Assert(list[0].AggregatedBatches, qt.Equals, 0)
+}
+
+func TestProcessEvents(t *testing.T) {
+	c := qt.New(t)
+	st := New(metadb.NewTest(t))
+
+	pid := &types.ProcessID{Address: common.Address{1}, Nonce: 1, ChainID: 1}
+	c.Assert(st.SetProcess(&types.Process{ID: pid.Marshal()}), qt.IsNil)
+	_, sub := st.Events().Subscribe(pid.Marshal(), 0)
+	defer st.Events().Unsubscribe(sub)
+
+	c.Assert(st.PushBallot(&Ballot{ProcessID: pid.Marshal(), Nullifier: []byte{1}}), qt.IsNil)
+	e := <-sub.C
+	c.Assert(e.Type, qt.Equals, events.BallotStatus)
+	c.Assert(e.Data.(*events.BallotStatusData).Status, qt.Equals, events.BallotPending)
+
+	c.Assert(st.UpdateProcess(pid, func(p *types.Process) error {
+		p.StateRoot = []byte{0xaa}
+		p.Status = types.ProcessStatusEnded
+		p.Result = []*types.BigInt{new(types.BigInt).SetUint64(1)}
+		return nil
+	}), qt.IsNil)
+	for _, expected := range []events.Type{events.StateRoot, events.ProcessEnded, events.ResultsReady} {
+		c.Assert((<-sub.C).Type, qt.Equals, expected)
+	}
+
+	// unchanged fields are not published again
+	c.Assert(st.UpdateProcess(pid, func(p *types.Process) error {
+		p.MetadataURI = "https://example.com/metadata"
+		return nil
+	}), qt.IsNil)
+	c.Assert(sub.C, qt.HasLen, 0)
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.vocdoni.io/dvote/db/prefixeddb"
+)
+
+// Queue names of the QueueStats.
+const (
+	QueueBallots           = "ballots"
+	QueueVerifiedBallots   = "verifiedBallots"
+	QueueAggregatedBatches = "aggregatedBatches"
+)
+
+// processIDLen is the length of the encoded process IDs that prefix the keys
+// of the verified ballots and aggregated batches queues.
+const processIDLen = 4 + common.AddressLength + 8
+
+// QueueStats are the number of items of each queue of the storage.
+type QueueStats struct {
+	// Depths is the number of items of each queue by hex encoded process ID.
+	// The processes without items are omitted.
+	Depths map[string]map[string]int
+	// Reservations is the number of reserved items of each queue.
+	Reservations map[string]int
+}
+
+// QueueStats returns the number of items of each queue of the storage. The
+// pending ballots are not keyed by process, so their number is taken from the
+// ballot counters of each process. It does not hold the storage lock, so it
+// does not block the queues while scanning them: each queue is read from a
+// point-in-time view of the database, but the items moved between queues
+// during the scan might be counted in both or in none.
+func (s *Storage) QueueStats() (*QueueStats, error) {
+	stats := &QueueStats{
+		Depths: map[string]map[string]int{
+			QueueBallots:           {},
+			QueueVerifiedBallots:   {},
+			QueueAggregatedBatches: {},
+		},
+		Reservations: map[string]int{},
+	}
+	var decodeErr error
+	if err := prefixeddb.NewPrefixedReader(s.db, processStatsPrefix).Iterate(nil, func(k, v []byte) bool {
+		ps := &ProcessStats{}
+		if err := decodeArtifact(v, ps); err != nil {
+			decodeErr = fmt.Errorf("could not decode process stats %x: %w", k, err)
+			return false
+		}
+		if pending := ps.BallotsAccepted - ps.BallotsVerified; pending > 0 {
+			stats.Depths[QueueBallots][hex.EncodeToString(k)] = pending
+		}
+		return true
+	}); err != nil {
+		return nil, fmt.Errorf("could not iterate process stats: %w", err)
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	for queue, prefix := range map[string][]byte{
+		QueueVerifiedBallots:   verifiedBallotPrefix,
+		QueueAggregatedBatches: aggregBatchPrefix,
+	} {
+		depths := stats.Depths[queue]
+		if err := prefixeddb.NewPrefixedReader(s.db, prefix).Iterate(nil, func(k, _ []byte) bool {
+			if len(k) >= processIDLen {
+				depths[hex.EncodeToString(k[:processIDLen])]++
+			}
+			return true
+		}); err != nil {
+			return nil, fmt.Errorf("could not iterate %s queue: %w", queue, err)
+		}
+	}
+	for queue, prefix := range map[string][]byte{
+		QueueBallots:           ballotReservationPrefix,
+		QueueVerifiedBallots:   verifiedBallotReservPrefix,
+		QueueAggregatedBatches: aggregBatchReservPrefix,
+	} {
+		count := 0
+		if err := prefixeddb.NewPrefixedReader(s.db, prefix).Iterate(nil, func(_, _ []byte) bool {
+			count++
+			return true
+		}); err != nil {
+			return nil, fmt.Errorf("could not iterate %s reservations: %w", queue, err)
+		}
+		stats.Reservations[queue] = count
+	}
+	return stats, nil
+}
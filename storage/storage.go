@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/vocdoni/vocdoni-z-sandbox/events"
 	"github.com/vocdoni/vocdoni-z-sandbox/log"
 	"github.com/vocdoni/vocdoni-z-sandbox/storage/census"
 	"go.vocdoni.io/dvote/db"
@@ -28,6 +29,8 @@ var (
 	aggregBatchReservPrefix    = []byte("agr/")
 	encryptionKeyPrefix        = []byte("ek/")
 	processPrefix              = []byte("p/")
+	processIndexPrefix         = []byte("pi/")
+	processStatsPrefix         = []byte("ps/")
 
 	censusDBprefix = []byte("cs_")
 
@@ -44,6 +47,8 @@ type Storage struct {
 	db         db.Database
 	censusDB   *census.CensusDB
 	globalLock sync.Mutex
+	// events publishes the changes of the processes and their ballots
+	events *events.Bus
 }
 
 // New creates a new Storage instance.
@@ -51,11 +56,16 @@ func New(db db.Database) *Storage {
 	s := &Storage{
 		db:       db,
 		censusDB: census.NewCensusDB(prefixeddb.NewPrefixedDatabase(db, censusDBprefix)),
+		events:   events.NewBus(events.DefaultHistorySize),
 	}
 	// clear stale reservations
 	if err := s.recover(); err != nil {
 		log.Errorw(err, "failed to clear stale reservations")
 	}
+	// index the processes stored before the process index existed
+	if err := s.indexProcesses(); err != nil {
+		log.Errorw(err, "failed to index processes")
+	}
 	return s
 }
 
@@ -295,6 +305,12 @@ func (s *Storage) listArtifacts(prefix []byte) ([][]byte, error) {
 	return keys, nil
 }
 
+// Events returns the event bus where the storage publishes the changes of the
+// processes and their ballots.
+func (s *Storage) Events() *events.Bus {
+	return s.events
+}
+
 // CensusDB returns the census database instance.
 func (s *Storage) CensusDB() *census.CensusDB {
 	return s.censusDB
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"bytes"
+	"encoding/hex"
 	"math/big"
 	"path/filepath"
 	"testing"
@@ -261,3 +262,29 @@ func TestBallotBatchQueue(t *testing.T) {
 	_, _, err = st.NextBallotBatch(anotherPID.Marshal())
 	c.Assert(err, qt.Equals, ErrNoMoreElements)
 }
+
+func TestQueueStats(t *testing.T) {
+	c := qt.New(t)
+	st := New(metadb.NewTest(t))
+
+	pid := (&types.ProcessID{Address: common.Address{1}, Nonce: 1, ChainID: 1}).Marshal()
+	c.Assert(st.PushBallot(&Ballot{ProcessID: pid, Nullifier: []byte{1}}), qt.IsNil)
+	c.Assert(st.PushBallot(&Ballot{ProcessID: pid, Nullifier: []byte{2}}), qt.IsNil)
+	_, key, err := st.NextBallot()
+	c.Assert(err, qt.IsNil)
+	c.Assert(st.MarkBallotDone(key, &VerifiedBallot{ProcessID: pid, VoterWeight: big.NewInt(1)}), qt.IsNil)
+	_, _, err = st.NextBallot()
+	c.Assert(err, qt.IsNil)
+
+	stats, err := st.QueueStats()
+	c.Assert(err, qt.IsNil)
+	pidHex := hex.EncodeToString(pid)
+	c.Assert(stats.Depths[QueueBallots], qt.DeepEquals, map[string]int{pidHex: 1})
+	c.Assert(stats.Depths[QueueVerifiedBallots], qt.DeepEquals, map[string]int{pidHex: 1})
+	c.Assert(stats.Depths[QueueAggregatedBatches], qt.HasLen, 0)
+	c.Assert(stats.Reservations, qt.DeepEquals, map[string]int{
+		QueueBallots:           1,
+		QueueVerifiedBallots:   0,
+		QueueAggregatedBatches: 0,
+	})
+}
@@ -2,10 +2,12 @@ package storage
 
 import (
 	"math/big"
+	"time"
 
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
 	recursion "github.com/consensys/gnark/std/recursion/groth16"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/vocdoni/vocdoni-z-sandbox/crypto/elgamal"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 )
@@ -69,3 +71,29 @@ type AggregatorBallot struct {
 	Address         types.HexBytes     `json:"address"`
 	EncryptedBallot elgamal.Ciphertext `json:"encryptedBallots"`
 }
+
+// ProcessStats are the ballot counters of a process. BallotsAccepted counts
+// the ballots pushed to the pending queue and BallotsVerified the ballots
+// that passed to the verified queue.
+type ProcessStats struct {
+	BallotsAccepted int `json:"ballotsAccepted" cbor:"0,keyasint,omitempty"`
+	BallotsVerified int `json:"ballotsVerified" cbor:"1,keyasint,omitempty"`
+}
+
+// ProcessSummary is the summary of a process returned by
+// ListProcessSummaries. It includes the ballot counters of the process and
+// the number of items of the process waiting in each stage queue.
+type ProcessSummary struct {
+	ID                types.HexBytes `json:"id"`
+	ChainID           uint32         `json:"chainId"`
+	OrganizationID    common.Address `json:"organizationId"`
+	Status            uint8          `json:"status"`
+	StartTime         time.Time      `json:"startTime"`
+	Duration          time.Duration  `json:"duration"`
+	StateRoot         types.HexBytes `json:"stateRoot"`
+	BallotsAccepted   int            `json:"ballotsAccepted"`
+	BallotsVerified   int            `json:"ballotsVerified"`
+	PendingBallots    int            `json:"pendingBallots"`
+	VerifiedBallots   int            `json:"verifiedBallots"`
+	AggregatedBatches int            `json:"aggregatedBatches"`
+}
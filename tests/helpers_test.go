@@ -27,24 +27,23 @@ import (
 	"github.com/vocdoni/vocdoni-z-sandbox/service"
 	"github.com/vocdoni/vocdoni-z-sandbox/storage"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
-	"github.com/vocdoni/vocdoni-z-sandbox/util"
 	"github.com/vocdoni/vocdoni-z-sandbox/web3"
+	"github.com/vocdoni/vocdoni-z-sandbox/web3/simulated"
 )
 
 const testLocalAccountPrivKey = "0cebebc37477f513cd8f946ffced46e368aa4f9430250ce4507851edbba86b20" // defined in docker/files/genesis.json
 
-// setupAPI creates and starts a new API server for testing.
-// It returns the server port.
-func setupAPI(ctx context.Context, db *storage.Storage) (*service.APIService, error) {
-	tmpPort := util.RandomInt(40000, 60000)
-
-	api := service.NewAPI(db, "127.0.0.1", tmpPort)
+// setupAPI creates and starts a new API server for testing that checks the
+// organization administrators of the chainID provided. The administrative
+// endpoints are not authenticated. It listens on a free port, returned by the
+// HostPort method of the service.
+func setupAPI(ctx context.Context, db *storage.Storage, chainID uint32, orgAdmins api.OrganizationAdmins) (*service.APIService, error) {
+	api := service.NewAPI(db, "127.0.0.1", 0)
+	api.SetOrganizationAdmins(chainID, orgAdmins)
+	api.SetInsecureNoAuth(true)
 	if err := api.Start(ctx); err != nil {
 		return nil, err
 	}
-
-	// Wait for the HTTP server to start
-	time.Sleep(500 * time.Millisecond)
 	return api, nil
 }
 
@@ -53,23 +52,20 @@ func NewTestClient(port int) (*client.HTTPclient, error) {
 	return client.New(fmt.Sprintf("http://127.0.0.1:%d", port))
 }
 
+// NewTestService starts the sequencer services for testing. The contracts
+// are deployed on an in-process simulated chain, unless the TEST_GETH_DOCKER
+// environment variable is set, which uses the geth node of the docker compose
+// file instead.
 func NewTestService(t *testing.T, ctx context.Context) (*service.APIService, *storage.Storage, *web3.Contracts) {
-	log.Infow("starting Geth docker compose")
-	compose, err := tc.NewDockerCompose("docker/docker-compose.yml")
-	qt.Assert(t, err, qt.IsNil)
-	t.Cleanup(func() {
-		err := compose.Down(ctx, tc.RemoveOrphans(true), tc.RemoveVolumes(true))
+	var contracts *web3.Contracts
+	if os.Getenv("TEST_GETH_DOCKER") != "" {
+		contracts = deployDockerContracts(t, ctx)
+	} else {
+		log.Infow("deploying contracts on a simulated chain")
+		sim, err := simulated.New(0)
 		qt.Assert(t, err, qt.IsNil)
-	})
-	ctx2, cancel := context.WithCancel(ctx)
-	t.Cleanup(cancel)
-	err = compose.Up(ctx2, tc.Wait(true))
-	qt.Assert(t, err, qt.IsNil)
-
-	log.Infow("deploying contracts")
-	contracts, err := web3.DeployContracts("http://localhost:8545", testLocalAccountPrivKey)
-	if err != nil {
-		log.Fatal(err)
+		t.Cleanup(func() { _ = sim.Close() })
+		contracts = sim.Contracts
 	}
 	log.Infow("contracts deployed", "chainId", contracts.ChainID)
 
@@ -88,13 +84,36 @@ func NewTestService(t *testing.T, ctx context.Context) (*service.APIService, *st
 	}
 	t.Cleanup(pm.Stop)
 
-	api, err := setupAPI(ctx, stg)
+	api, err := setupAPI(ctx, stg, uint32(contracts.ChainID), contracts)
 	qt.Assert(t, err, qt.IsNil)
 	t.Cleanup(api.Stop)
 
 	return api, stg, contracts
 }
 
+// deployDockerContracts starts the geth node of the docker compose file and
+// deploys the contracts on it.
+func deployDockerContracts(t *testing.T, ctx context.Context) *web3.Contracts {
+	log.Infow("starting Geth docker compose")
+	compose, err := tc.NewDockerCompose("docker/docker-compose.yml")
+	qt.Assert(t, err, qt.IsNil)
+	t.Cleanup(func() {
+		err := compose.Down(ctx, tc.RemoveOrphans(true), tc.RemoveVolumes(true))
+		qt.Assert(t, err, qt.IsNil)
+	})
+	ctx2, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	err = compose.Up(ctx2, tc.Wait(true))
+	qt.Assert(t, err, qt.IsNil)
+
+	log.Infow("deploying contracts")
+	contracts, err := web3.DeployContracts("http://localhost:8545", testLocalAccountPrivKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return contracts
+}
+
 func createCensus(c *qt.C, cli *client.HTTPclient, size int) ([]byte, []*api.CensusParticipant, []*ethereum.SignKeys) {
 	// Create a new census
 	body, code, err := cli.Request(http.MethodPost, nil, nil, api.NewCensusEndpoint)
@@ -123,21 +142,23 @@ func createCensus(c *qt.C, cli *client.HTTPclient, size int) ([]byte, []*api.Cen
 
 	// Add participants to census
 	addEnpoint := api.EndpointWithParam(api.AddCensusParticipantsEndpoint, api.CensusURLParam, resp.Census.String())
-	_, code, err = cli.Request(http.MethodPost, censusParticipants, nil, addEnpoint)
+	authHeader := http.Header{api.CensusAuthTokenHeader: []string{resp.AuthToken}}
+	_, code, err = cli.RequestWithHeaders(http.MethodPost, censusParticipants, authHeader, nil, addEnpoint)
 	c.Assert(err, qt.IsNil)
 	c.Assert(code, qt.Equals, http.StatusOK)
 
-	// Get census root
-	getRootEnpoint := api.EndpointWithParam(api.GetCensusRootEndpoint, api.CensusURLParam, resp.Census.String())
-	body, code, err = cli.Request(http.MethodGet, nil, nil, getRootEnpoint)
+	// Publish the census to lock it and get its root
+	publishEnpoint := api.EndpointWithParam(api.PublishCensusEndpoint, api.CensusURLParam, resp.Census.String())
+	body, code, err = cli.RequestWithHeaders(http.MethodPost, nil, authHeader, nil, publishEnpoint)
 	c.Assert(err, qt.IsNil)
 	c.Assert(code, qt.Equals, http.StatusOK)
 
-	var rootResp api.CensusRoot
-	err = json.NewDecoder(bytes.NewReader(body)).Decode(&rootResp)
+	var published api.PublishedCensus
+	err = json.NewDecoder(bytes.NewReader(body)).Decode(&published)
 	c.Assert(err, qt.IsNil)
+	c.Assert(published.Size, qt.Equals, size)
 
-	return rootResp.Root, censusParticipants.Participants, signers
+	return published.Root, censusParticipants.Participants, signers
 }
 
 func generateCensusProof(c *qt.C, cli *client.HTTPclient, root []byte, key []byte) *types.CensusProof {
@@ -172,24 +193,18 @@ func createProcess(c *qt.C, contracts *web3.Contracts, cli *client.HTTPclient, c
 	nonce, err := contracts.AccountNonce()
 	c.Assert(err, qt.IsNil)
 
-	// Sign the process creation request
-	signature, err := contracts.SignMessage([]byte(fmt.Sprintf("%d%d", contracts.ChainID, nonce)))
-	c.Assert(err, qt.IsNil)
-
 	process := &types.ProcessSetup{
-		CensusRoot: censusRoot,
-		BallotMode: ballotMode,
-		Nonce:      nonce,
-		ChainID:    uint32(contracts.ChainID),
-		Signature:  signature,
+		CensusRoot:     censusRoot,
+		BallotMode:     ballotMode,
+		Nonce:          nonce,
+		ChainID:        uint32(contracts.ChainID),
+		OrganizationID: contracts.AccountAddress(),
 	}
-
-	body, code, err := cli.Request(http.MethodPost, process, nil, api.ProcessesEndpoint)
+	// Sign the process creation request
+	process.Signature, err = contracts.SignMessage(process.SignatureMessage())
 	c.Assert(err, qt.IsNil)
-	c.Assert(code, qt.Equals, http.StatusOK, qt.Commentf("response body %s", string(body)))
 
-	var resp types.ProcessSetupResponse
-	err = json.NewDecoder(bytes.NewReader(body)).Decode(&resp)
+	resp, err := cli.NewProcess(process)
 	c.Assert(err, qt.IsNil)
 	c.Assert(resp.ProcessID, qt.Not(qt.IsNil))
 	c.Assert(resp.EncryptionPubKey[0], qt.Not(qt.IsNil))
@@ -0,0 +1,92 @@
+package types
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Census origin values, as defined in the ProcessRegistry contract.
+const (
+	CensusOriginUnknown uint8 = iota
+	CensusOriginOffChainTree
+	CensusOriginOffChainTreeWeighted
+	CensusOriginOffChainCA
+	CensusOriginERC20
+	CensusOriginERC721
+	CensusOriginERC1155
+	CensusOriginERC777
+	CensusOriginMiniMe
+	CensusOriginFarcasterFrame
+)
+
+// TokenCensusURIScheme is the scheme of the census URI of the token holder
+// censuses.
+const TokenCensusURIScheme = "erc20"
+
+// TokenCensus identifies a census of the holders of an ERC-20 token at a
+// given block, where the weight of each holder is its balance. It is encoded
+// in the census URI of the processes with the CensusOriginERC20 origin as
+// erc20://<chainID>/<token>?block=<block>&fromBlock=<fromBlock>, where
+// fromBlock is optional and should be the block where the token was
+// deployed, to avoid scanning the whole chain.
+type TokenCensus struct {
+	ChainID   uint64
+	Token     common.Address
+	Block     uint64
+	FromBlock uint64
+}
+
+// ParseTokenCensusURI decodes the token census of the census URI provided.
+func ParseTokenCensusURI(uri string) (*TokenCensus, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token census URI: %w", err)
+	}
+	if u.Scheme != TokenCensusURIScheme {
+		return nil, fmt.Errorf("invalid token census URI scheme %q", u.Scheme)
+	}
+	tc := &TokenCensus{}
+	if tc.ChainID, err = strconv.ParseUint(u.Host, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid token census chainID: %w", err)
+	}
+	token := u.Path
+	if len(token) > 0 && token[0] == '/' {
+		token = token[1:]
+	}
+	if !common.IsHexAddress(token) {
+		return nil, fmt.Errorf("invalid token census address %q", token)
+	}
+	tc.Token = common.HexToAddress(token)
+	query := u.Query()
+	if tc.Block, err = strconv.ParseUint(query.Get("block"), 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid token census block: %w", err)
+	}
+	if fromBlock := query.Get("fromBlock"); fromBlock != "" {
+		if tc.FromBlock, err = strconv.ParseUint(fromBlock, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid token census from block: %w", err)
+		}
+	}
+	if tc.FromBlock > tc.Block {
+		return nil, fmt.Errorf("token census from block %d after block %d", tc.FromBlock, tc.Block)
+	}
+	return tc, nil
+}
+
+// URI returns the census URI of the token census.
+func (tc *TokenCensus) URI() string {
+	query := url.Values{}
+	query.Set("block", strconv.FormatUint(tc.Block, 10))
+	if tc.FromBlock > 0 {
+		query.Set("fromBlock", strconv.FormatUint(tc.FromBlock, 10))
+	}
+	u := url.URL{
+		Scheme:   TokenCensusURIScheme,
+		Host:     strconv.FormatUint(tc.ChainID, 10),
+		Path:     "/" + tc.Token.Hex(),
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"fmt"
 	"math/big"
 	"time"
 
@@ -13,6 +14,15 @@ type (
 	MultilingualString map[string]string
 )
 
+// Process status values, as defined in the ProcessRegistry contract.
+const (
+	ProcessStatusReady uint8 = iota
+	ProcessStatusEnded
+	ProcessStatusCanceled
+	ProcessStatusPaused
+	ProcessStatusResults
+)
+
 type MediaMetadata struct {
 	Header string `json:"header" cbor:"0,keyasint,omitempty"`
 	Logo   string `json:"logo"   cbor:"1,keyasint,omitempty"`
@@ -44,6 +54,23 @@ type Metadata struct {
 	ProcessType ProcessType        `json:"processType" cbor:"4,keyasint,omitempty"`
 }
 
+// ChoiceFields returns the index of the ballot field that holds the votes of
+// each choice of each question of the metadata, indexed by question and
+// choice. The fields of the ballot are laid out as the choices of the first
+// question, followed by the choices of the second question, and so on.
+func (m *Metadata) ChoiceFields() [][]int {
+	fields := make([][]int, len(m.Questions))
+	next := 0
+	for q, question := range m.Questions {
+		fields[q] = make([]int, len(question.Choices))
+		for c := range question.Choices {
+			fields[q][c] = next
+			next++
+		}
+	}
+	return fields
+}
+
 type Process struct {
 	ID             HexBytes       `json:"id,omitempty"             cbor:"0,keyasint,omitempty"`
 	Status         uint8          `json:"status"                   cbor:"1,keyasint,omitempty"`
@@ -67,6 +94,15 @@ func (p *Process) String() string {
 	return string(data)
 }
 
+// ProcessChange is a change of a process observed on chain after its
+// creation. Only the fields changed are set.
+type ProcessChange struct {
+	ProcessID HexBytes
+	Status    *uint8
+	StateRoot HexBytes
+	Duration  *time.Duration
+}
+
 type EncryptionKey struct {
 	X *big.Int `json:"x" cbor:"0,keyasint,omitempty"`
 	Y *big.Int `json:"y" cbor:"1,keyasint,omitempty"`
@@ -81,19 +117,30 @@ type Census struct {
 
 // CensusProof is the struct to represent a proof of inclusion in the census
 // merkle tree. For example, it will be provided by the user to verify that he
-// or she can vote in the process.
+// or she can vote in the process. The proofs of the censuses with the
+// CensusOriginOffChainCA origin are not merkle proofs but the signature of
+// the voter key and weight by a Credential Service Provider (CSP), so they
+// include its public key and signature instead of the value and siblings.
 type CensusProof struct {
-	Root     HexBytes `json:"root"`
-	Key      HexBytes `json:"key"`
-	Value    HexBytes `json:"value"`
-	Siblings HexBytes `json:"siblings"`
-	Weight   *BigInt  `json:"weight"`
+	CensusOrigin uint8    `json:"censusOrigin,omitempty"`
+	Root         HexBytes `json:"root"`
+	Key          HexBytes `json:"key"`
+	Value        HexBytes `json:"value"`
+	Siblings     HexBytes `json:"siblings"`
+	Weight       *BigInt  `json:"weight"`
+	PublicKey    HexBytes `json:"publicKey,omitempty"`
+	Signature    HexBytes `json:"signature,omitempty"`
 }
 
 // Valid checks that the CensusProof is well-formed
 func (cp *CensusProof) Valid() bool {
-	return cp.Root != nil && cp.Key != nil && cp.Value != nil &&
-		cp.Siblings != nil && cp.Weight != nil
+	if cp.Root == nil || cp.Key == nil || cp.Weight == nil {
+		return false
+	}
+	if cp.CensusOrigin == CensusOriginOffChainCA {
+		return cp.PublicKey != nil && cp.Signature != nil
+	}
+	return cp.Value != nil && cp.Siblings != nil
 }
 
 type OrganizationInfo struct {
@@ -110,13 +157,23 @@ func (o *OrganizationInfo) String() string {
 	return string(data)
 }
 
-// ProcessSetup is the struct to create a new voting process
+// ProcessSetup is the struct to create a new voting process. It must be
+// signed by the organization of the process or by one of its administrators,
+// see SignatureMessage.
 type ProcessSetup struct {
-	CensusRoot HexBytes   `json:"censusRoot"`
-	BallotMode BallotMode `json:"ballotRules"`
-	Nonce      uint64     `json:"nonce"`
-	ChainID    uint32     `json:"chainId"`
-	Signature  []byte     `json:"signature"`
+	CensusRoot     HexBytes       `json:"censusRoot"`
+	BallotMode     BallotMode     `json:"ballotRules"`
+	Nonce          uint64         `json:"nonce"`
+	ChainID        uint32         `json:"chainId"`
+	OrganizationID common.Address `json:"organizationId"`
+	Signature      []byte         `json:"signature"`
+}
+
+// SignatureMessage returns the message signed to set up the process, which
+// binds the chain ID, the nonce and the organization address, so the
+// signature cannot be used to set up a process of another organization.
+func (p *ProcessSetup) SignatureMessage() []byte {
+	return []byte(fmt.Sprintf("%d:%d:%x", p.ChainID, p.Nonce, p.OrganizationID.Bytes()))
 }
 
 // ProcessSetupResponse represents the response of a voting process
@@ -0,0 +1,27 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestMetadataChoiceFields(t *testing.T) {
+	c := qt.New(t)
+	metadata := &Metadata{Questions: []Question{
+		{Choices: []Choice{{Value: 0}, {Value: 1}, {Value: 2}}},
+		{},
+		{Choices: []Choice{{Value: 0}, {Value: 1}}},
+	}}
+	c.Assert(metadata.ChoiceFields(), qt.DeepEquals, [][]int{{0, 1, 2}, {}, {3, 4}})
+}
+
+func TestProcessSetupSignatureMessage(t *testing.T) {
+	c := qt.New(t)
+	setup := &ProcessSetup{ChainID: 1, Nonce: 23, OrganizationID: common.HexToAddress("0x0e9eb7dd35d3e0b7ab35b0a0b9da8e2a8b7c71b5")}
+	c.Assert(string(setup.SignatureMessage()), qt.Equals, "1:23:0e9eb7dd35d3e0b7ab35b0a0b9da8e2a8b7c71b5")
+	// the chain ID and the nonce are not ambiguous
+	other := &ProcessSetup{ChainID: 12, Nonce: 3, OrganizationID: setup.OrganizationID}
+	c.Assert(other.SignatureMessage(), qt.Not(qt.DeepEquals), setup.SignatureMessage())
+}
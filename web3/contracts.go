@@ -9,10 +9,11 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
 	bindings "github.com/vocdoni/contracts-z/golang-types/non-proxy"
-	"github.com/vocdoni/vocdoni-z-sandbox/crypto/ethereum"
 	"github.com/vocdoni/vocdoni-z-sandbox/log"
 	"github.com/vocdoni/vocdoni-z-sandbox/web3/rpc"
+	"github.com/vocdoni/vocdoni-z-sandbox/web3/signer"
 )
 
 const (
@@ -27,6 +28,13 @@ type Addresses struct {
 	ResultsRegistry      common.Address
 }
 
+// Backend is the interface of the clients used to interact with the chain,
+// it is implemented by rpc.Client and by the go-ethereum simulated backend.
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+}
+
 // Contracts contains the bindings to the deployed contracts.
 type Contracts struct {
 	ChainID            uint64
@@ -34,13 +42,23 @@ type Contracts struct {
 	organizations      *bindings.OrganizationRegistry
 	processes          *bindings.ProcessRegistry
 	web3pool           *rpc.Web3Pool
-	cli                *rpc.Client
-	signer             *ethereum.SignKeys
+	cli                Backend
+	signer             signer.Signer
 
 	knownProcesses        map[string]struct{}
 	lastWatchProcessBlock uint64
-	knownOrganizations    map[string]struct{}
-	lastWatchOrgBlock     uint64
+	// lastScannedProcessBlock is the last block whose process events have
+	// been processed by the process monitor, used to measure its lag against
+	// the chain head.
+	lastScannedProcessBlock uint64
+	// lastWatchProcessChangeBlock is the last block where a process change
+	// was found by the monitor.
+	lastWatchProcessChangeBlock uint64
+	knownOrganizations          map[string]struct{}
+	lastWatchOrgBlock           uint64
+	// lastWatchOrgUpdateBlock is the last block where an organization
+	// update was found by the monitor.
+	lastWatchOrgUpdateBlock uint64
 }
 
 // LoadContracts creates a new Contracts instance with the given web3 endpoint.
@@ -50,15 +68,35 @@ func LoadContracts(addresses *Addresses, web3rpc string) (*Contracts, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to add web3 endpoint: %w", err)
 	}
+	return LoadContractsFromPool(w3pool, chainID, addresses)
+}
+
+// LoadContractsFromPool creates a new Contracts instance for the chainID
+// provided using the endpoints of the web3 pool. The pool can be shared by
+// the Contracts instances of several chains, each one keeps its own signer
+// and monitor state.
+func LoadContractsFromPool(w3pool *rpc.Web3Pool, chainID uint64, addresses *Addresses) (*Contracts, error) {
 	cli, err := w3pool.Client(chainID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get client: %w", err)
 	}
-	organizations, err := bindings.NewOrganizationRegistry(addresses.OrganizationRegistry, cli)
+	c, err := NewContracts(cli, chainID, addresses)
+	if err != nil {
+		return nil, err
+	}
+	c.web3pool = w3pool
+	return c, nil
+}
+
+// NewContracts creates a new Contracts instance that binds the contracts at
+// the addresses provided using the backend provided, which can be any client
+// of the chainID provided, such as a simulated backend.
+func NewContracts(backend Backend, chainID uint64, addresses *Addresses) (*Contracts, error) {
+	organizations, err := bindings.NewOrganizationRegistry(addresses.OrganizationRegistry, backend)
 	if err != nil {
 		return nil, fmt.Errorf("failed to bind organization registry: %w", err)
 	}
-	process, err := bindings.NewProcessRegistry(addresses.ProcessRegistry, cli)
+	process, err := bindings.NewProcessRegistry(addresses.ProcessRegistry, backend)
 	if err != nil {
 		return nil, fmt.Errorf("failed to bind process registry: %w", err)
 	}
@@ -67,15 +105,25 @@ func LoadContracts(addresses *Addresses, web3rpc string) (*Contracts, error) {
 		organizations:      organizations,
 		processes:          process,
 		ChainID:            chainID,
-		web3pool:           w3pool,
-		cli:                cli,
+		cli:                backend,
 		knownProcesses:     make(map[string]struct{}),
 		knownOrganizations: make(map[string]struct{}),
 	}, nil
 }
 
-// DeployContracts deploys new contracts and returns the bindings.
+// DeployContracts deploys new contracts and returns the bindings. The
+// contracts are deployed by the account of the hex private key provided.
 func DeployContracts(web3rpc, privkey string) (*Contracts, error) {
+	s, err := signer.NewLocalSigner(privkey)
+	if err != nil {
+		return nil, err
+	}
+	return DeployContractsWithSigner(web3rpc, s)
+}
+
+// DeployContractsWithSigner deploys new contracts using the signer provided
+// and returns the bindings.
+func DeployContractsWithSigner(web3rpc string, s signer.Signer) (*Contracts, error) {
 	w3pool := rpc.NewWeb3Pool()
 	chainID, err := w3pool.AddEndpoint(web3rpc)
 	if err != nil {
@@ -85,23 +133,33 @@ func DeployContracts(web3rpc, privkey string) (*Contracts, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get client: %w", err)
 	}
+	c, err := DeployContractsWithBackend(cli, chainID, s)
+	if err != nil {
+		return nil, err
+	}
+	c.web3pool = w3pool
+	return c, nil
+}
+
+// DeployContractsWithBackend deploys new contracts using the backend and the
+// signer provided and returns the bindings. The backend must be a client of
+// the chainID provided. The transactions must be mined by the backend while
+// it waits for them, so a simulated backend must commit them automatically.
+func DeployContractsWithBackend(backend Backend, chainID uint64, s signer.Signer) (*Contracts, error) {
 	c := &Contracts{
 		ChainID:            chainID,
-		web3pool:           w3pool,
-		cli:                cli,
+		cli:                backend,
 		knownProcesses:     make(map[string]struct{}),
 		knownOrganizations: make(map[string]struct{}),
 		ContractsAddresses: &Addresses{},
-	}
-	if err := c.SetAccountPrivateKey(privkey); err != nil {
-		return nil, err
+		signer:             s,
 	}
 
 	opts, err := c.authTransactOpts()
 	if err != nil {
 		return nil, err
 	}
-	addr, tx, orgBindings, err := bindings.DeployOrganizationRegistry(opts, cli)
+	addr, tx, orgBindings, err := bindings.DeployOrganizationRegistry(opts, backend)
 	if err != nil {
 		return nil, fmt.Errorf("failed to deploy organization registry: %w", err)
 	}
@@ -116,7 +174,7 @@ func DeployContracts(web3rpc, privkey string) (*Contracts, error) {
 	if err != nil {
 		return nil, err
 	}
-	c.ContractsAddresses.ProcessRegistry, tx, c.processes, err = bindings.DeployProcessRegistry(opts, cli, strconv.Itoa(int(chainID)), c.ContractsAddresses.OrganizationRegistry)
+	c.ContractsAddresses.ProcessRegistry, tx, c.processes, err = bindings.DeployProcessRegistry(opts, backend, strconv.Itoa(int(chainID)), c.ContractsAddresses.OrganizationRegistry)
 	if err != nil {
 		return nil, fmt.Errorf("failed to deploy process registry: %w", err)
 	}
@@ -131,13 +189,9 @@ func DeployContracts(web3rpc, privkey string) (*Contracts, error) {
 // CheckTxStatus checks the status of a transaction given its hash.
 // Returns true if the transaction was successful, false otherwise.
 func (c *Contracts) CheckTxStatus(txHash common.Hash) (bool, error) {
-	ethcli, err := c.cli.EthClient()
-	if err != nil {
-		return false, fmt.Errorf("failed to get eth client: %w", err)
-	}
 	ctx, cancel := context.WithTimeout(context.Background(), web3QueryTimeout)
 	defer cancel()
-	receipt, err := ethcli.TransactionReceipt(ctx, txHash)
+	receipt, err := c.cli.TransactionReceipt(ctx, txHash)
 	if err != nil {
 		return false, fmt.Errorf("failed to get transaction receipt: %w", err)
 	}
@@ -160,57 +214,77 @@ func (c *Contracts) WaitTx(txHash common.Hash, timeOut time.Duration) error {
 	}
 }
 
-// AddWeb3Endpoint adds a new web3 endpoint to the pool.
+// AddWeb3Endpoint adds a new web3 endpoint to the pool. It returns an error if
+// the Contracts were created with a custom backend instead of a web3 pool.
 func (c *Contracts) AddWeb3Endpoint(web3rpc string) error {
+	if c.web3pool == nil {
+		return fmt.Errorf("contracts not backed by a web3 pool")
+	}
 	_, err := c.web3pool.AddEndpoint(web3rpc)
 	return err
 }
 
 // SetAccountPrivateKey sets the private key to be used for signing transactions.
 func (c *Contracts) SetAccountPrivateKey(hexPrivKey string) error {
-	signer := ethereum.SignKeys{}
-	if err := signer.AddHexKey(hexPrivKey); err != nil {
-		return fmt.Errorf("failed to add private key: %w", err)
+	s, err := signer.NewLocalSigner(hexPrivKey)
+	if err != nil {
+		return err
 	}
-	c.signer = &signer
+	c.signer = s
 	return nil
 }
 
+// SetSigner sets the signer to be used for signing transactions and messages.
+func (c *Contracts) SetSigner(s signer.Signer) {
+	c.signer = s
+}
+
 // AccountAddress returns the address of the account used to sign transactions.
+// It returns the zero address if no signer is set.
 func (c *Contracts) AccountAddress() common.Address {
+	if c.signer == nil {
+		return common.Address{}
+	}
 	return c.signer.Address()
 }
 
-// SignMessage signs a message with the account private key.
+// SignMessage signs a message with the account configured.
 func (c *Contracts) SignMessage(msg []byte) ([]byte, error) {
 	if c.signer == nil {
-		return nil, fmt.Errorf("no private key set")
+		return nil, fmt.Errorf("no signer set")
 	}
-	return c.signer.SignEthereum(msg)
+	return c.signer.SignMessage(msg)
 }
 
 // AccountNonce returns the nonce of the account used to sign transactions.
 func (c *Contracts) AccountNonce() (uint64, error) {
 	if c.signer == nil {
-		return 0, fmt.Errorf("no private key set")
+		return 0, fmt.Errorf("no signer set")
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), web3QueryTimeout)
 	defer cancel()
 	return c.cli.PendingNonceAt(ctx, c.signer.Address())
 }
 
-// authTransactOpts helper method creates the transact options with the private
-// key configured in the CommunityHub. It sets the nonce, gas price, and gas
-// limit. If something goes wrong creating the signer, getting the nonce, or
-// getting the gas price, it returns an error.
+// authTransactOpts helper method creates the transact options with the signer
+// configured in the Contracts. It sets the nonce and delegates the signature
+// of the transactions to the signer. If no signer is set or something goes
+// wrong getting the nonce, it returns an error.
 func (c *Contracts) authTransactOpts() (*bind.TransactOpts, error) {
 	if c.signer == nil {
-		return nil, fmt.Errorf("no private key set")
+		return nil, fmt.Errorf("no signer set")
 	}
 	bChainID := new(big.Int).SetUint64(c.ChainID)
-	auth, err := bind.NewKeyedTransactorWithChainID(&c.signer.Private, bChainID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transactor: %w", err)
+	from := c.signer.Address()
+	auth := &bind.TransactOpts{
+		From: from,
+		Signer: func(address common.Address, tx *gethtypes.Transaction) (*gethtypes.Transaction, error) {
+			if address != from {
+				return nil, bind.ErrNotAuthorized
+			}
+			return c.signer.SignTx(tx, bChainID)
+		},
+		Context: context.Background(),
 	}
 	// create the context with a timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
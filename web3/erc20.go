@@ -0,0 +1,122 @@
+package web3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+)
+
+// tokenLogsBlockRange is the number of blocks scanned on each query of the
+// transfer logs of a token, to stay below the limits of the web3 endpoints.
+const tokenLogsBlockRange = 10_000
+
+// ERC20TransferTopic is the topic of the Transfer(address,address,uint256)
+// event of the ERC-20 tokens.
+var ERC20TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// ErrUnknownChain is returned when the logs of a chain without known
+// endpoints are requested.
+var ErrUnknownChain = errors.New("unknown chain")
+
+// LogFilterer is the interface of the clients used to query the logs of the
+// chain, it is implemented by rpc.Client and by the go-ethereum simulated
+// backend.
+type LogFilterer interface {
+	FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]gethtypes.Log, error)
+}
+
+// TokenBalances returns the balances of the holders of the ERC-20 token
+// provided at the end of the block atBlock, computed from the Transfer logs
+// of the token emitted from the block fromBlock, which should be the block
+// where the token was deployed. The holders without balance are not
+// included.
+func TokenBalances(ctx context.Context, cli LogFilterer, token common.Address, fromBlock, atBlock uint64) (map[common.Address]*big.Int, error) {
+	if fromBlock > atBlock {
+		return nil, fmt.Errorf("from block %d after block %d", fromBlock, atBlock)
+	}
+	balances := make(map[common.Address]*big.Int)
+	for start := fromBlock; start <= atBlock; start += tokenLogsBlockRange {
+		end := min(start+tokenLogsBlockRange-1, atBlock)
+		ctxQuery, cancel := context.WithTimeout(ctx, web3QueryTimeout)
+		logs, err := cli.FilterLogs(ctxQuery, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: []common.Address{token},
+			Topics:    [][]common.Hash{{ERC20TransferTopic}},
+		})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter transfer logs of blocks %d-%d: %w", start, end, err)
+		}
+		for _, l := range logs {
+			// the ERC-721 transfers share the topic, but the token ID is
+			// indexed instead of the value
+			if l.Removed || len(l.Topics) != 3 || len(l.Data) != 32 {
+				continue
+			}
+			if err := applyTransfer(balances, l); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for holder, balance := range balances {
+		if balance.Sign() == 0 {
+			delete(balances, holder)
+		}
+	}
+	log.Debugw("token balances computed", "token", token.Hex(), "fromBlock", fromBlock,
+		"atBlock", atBlock, "holders", len(balances))
+	return balances, nil
+}
+
+// applyTransfer applies the Transfer log provided to the balances provided.
+// The transfers from and to the zero address are mints and burns.
+func applyTransfer(balances map[common.Address]*big.Int, l gethtypes.Log) error {
+	from := common.BytesToAddress(l.Topics[1].Bytes())
+	to := common.BytesToAddress(l.Topics[2].Bytes())
+	value := new(big.Int).SetBytes(l.Data)
+	if from != (common.Address{}) {
+		balance, ok := balances[from]
+		if !ok || balance.Cmp(value) < 0 {
+			return fmt.Errorf("transfer of %s from %s exceeds its balance (tx %s)", value, from.Hex(), l.TxHash.Hex())
+		}
+		balance.Sub(balance, value)
+	}
+	if to != (common.Address{}) {
+		if _, ok := balances[to]; !ok {
+			balances[to] = new(big.Int)
+		}
+		balances[to].Add(balances[to], value)
+	}
+	return nil
+}
+
+// TokenBalances returns the balances of the holders of the ERC-20 token
+// provided at the block atBlock of the chain chainID, scanning the Transfer
+// logs from the block fromBlock. The logs are queried through the client of
+// that chain in the web3 pool of the contracts, or through the client of the
+// contracts if they were not loaded from a pool. It returns an error if no
+// endpoint of the chain is known.
+func (c *Contracts) TokenBalances(ctx context.Context, chainID uint64, token common.Address, fromBlock, atBlock uint64) (map[common.Address]*big.Int, error) {
+	var cli LogFilterer
+	switch {
+	case c.web3pool != nil:
+		poolCli, err := c.web3pool.Client(chainID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownChain, chainID)
+		}
+		cli = poolCli
+	case chainID == c.ChainID:
+		cli = c.cli
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownChain, chainID)
+	}
+	return TokenBalances(ctx, cli, token, fromBlock, atBlock)
+}
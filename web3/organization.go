@@ -11,19 +11,82 @@ import (
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 )
 
-// CreateOrganization creates a new organization in the OrganizationRegistry contract.
-func (c *Contracts) CreateOrganization(address common.Address, orgInfo *types.OrganizationInfo) (common.Hash, error) {
+// CreateOrganization creates a new organization in the OrganizationRegistry
+// contract. The account used to sign the transaction is always an
+// administrator of the new organization, the administrators provided are
+// added to it.
+func (c *Contracts) CreateOrganization(address common.Address, orgInfo *types.OrganizationInfo, administrators ...common.Address) (common.Hash, error) {
 	txOpts, err := c.authTransactOpts()
 	if err != nil {
 		return common.Hash{}, fmt.Errorf("failed to create transact options: %w", err)
 	}
-	tx, err := c.organizations.CreateOrganization(txOpts, address, orgInfo.Name, orgInfo.MetadataURI, []common.Address{c.signer.Address()})
+	admins := append([]common.Address{c.signer.Address()}, administrators...)
+	tx, err := c.organizations.CreateOrganization(txOpts, address, orgInfo.Name, orgInfo.MetadataURI, admins)
 	if err != nil {
 		return common.Hash{}, fmt.Errorf("failed to create organization: %w", err)
 	}
 	return tx.Hash(), nil
 }
 
+// UpdateOrganization updates the name and the metadata URI of the
+// organization with the given address in the OrganizationRegistry contract.
+// The account used to sign the transaction must be an administrator of the
+// organization.
+func (c *Contracts) UpdateOrganization(address common.Address, orgInfo *types.OrganizationInfo) (common.Hash, error) {
+	txOpts, err := c.authTransactOpts()
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to create transact options: %w", err)
+	}
+	tx, err := c.organizations.UpdateOrganization(txOpts, address, orgInfo.Name, orgInfo.MetadataURI)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to update organization: %w", err)
+	}
+	return tx.Hash(), nil
+}
+
+// AddOrganizationAdministrator adds an administrator to the organization with
+// the given address in the OrganizationRegistry contract. The account used to
+// sign the transaction must be an administrator of the organization.
+func (c *Contracts) AddOrganizationAdministrator(address, administrator common.Address) (common.Hash, error) {
+	txOpts, err := c.authTransactOpts()
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to create transact options: %w", err)
+	}
+	tx, err := c.organizations.AddAdministrator(txOpts, address, administrator)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to add organization administrator: %w", err)
+	}
+	return tx.Hash(), nil
+}
+
+// RemoveOrganizationAdministrator removes an administrator from the
+// organization with the given address in the OrganizationRegistry contract.
+// The account used to sign the transaction must be an administrator of the
+// organization.
+func (c *Contracts) RemoveOrganizationAdministrator(address, administrator common.Address) (common.Hash, error) {
+	txOpts, err := c.authTransactOpts()
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to create transact options: %w", err)
+	}
+	tx, err := c.organizations.RemoveAdministrator(txOpts, address, administrator)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to remove organization administrator: %w", err)
+	}
+	return tx.Hash(), nil
+}
+
+// IsOrganizationAdministrator returns true if the account provided is an
+// administrator of the organization with the given address.
+func (c *Contracts) IsOrganizationAdministrator(address, account common.Address) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), web3QueryTimeout)
+	defer cancel()
+	isAdmin, err := c.organizations.IsAdministrator(&bind.CallOpts{Context: ctx}, address, account)
+	if err != nil {
+		return false, fmt.Errorf("failed to check organization administrator: %w", err)
+	}
+	return isAdmin, nil
+}
+
 // Organization returns the organization with the given address from the OrganizationRegistry contract.
 func (c *Contracts) Organization(address common.Address) (*types.OrganizationInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), web3QueryTimeout)
@@ -78,3 +141,55 @@ func (c *Contracts) MonitorOrganizationCreatedByPolling(ctx context.Context, int
 	}()
 	return ch, nil
 }
+
+// MonitorOrganizationUpdatedByPolling monitors the updates of organizations by
+// polling the logs of the blockchain. Every update found is sent with the
+// current organization information. The OrganizationRegistry contract does
+// not emit events when administrators are added or removed, so those changes
+// are not reported.
+func (c *Contracts) MonitorOrganizationUpdatedByPolling(ctx context.Context, interval time.Duration) (<-chan *types.OrganizationInfo, error) {
+	ch := make(chan *types.OrganizationInfo)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		// lastBlock and lastIndex point to the last event sent, so the events
+		// found again in the same block are not sent twice
+		lastBlock, lastIndex := c.lastWatchOrgUpdateBlock, -1
+		for {
+			select {
+			case <-ctx.Done():
+				log.Warnw("exiting monitor organizations update")
+				return
+			case <-ticker.C:
+				ctxQuery, cancel := context.WithTimeout(ctx, web3QueryTimeout)
+				iter, err := c.organizations.FilterOrganizationUpdated(&bind.FilterOpts{Start: lastBlock, Context: ctxQuery}, nil, nil)
+				cancel()
+				if err != nil || iter == nil {
+					log.Warnw("failed to filter organization updated, retrying", "err", err)
+					continue
+				}
+				for iter.Next() {
+					block, index := iter.Event.Raw.BlockNumber, int(iter.Event.Raw.Index)
+					if block < lastBlock || (block == lastBlock && index <= lastIndex) {
+						continue
+					}
+					lastBlock, lastIndex = block, index
+					c.lastWatchOrgUpdateBlock = block
+					org, err := c.Organization(iter.Event.Id)
+					if err != nil {
+						log.Errorw(err, "failed to get organization while monitoring updates")
+						continue
+					}
+					org.ID = iter.Event.Id
+					select {
+					case ch <- org:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"sort"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
 	bindings "github.com/vocdoni/contracts-z/golang-types/non-proxy"
 	"github.com/vocdoni/vocdoni-z-sandbox/log"
+	"github.com/vocdoni/vocdoni-z-sandbox/metrics"
 	"github.com/vocdoni/vocdoni-z-sandbox/types"
 )
 
@@ -48,12 +51,80 @@ func (c *Contracts) CreateProcess(process *types.Process) (*types.ProcessID, *co
 	return &pid, &hash, nil
 }
 
+// SetProcessStatus sets the status of the process with the given ID in the
+// ProcessRegistry contract. The account used to sign the transaction must be
+// an administrator of the organization of the process. It returns the
+// transaction hash.
+func (c *Contracts) SetProcessStatus(processID []byte, status uint8) (*common.Hash, error) {
+	txOpts, err := c.authTransactOpts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transact options: %w", err)
+	}
+	tx, err := c.processes.SetProcessStatus(txOpts, processID32(processID), status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set process status: %w", err)
+	}
+	hash := tx.Hash()
+	return &hash, nil
+}
+
+// EndProcess ends the process with the given ID in the ProcessRegistry
+// contract before its duration is over. It returns the transaction hash.
+func (c *Contracts) EndProcess(processID []byte) (*common.Hash, error) {
+	txOpts, err := c.authTransactOpts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transact options: %w", err)
+	}
+	tx, err := c.processes.EndProcess(txOpts, processID32(processID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to end process: %w", err)
+	}
+	hash := tx.Hash()
+	return &hash, nil
+}
+
+// CancelProcess cancels the process with the given ID in the ProcessRegistry
+// contract. It returns the transaction hash.
+func (c *Contracts) CancelProcess(processID []byte) (*common.Hash, error) {
+	return c.SetProcessStatus(processID, types.ProcessStatusCanceled)
+}
+
+// PauseProcess pauses the process with the given ID in the ProcessRegistry
+// contract. It returns the transaction hash.
+func (c *Contracts) PauseProcess(processID []byte) (*common.Hash, error) {
+	return c.SetProcessStatus(processID, types.ProcessStatusPaused)
+}
+
+// ResumeProcess resumes the paused process with the given ID in the
+// ProcessRegistry contract. It returns the transaction hash.
+func (c *Contracts) ResumeProcess(processID []byte) (*common.Hash, error) {
+	return c.SetProcessStatus(processID, types.ProcessStatusReady)
+}
+
+// SetProcessCensus updates the census of the process with the given ID in the
+// ProcessRegistry contract. The census root and URI are replaced, and the max
+// votes are only updated by the contract if they increase. It returns the
+// transaction hash.
+func (c *Contracts) SetProcessCensus(processID []byte, census *types.Census) (*common.Hash, error) {
+	if census == nil {
+		return nil, fmt.Errorf("nil census")
+	}
+	txOpts, err := c.authTransactOpts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transact options: %w", err)
+	}
+	tx, err := c.processes.SetProcessCensus(txOpts, processID32(processID), census2ContractCensus(census))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set process census: %w", err)
+	}
+	hash := tx.Hash()
+	return &hash, nil
+}
+
 // Process returns the process with the given ID from the ProcessRegistry contract.
 func (c *Contracts) Process(processID []byte) (*types.Process, error) {
-	var pid [32]byte
-	copy(pid[:], processID)
 	ctx, cancel := context.WithTimeout(context.Background(), web3QueryTimeout)
-	process, err := c.processes.GetProcess(&bind.CallOpts{Context: ctx}, pid)
+	process, err := c.processes.GetProcess(&bind.CallOpts{Context: ctx}, processID32(processID))
 	cancel()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get process: %w", err)
@@ -75,7 +146,19 @@ func (c *Contracts) MonitorProcessCreation(ctx context.Context, interval time.Du
 				return
 			case <-ticker.C:
 				ctxQuery, cancel := context.WithTimeout(ctx, web3QueryTimeout)
-				iter, err := c.processes.FilterProcessCreated(&bind.FilterOpts{Start: c.lastWatchProcessBlock, Context: ctxQuery}, nil, nil)
+				head, err := c.cli.HeaderByNumber(ctxQuery, nil)
+				if err != nil {
+					cancel()
+					log.Warnw("failed to get chain head, retrying", "err", err)
+					continue
+				}
+				if c.lastScannedProcessBlock > 0 {
+					metrics.SetMonitorLag(c.ChainID, head.Number.Uint64(), c.lastScannedProcessBlock)
+				}
+				// the filter is bounded to the head, so the last block
+				// processed is known once the events are consumed
+				end := head.Number.Uint64()
+				iter, err := c.processes.FilterProcessCreated(&bind.FilterOpts{Start: c.lastWatchProcessBlock, End: &end, Context: ctxQuery}, nil, nil)
 				cancel()
 				if err != nil || iter == nil {
 					log.Warnw("failed to filter process created, retrying", "err", err)
@@ -96,12 +179,130 @@ func (c *Contracts) MonitorProcessCreation(ctx context.Context, interval time.Du
 					c.lastWatchProcessBlock = iter.Event.Raw.BlockNumber
 					ch <- process
 				}
+				if err := iter.Error(); err != nil {
+					log.Warnw("failed to iterate process created, retrying", "err", err)
+					continue
+				}
+				c.lastScannedProcessBlock = end
 			}
 		}
 	}()
 	return ch, nil
 }
 
+// MonitorProcessChanges monitors the changes of the status, state root and
+// duration of the processes by polling the logs of the ProcessRegistry
+// contract every interval. The changes are sent in the order they happened
+// on chain. The results of a process, set along with the
+// ProcessStatusResults status, are read with Process.
+func (c *Contracts) MonitorProcessChanges(ctx context.Context, interval time.Duration) (<-chan *types.ProcessChange, error) {
+	ch := make(chan *types.ProcessChange)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		// lastBlock and lastIndex point to the last change sent, so the
+		// changes found again in the same block are not sent twice
+		lastBlock, lastIndex := c.lastWatchProcessChangeBlock, -1
+		for {
+			select {
+			case <-ctx.Done():
+				log.Warnw("exiting monitor process changes")
+				return
+			case <-ticker.C:
+				changes, err := c.processChanges(ctx, lastBlock)
+				if err != nil {
+					log.Warnw("failed to filter process changes, retrying", "err", err)
+					continue
+				}
+				for _, change := range changes {
+					block, index := change.raw.BlockNumber, int(change.raw.Index)
+					if block < lastBlock || (block == lastBlock && index <= lastIndex) {
+						continue
+					}
+					lastBlock, lastIndex = block, index
+					c.lastWatchProcessChangeBlock = block
+					select {
+					case ch <- change.change:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// processChangeLog is a process change with the log of the event that
+// reported it.
+type processChangeLog struct {
+	raw    ethtypes.Log
+	change *types.ProcessChange
+}
+
+// processChanges returns the process changes reported by the events of the
+// ProcessRegistry contract since the block provided, sorted by their
+// position on chain.
+func (c *Contracts) processChanges(ctx context.Context, start uint64) ([]*processChangeLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, web3QueryTimeout)
+	defer cancel()
+	opts := &bind.FilterOpts{Start: start, Context: ctx}
+	changes := []*processChangeLog{}
+
+	statusIter, err := c.processes.FilterProcessStatusChanged(opts, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter process status changed: %w", err)
+	}
+	for statusIter.Next() {
+		status := statusIter.Event.NewStatus
+		changes = append(changes, &processChangeLog{raw: statusIter.Event.Raw, change: &types.ProcessChange{
+			ProcessID: append(types.HexBytes{}, statusIter.Event.ProcessID[:]...),
+			Status:    &status,
+		}})
+	}
+	if err := statusIter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate process status changed: %w", err)
+	}
+
+	rootIter, err := c.processes.FilterProcessStateRootUpdated(opts, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter process state root updated: %w", err)
+	}
+	for rootIter.Next() {
+		changes = append(changes, &processChangeLog{raw: rootIter.Event.Raw, change: &types.ProcessChange{
+			ProcessID: append(types.HexBytes{}, rootIter.Event.ProcessID[:]...),
+			StateRoot: append(types.HexBytes{}, rootIter.Event.NewStateRoot[:]...),
+		}})
+	}
+	if err := rootIter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate process state root updated: %w", err)
+	}
+
+	durationIter, err := c.processes.FilterProcessDurationChanged(opts, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter process duration changed: %w", err)
+	}
+	for durationIter.Next() {
+		duration := time.Duration(durationIter.Event.Duration.Uint64()) * time.Second
+		changes = append(changes, &processChangeLog{raw: durationIter.Event.Raw, change: &types.ProcessChange{
+			ProcessID: append(types.HexBytes{}, durationIter.Event.ProcessID[:]...),
+			Duration:  &duration,
+		}})
+	}
+	if err := durationIter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate process duration changed: %w", err)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].raw.BlockNumber != changes[j].raw.BlockNumber {
+			return changes[i].raw.BlockNumber < changes[j].raw.BlockNumber
+		}
+		return changes[i].raw.Index < changes[j].raw.Index
+	})
+	return changes, nil
+}
+
 // MonitorProcessCreationBySubscription monitors the creation of new processes by subscribing to the ProcessRegistry contract.
 // Requires the web3 rpc endpoint to support subscriptions on websockets.
 func (c *Contracts) MonitorProcessCreationBySubscription(ctx context.Context) (<-chan *types.Process, error) {
@@ -182,6 +383,10 @@ func contractProcess2Process(contractProcess *bindings.ProcessRegistryProcess) *
 		CensusURI:    contractProcess.Census.CensusURI,
 		CensusOrigin: contractProcess.Census.CensusOrigin,
 	}
+	var results []*types.BigInt
+	for _, r := range contractProcess.Result {
+		results = append(results, (*types.BigInt)(r))
+	}
 	return &types.Process{
 		Status:         contractProcess.Status,
 		OrganizationId: contractProcess.OrganizationId,
@@ -190,6 +395,7 @@ func contractProcess2Process(contractProcess *bindings.ProcessRegistryProcess) *
 			Y: contractProcess.EncryptionKey.Y,
 		},
 		StateRoot:   contractProcess.LatestStateRoot[:],
+		Result:      results,
 		StartTime:   time.Unix(int64(contractProcess.StartTime.Uint64()), 0),
 		Duration:    time.Duration(contractProcess.Duration.Uint64()) * time.Second,
 		MetadataURI: contractProcess.MetadataURI,
@@ -208,13 +414,7 @@ func process2ContractProcess(process *types.Process) *bindings.ProcessRegistryPr
 		MaxTotalCost:    process.BallotMode.MaxTotalCost.MathBigInt(),
 		MinTotalCost:    process.BallotMode.MinTotalCost.MathBigInt(),
 	}
-	census := bindings.ProcessRegistryCensus{
-		CensusRoot:   [32]byte{},
-		MaxVotes:     process.Census.MaxVotes.MathBigInt(),
-		CensusURI:    process.Census.CensusURI,
-		CensusOrigin: process.Census.CensusOrigin,
-	}
-	copy(census.CensusRoot[:], process.Census.CensusRoot)
+	census := census2ContractCensus(process.Census)
 	encryptionKey := bindings.ProcessRegistryEncryptionKey{
 		X: process.EncryptionKey.X,
 		Y: process.EncryptionKey.Y,
@@ -233,3 +433,22 @@ func process2ContractProcess(process *types.Process) *bindings.ProcessRegistryPr
 		Census:          census,
 	}
 }
+
+func census2ContractCensus(census *types.Census) bindings.ProcessRegistryCensus {
+	contractCensus := bindings.ProcessRegistryCensus{
+		CensusRoot:   [32]byte{},
+		MaxVotes:     census.MaxVotes.MathBigInt(),
+		CensusURI:    census.CensusURI,
+		CensusOrigin: census.CensusOrigin,
+	}
+	copy(contractCensus.CensusRoot[:], census.CensusRoot)
+	return contractCensus
+}
+
+// processID32 converts a process ID to the fixed size array used by the
+// ProcessRegistry contract.
+func processID32(processID []byte) [32]byte {
+	var pid [32]byte
+	copy(pid[:], processID)
+	return pid
+}
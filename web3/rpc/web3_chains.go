@@ -0,0 +1,175 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// embeddedChainsMetadata is the versioned snapshot of the chains metadata
+// shipped with the binary. It is a subset of the information available in
+// shortNameSourceUri, so the pool can resolve chains without network access.
+//
+//go:embed chains_metadata.json
+var embeddedChainsMetadata []byte
+
+// chainsMetadata struct represents a versioned list of chains metadata, as it
+// is stored in the embedded snapshot and in the override files.
+type chainsMetadata struct {
+	Version string          `json:"version"`
+	Source  string          `json:"source,omitempty"`
+	Chains  []*Web3Endpoint `json:"chains"`
+}
+
+// decodeChainsMetadata decodes the chains metadata provided. It supports both
+// the versioned format of the embedded snapshot and the plain list format of
+// shortNameSourceUri, in which case the version returned is empty.
+func decodeChainsMetadata(data []byte) (*chainsMetadata, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty chains metadata")
+	}
+	md := &chainsMetadata{}
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &md.Chains); err != nil {
+			return nil, fmt.Errorf("error decoding chains metadata list: %w", err)
+		}
+	} else if err := json.Unmarshal(data, md); err != nil {
+		return nil, fmt.Errorf("error decoding chains metadata: %w", err)
+	}
+	for _, chain := range md.Chains {
+		if chain == nil || chain.ChainID == 0 {
+			return nil, fmt.Errorf("invalid chain metadata entry: missing chainId")
+		}
+	}
+	return md, nil
+}
+
+// EmbeddedChainsMetadataVersion returns the version of the chains metadata
+// snapshot embedded in the binary.
+func EmbeddedChainsMetadataVersion() string {
+	md, err := decodeChainsMetadata(embeddedChainsMetadata)
+	if err != nil {
+		return ""
+	}
+	return md.Version
+}
+
+// LoadChainsMetadataFile method merges the chains metadata stored in the file
+// provided into the current metadata of the pool. The entries of the file
+// override the existing ones with the same chainID, and the rest are added.
+// The file can contain a versioned snapshot or a plain list of chains in the
+// format of https://chainid.network/chains_mini.json.
+func (nm *Web3Pool) LoadChainsMetadataFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading chains metadata file '%s': %w", path, err)
+	}
+	md, err := decodeChainsMetadata(data)
+	if err != nil {
+		return fmt.Errorf("error loading chains metadata file '%s': %w", path, err)
+	}
+	if md.Version == "" {
+		md.Version = "file:" + path
+	}
+	nm.mergeMetadata(md)
+	return nil
+}
+
+// RefreshChainsMetadata method downloads the chains metadata from
+// https://chainid.network and merges it into the current metadata of the
+// pool. It is never called automatically, so the pool does not require
+// network access unless it is requested explicitly.
+func (nm *Web3Pool) RefreshChainsMetadata(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, shortNameSourceUri, nil)
+	if err != nil {
+		return fmt.Errorf("error creating chains metadata request: %w", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error getting chains information from external source: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("error getting chains information from external source: status %d", res.StatusCode)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("error reading chains information from external source: %w", err)
+	}
+	md, err := decodeChainsMetadata(data)
+	if err != nil {
+		return fmt.Errorf("error decoding chains information from external source: %w", err)
+	}
+	if md.Version == "" {
+		md.Version = "remote:" + shortNameSourceUri
+	}
+	nm.mergeMetadata(md)
+	return nil
+}
+
+// ChainsMetadataVersion method returns the version of the chains metadata
+// loaded in the pool. If the metadata has been overridden by a file or
+// refreshed from the network, the version describes the last source merged.
+func (nm *Web3Pool) ChainsMetadataVersion() string {
+	nm.metadataMtx.RLock()
+	defer nm.metadataMtx.RUnlock()
+	return nm.metadataVersion
+}
+
+// ChainIDByShortName method returns the chainID of the chain with the short
+// name provided. The comparison is case insensitive. It returns an error if
+// the short name is not found in the metadata of the pool.
+func (nm *Web3Pool) ChainIDByShortName(shortName string) (uint64, error) {
+	nm.metadataMtx.RLock()
+	defer nm.metadataMtx.RUnlock()
+	for _, data := range nm.metadata {
+		if strings.EqualFold(data.ShortName, shortName) {
+			return data.ChainID, nil
+		}
+	}
+	return 0, fmt.Errorf("no chain found with short name '%s'", shortName)
+}
+
+// ShortNameByChainID method returns the short name of the chain with the
+// chainID provided. It returns an error if the chainID is not found in the
+// metadata of the pool.
+func (nm *Web3Pool) ShortNameByChainID(chainID uint64) (string, error) {
+	if data := nm.NetworkInfoByChainID(chainID); data != nil {
+		return data.ShortName, nil
+	}
+	return "", fmt.Errorf("no chain found with chainID %d", chainID)
+}
+
+// mergeMetadata method merges the chains metadata provided into the metadata
+// of the pool, overriding the entries with the same chainID.
+func (nm *Web3Pool) mergeMetadata(md *chainsMetadata) {
+	nm.metadataMtx.Lock()
+	defer nm.metadataMtx.Unlock()
+	index := make(map[uint64]int, len(nm.metadata))
+	for i, data := range nm.metadata {
+		index[data.ChainID] = i
+	}
+	for _, chain := range md.Chains {
+		entry := &Web3Endpoint{
+			ChainID:   chain.ChainID,
+			Name:      chain.Name,
+			ShortName: chain.ShortName,
+		}
+		if i, ok := index[chain.ChainID]; ok {
+			nm.metadata[i] = entry
+			continue
+		}
+		index[chain.ChainID] = len(nm.metadata)
+		nm.metadata = append(nm.metadata, entry)
+	}
+	nm.metadataVersion = md.Version
+}
@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestEmbeddedChainsMetadata(t *testing.T) {
+	c := qt.New(t)
+
+	pool, err := NewAutomaticWeb3Pool()
+	c.Assert(err, qt.IsNil)
+	c.Assert(pool.ChainsMetadataVersion(), qt.Equals, EmbeddedChainsMetadataVersion())
+	c.Assert(pool.ChainsMetadataVersion(), qt.Not(qt.Equals), "")
+
+	chainID, err := pool.ChainIDByShortName("SEP")
+	c.Assert(err, qt.IsNil)
+	c.Assert(chainID, qt.Equals, uint64(11155111))
+
+	shortName, err := pool.ShortNameByChainID(1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(shortName, qt.Equals, "eth")
+
+	_, err = pool.ChainIDByShortName("unknown-chain")
+	c.Assert(err, qt.IsNotNil)
+	c.Assert(pool.NetworkInfoByChainID(999999999), qt.IsNil)
+}
+
+func TestChainsMetadataFileOverride(t *testing.T) {
+	c := qt.New(t)
+
+	pool, err := NewAutomaticWeb3Pool()
+	c.Assert(err, qt.IsNil)
+
+	// plain list format, as served by chainid.network
+	path := filepath.Join(t.TempDir(), "chains.json")
+	c.Assert(os.WriteFile(path, []byte(`[
+		{"name": "Ethereum", "chainId": 1, "shortName": "mainnet"},
+		{"name": "Local devnet", "chainId": 424242, "shortName": "devnet"}
+	]`), 0o600), qt.IsNil)
+	c.Assert(pool.LoadChainsMetadataFile(path), qt.IsNil)
+
+	shortName, err := pool.ShortNameByChainID(1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(shortName, qt.Equals, "mainnet")
+	chainID, err := pool.ChainIDByShortName("devnet")
+	c.Assert(err, qt.IsNil)
+	c.Assert(chainID, qt.Equals, uint64(424242))
+	// entries not present in the file are kept
+	chainID, err = pool.ChainIDByShortName("sep")
+	c.Assert(err, qt.IsNil)
+	c.Assert(chainID, qt.Equals, uint64(11155111))
+
+	// invalid files are rejected without modifying the metadata
+	c.Assert(os.WriteFile(path, []byte(`[{"name": "broken"}]`), 0o600), qt.IsNil)
+	c.Assert(pool.LoadChainsMetadataFile(path), qt.IsNotNil)
+	c.Assert(pool.ChainsMetadataVersion(), qt.Equals, "file:"+path)
+}
@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/vocdoni/vocdoni-z-sandbox/metrics"
 )
 
 const defaultRetries = 3
@@ -49,7 +51,7 @@ func (c *Client) CodeAt(ctx context.Context, account common.Address, blockNumber
 		return nil, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "CodeAt", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.CodeAt(internalCtx, account, blockNumber)
@@ -70,7 +72,7 @@ func (c *Client) CallContract(ctx context.Context, call ethereum.CallMsg, blockN
 		return nil, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "CallContract", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.CallContract(internalCtx, call, blockNumber)
@@ -91,7 +93,7 @@ func (c *Client) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64,
 		return 0, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "EstimateGas", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.EstimateGas(internalCtx, msg)
@@ -112,7 +114,7 @@ func (c *Client) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]
 		return nil, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "FilterLogs", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, filterLogsTimeout)
 		defer cancel()
 		return endpoint.client.FilterLogs(internalCtx, query)
@@ -133,7 +135,7 @@ func (c *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.He
 		return nil, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "HeaderByNumber", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.HeaderByNumber(internalCtx, number)
@@ -154,7 +156,7 @@ func (c *Client) PendingNonceAt(ctx context.Context, account common.Address) (ui
 		return 0, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "PendingNonceAt", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.PendingNonceAt(internalCtx, account)
@@ -175,7 +177,7 @@ func (c *Client) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
 		return nil, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "SuggestGasPrice", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.SuggestGasPrice(internalCtx)
@@ -196,7 +198,7 @@ func (c *Client) SendTransaction(ctx context.Context, tx *types.Transaction) err
 		return fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	_, err = c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	_, err = c.retryAndCheckErr(endpoint.URI, "SendTransaction", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return nil, endpoint.client.SendTransaction(internalCtx, tx)
@@ -204,6 +206,35 @@ func (c *Client) SendTransaction(ctx context.Context, tx *types.Transaction) err
 	return err
 }
 
+// TransactionReceipt method wraps the TransactionReceipt method from the
+// ethclient.Client for the chainID of the Client instance. It returns an error
+// if the chainID is not found in the pool or if the method fails. A receipt
+// not found is not considered a failure of the endpoint, since it is the
+// expected result for pending transactions, so it is returned without retries.
+// Required by the bind.DeployBackend interface.
+func (c *Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	endpoint, err := c.w3p.Endpoint(c.chainID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
+	}
+	internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	receipt, err := endpoint.client.TransactionReceipt(internalCtx, txHash)
+	cancel()
+	if err == nil || errors.Is(err, ethereum.NotFound) {
+		return receipt, err
+	}
+	// retry the method in case of failure and get final result and error
+	res, err := c.retryAndCheckErr(endpoint.URI, "TransactionReceipt", func() (any, error) {
+		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+		return endpoint.client.TransactionReceipt(internalCtx, txHash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*types.Receipt), err
+}
+
 // PendingCodeAt method wraps the PendingCodeAt method from the ethclient.Client
 // for the chainID of the Client instance. It returns an error if the chainID is
 // not found in the pool or if the method fails. Required by the
@@ -214,7 +245,7 @@ func (c *Client) PendingCodeAt(ctx context.Context, account common.Address) ([]b
 		return nil, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "PendingCodeAt", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.PendingCodeAt(internalCtx, account)
@@ -237,7 +268,7 @@ func (c *Client) SubscribeFilterLogs(ctx context.Context,
 		return nil, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "SubscribeFilterLogs", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.SubscribeFilterLogs(internalCtx, query, ch)
@@ -258,7 +289,7 @@ func (c *Client) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
 		return nil, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "SuggestGasTipCap", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.SuggestGasTipCap(internalCtx)
@@ -279,7 +310,7 @@ func (c *Client) BalanceAt(ctx context.Context, account common.Address, blockNum
 		return nil, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "BalanceAt", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.BalanceAt(internalCtx, account, blockNumber)
@@ -300,7 +331,7 @@ func (c *Client) BlockNumber(ctx context.Context) (uint64, error) {
 		return 0, fmt.Errorf("error getting endpoint for chainID %d: %w", c.chainID, err)
 	}
 	// retry the method in case of failure and get final result and error
-	res, err := c.retryAndCheckErr(endpoint.URI, func() (any, error) {
+	res, err := c.retryAndCheckErr(endpoint.URI, "BlockNumber", func() (any, error) {
 		internalCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 		return endpoint.client.BlockNumber(internalCtx)
@@ -316,11 +347,15 @@ func (c *Client) BlockNumber(ctx context.Context) (uint64, error) {
 // the error if the retries are exhausted. It is used to retry the methods of
 // the ethclient.Client in case of failure. If the error is not nil after the
 // retries, the endpoint is disabled in the pool and the error is returned.
-func (c *Client) retryAndCheckErr(uri string, fn func() (any, error)) (any, error) {
+// The duration and result of each attempt are recorded in the RPC metrics of
+// the method provided.
+func (c *Client) retryAndCheckErr(uri, method string, fn func() (any, error)) (any, error) {
 	var res any
 	var err error
 	for i := 0; i < defaultRetries; i++ {
+		start := time.Now()
 		res, err = fn()
+		metrics.ObserveRPC(c.chainID, uri, method, start, err)
 		if err == nil {
 			return res, nil
 		}
@@ -12,6 +12,8 @@ import (
 // and the URI.
 type Web3Endpoint struct {
 	ChainID   uint64 `json:"chainId"`
+	Name      string `json:"name"`
+	ShortName string `json:"shortName"`
 	URI       string
 	IsArchive bool
 	client    *ethclient.Client
@@ -15,12 +15,11 @@ package rpc
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"math/big"
-	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -32,6 +31,7 @@ const (
 	// a web3 provider.
 	DefaultMaxWeb3ClientRetries = 5
 	// shortNameSourceUri is the URI to get the chain metadata from an external
+	// source. It is only used when a refresh is requested explicitly.
 	shortNameSourceUri = "https://chainid.network/chains_mini.json"
 	// checkWeb3EndpointsTimeout is the timeout to check the web3 endpoints.
 	checkWeb3EndpointsTimeout = time.Second * 10
@@ -51,27 +51,26 @@ var notFoundTxRgx = regexp.MustCompile(`not\s[be\s|]*found`)
 // It allows to support multiple endpoints for the same chainID and switch
 // between them looking for the available one.
 type Web3Pool struct {
-	endpoints map[uint64]*Web3Iterator
-	metadata  []*Web3Endpoint
+	endpoints       map[uint64]*Web3Iterator
+	metadata        []*Web3Endpoint
+	metadataVersion string
+	metadataMtx     sync.RWMutex
 }
 
-// NewWeb3Pool method returns a new *Web3Pool instance, initialized
-// with the endpoints list available in https://chainid.network.
-// It returns an error if the metadata cannot be retrieved or decoded.
+// NewAutomaticWeb3Pool method returns a new *Web3Pool instance, initialized
+// with the chains metadata snapshot embedded in the binary. It does not
+// require network access, use RefreshChainsMetadata to update the metadata
+// from https://chainid.network or LoadChainsMetadataFile to override it with
+// a local file. It returns an error if the embedded metadata cannot be
+// decoded.
 func NewAutomaticWeb3Pool() (*Web3Pool, error) {
-	// get chains information from external source
-	res, err := http.Get(shortNameSourceUri)
+	md, err := decodeChainsMetadata(embeddedChainsMetadata)
 	if err != nil {
-		return nil, fmt.Errorf("error getting chains information from external source: %v", err)
+		return nil, fmt.Errorf("error decoding embedded chains information: %w", err)
 	}
-	chainsData := []*Web3Endpoint{}
-	if err := json.NewDecoder(res.Body).Decode(&chainsData); err != nil {
-		return nil, fmt.Errorf("error decoding chains information from external source: %v", err)
-	}
-	return &Web3Pool{
-		endpoints: make(map[uint64]*Web3Iterator),
-		metadata:  chainsData,
-	}, nil
+	nm := NewWeb3Pool()
+	nm.mergeMetadata(md)
+	return nm, nil
 }
 
 // NewWeb3Pool method returns a new *Web3Pool instance.
@@ -191,24 +190,25 @@ func (nm *Web3Pool) CurrentBlockNumbers(ctx context.Context) (map[uint64]uint64,
 func (nm *Web3Pool) SupportedNetworks() []*Web3Endpoint {
 	var supported []*Web3Endpoint
 	for chainID := range nm.endpoints {
-		for _, data := range nm.metadata {
-			if data.ChainID == chainID {
-				supported = append(supported, &Web3Endpoint{
-					ChainID: chainID,
-				})
-				break
-			}
+		if data := nm.NetworkInfoByChainID(chainID); data != nil {
+			supported = append(supported, data)
 		}
 	}
 	return supported
 }
 
-// NetworkInfoByChainID method returns the Web3Endpoint metadata for the
-// chainID provided. It returns nil if the chainID is not found.
+// NetworkInfoByChainID method returns a copy of the Web3Endpoint metadata for
+// the chainID provided. It returns nil if the chainID is not found.
 func (nm *Web3Pool) NetworkInfoByChainID(chainID uint64) *Web3Endpoint {
+	nm.metadataMtx.RLock()
+	defer nm.metadataMtx.RUnlock()
 	for _, data := range nm.metadata {
 		if data.ChainID == chainID {
-			return data
+			return &Web3Endpoint{
+				ChainID:   data.ChainID,
+				Name:      data.Name,
+				ShortName: data.ShortName,
+			}
 		}
 	}
 	return nil
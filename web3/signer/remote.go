@@ -0,0 +1,71 @@
+package signer
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+// RemoteSigner is a Signer that delegates the signatures to an external
+// signer reached over JSON-RPC. The external signer must implement the clef
+// account API (account_version, account_list, account_signTransaction and
+// account_signData), so the private key never leaves it.
+type RemoteSigner struct {
+	ext     *external.ExternalSigner
+	account accounts.Account
+}
+
+// NewRemoteSigner connects to the external signer at the endpoint provided
+// and returns a RemoteSigner for the address provided. If the address is
+// empty, the first account listed by the external signer is used. It returns
+// an error if the signer is not reachable or does not manage the account.
+func NewRemoteSigner(endpoint string, address common.Address) (*RemoteSigner, error) {
+	ext, err := external.NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to external signer: %w", err)
+	}
+	accs := ext.Accounts()
+	if len(accs) == 0 {
+		return nil, fmt.Errorf("external signer has no accounts available")
+	}
+	account := accs[0]
+	if address != (common.Address{}) {
+		account = accounts.Account{Address: address}
+		if !ext.Contains(account) {
+			return nil, fmt.Errorf("external signer does not manage account %s", address.Hex())
+		}
+	}
+	return &RemoteSigner{
+		ext:     ext,
+		account: account,
+	}, nil
+}
+
+// Address returns the address of the account.
+func (s *RemoteSigner) Address() common.Address {
+	return s.account.Address
+}
+
+// SignTx sends the transaction provided to the external signer and returns
+// the signed transaction.
+func (s *RemoteSigner) SignTx(tx *gethtypes.Transaction, chainID *big.Int) (*gethtypes.Transaction, error) {
+	signed, err := s.ext.SignTx(s.account, tx, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("external signer failed to sign transaction: %w", err)
+	}
+	return signed, nil
+}
+
+// SignMessage sends the message provided to the external signer and returns
+// the signature.
+func (s *RemoteSigner) SignMessage(msg []byte) ([]byte, error) {
+	signature, err := s.ext.SignText(s.account, msg)
+	if err != nil {
+		return nil, fmt.Errorf("external signer failed to sign message: %w", err)
+	}
+	return signature, nil
+}
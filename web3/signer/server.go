@@ -0,0 +1,140 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/vocdoni/vocdoni-z-sandbox/log"
+)
+
+// serverVersion is the version reported by the stand-in signer server.
+const serverVersion = "6.0.0"
+
+// Server is a stand-in external signer that implements the subset of the clef
+// account API used by RemoteSigner. It signs everything it is asked to sign
+// without any confirmation, so it must only be used for testing and local
+// development.
+type Server struct {
+	signers  map[common.Address]*LocalSigner
+	listener net.Listener
+	httpSrv  *http.Server
+	rpcSrv   *rpc.Server
+}
+
+// NewServer starts a new stand-in signer server listening on the address
+// provided (for example 127.0.0.1:0) that manages the accounts of the signers
+// provided.
+func NewServer(addr string, signers ...*LocalSigner) (*Server, error) {
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no signers provided")
+	}
+	s := &Server{
+		signers: make(map[common.Address]*LocalSigner),
+		rpcSrv:  rpc.NewServer(),
+	}
+	for _, signer := range signers {
+		s.signers[signer.Address()] = signer
+	}
+	if err := s.rpcSrv.RegisterName("account", &serverAPI{srv: s, order: signers}); err != nil {
+		return nil, fmt.Errorf("failed to register signer API: %w", err)
+	}
+	var err error
+	if s.listener, err = net.Listen("tcp", addr); err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	s.httpSrv = &http.Server{Handler: s.rpcSrv}
+	go func() {
+		if err := s.httpSrv.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Warnw("stand-in signer server stopped", "error", err)
+		}
+	}()
+	return s, nil
+}
+
+// URL returns the HTTP endpoint of the server.
+func (s *Server) URL() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	s.rpcSrv.Stop()
+	return s.httpSrv.Shutdown(context.Background())
+}
+
+// serverAPI implements the methods of the account namespace of the server.
+type serverAPI struct {
+	srv   *Server
+	order []*LocalSigner
+}
+
+// signTransactionResult is the result of the account_signTransaction method.
+type signTransactionResult struct {
+	Raw hexutil.Bytes          `json:"raw"`
+	Tx  *gethtypes.Transaction `json:"tx"`
+}
+
+// Version implements account_version.
+func (api *serverAPI) Version(_ context.Context) (string, error) {
+	return serverVersion, nil
+}
+
+// List implements account_list.
+func (api *serverAPI) List(_ context.Context) ([]common.Address, error) {
+	addresses := make([]common.Address, 0, len(api.order))
+	for _, signer := range api.order {
+		addresses = append(addresses, signer.Address())
+	}
+	return addresses, nil
+}
+
+// SignTransaction implements account_signTransaction.
+func (api *serverAPI) SignTransaction(_ context.Context, args apitypes.SendTxArgs) (*signTransactionResult, error) {
+	signer, ok := api.srv.signers[args.From.Address()]
+	if !ok {
+		return nil, fmt.Errorf("unknown account %s", args.From.Address().Hex())
+	}
+	if args.ChainID == nil {
+		return nil, fmt.Errorf("missing chainId")
+	}
+	tx, err := args.ToTransaction()
+	if err != nil {
+		return nil, err
+	}
+	signed, err := signer.SignTx(tx, args.ChainID.ToInt())
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &signTransactionResult{Raw: raw, Tx: signed}, nil
+}
+
+// SignData implements account_signData for text/plain content. As clef does,
+// the V value of the signature returned is 27 or 28.
+func (api *serverAPI) SignData(_ context.Context, contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	if contentType != accounts.MimetypeTextPlain {
+		return nil, fmt.Errorf("unsupported content type %s", contentType)
+	}
+	signer, ok := api.srv.signers[addr.Address()]
+	if !ok {
+		return nil, fmt.Errorf("unknown account %s", addr.Address().Hex())
+	}
+	signature, err := signer.SignMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	signature[64] += 27
+	return signature, nil
+}
@@ -0,0 +1,93 @@
+// Package signer provides the accounts used by the sequencer to sign the
+// transactions sent to the contracts and the messages sent to the API. The
+// keys can be provided as a raw hex private key, as an encrypted JSON keystore
+// file or kept in an external signer reachable over JSON-RPC (such as clef).
+package signer
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/vocdoni/vocdoni-z-sandbox/crypto/ethereum"
+)
+
+// Signer is the interface of the accounts that sign the transactions and
+// messages of the sequencer.
+type Signer interface {
+	// Address returns the address of the account.
+	Address() common.Address
+	// SignTx signs the transaction provided for the chainID provided and
+	// returns the signed transaction.
+	SignTx(tx *gethtypes.Transaction, chainID *big.Int) (*gethtypes.Transaction, error)
+	// SignMessage signs the message provided using the Ethereum signed
+	// message prefix. The V value of the signature is 0 or 1.
+	SignMessage(msg []byte) ([]byte, error)
+}
+
+// LocalSigner is a Signer that keeps the private key in memory.
+type LocalSigner struct {
+	keys *ethereum.SignKeys
+}
+
+// NewLocalSigner creates a new LocalSigner with the hex private key provided.
+func NewLocalSigner(hexPrivKey string) (*LocalSigner, error) {
+	keys := ethereum.NewSignKeys()
+	if err := keys.AddHexKey(hexPrivKey); err != nil {
+		return nil, fmt.Errorf("failed to add private key: %w", err)
+	}
+	return &LocalSigner{keys: keys}, nil
+}
+
+// NewLocalSignerFromKey creates a new LocalSigner with the ECDSA private key
+// provided.
+func NewLocalSignerFromKey(privKey *ecdsa.PrivateKey) *LocalSigner {
+	keys := ethereum.NewSignKeys()
+	keys.Private = *privKey
+	keys.Public = privKey.PublicKey
+	return &LocalSigner{keys: keys}
+}
+
+// NewKeystoreSigner creates a new LocalSigner decrypting the JSON keystore
+// file provided with the passphrase provided.
+func NewKeystoreSigner(path, passphrase string) (*LocalSigner, error) {
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore file: %w", err)
+	}
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore file: %w", err)
+	}
+	return NewLocalSignerFromKey(key.PrivateKey), nil
+}
+
+// ReadPassphraseFile reads the passphrase stored in the file provided,
+// removing the trailing new line characters.
+func ReadPassphraseFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Address returns the address of the account.
+func (s *LocalSigner) Address() common.Address {
+	return s.keys.Address()
+}
+
+// SignTx signs the transaction provided with the private key of the account.
+func (s *LocalSigner) SignTx(tx *gethtypes.Transaction, chainID *big.Int) (*gethtypes.Transaction, error) {
+	return gethtypes.SignTx(tx, gethtypes.LatestSignerForChainID(chainID), &s.keys.Private)
+}
+
+// SignMessage signs the message provided with the private key of the account.
+func (s *LocalSigner) SignMessage(msg []byte) ([]byte, error) {
+	return s.keys.SignEthereum(msg)
+}
@@ -0,0 +1,97 @@
+package signer
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	qt "github.com/frankban/quicktest"
+	"github.com/google/uuid"
+	"github.com/vocdoni/vocdoni-z-sandbox/crypto/ethereum"
+)
+
+func testSignerRoundTrip(c *qt.C, s Signer) {
+	msg := []byte("1337123")
+	signature, err := s.SignMessage(msg)
+	c.Assert(err, qt.IsNil)
+	addr, err := ethereum.AddrFromSignature(msg, signature)
+	c.Assert(err, qt.IsNil)
+	c.Assert(addr, qt.Equals, s.Address())
+
+	chainID := big.NewInt(1337)
+	to := common.HexToAddress("0x1234567890123456789012345678901234567890")
+	tx := gethtypes.NewTx(&gethtypes.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     3,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(10),
+		Gas:       21000,
+		To:        &to,
+		Value:     big.NewInt(1),
+	})
+	signed, err := s.SignTx(tx, chainID)
+	c.Assert(err, qt.IsNil)
+	sender, err := gethtypes.Sender(gethtypes.LatestSignerForChainID(chainID), signed)
+	c.Assert(err, qt.IsNil)
+	c.Assert(sender, qt.Equals, s.Address())
+	c.Assert(signed.Nonce(), qt.Equals, uint64(3))
+}
+
+func TestKeystoreSigner(t *testing.T) {
+	c := qt.New(t)
+
+	privKey, err := ethcrypto.GenerateKey()
+	c.Assert(err, qt.IsNil)
+	key := &keystore.Key{
+		Id:         uuid.New(),
+		Address:    ethcrypto.PubkeyToAddress(privKey.PublicKey),
+		PrivateKey: privKey,
+	}
+	keyJSON, err := keystore.EncryptKey(key, "secret", keystore.LightScryptN, keystore.LightScryptP)
+	c.Assert(err, qt.IsNil)
+	keyPath := filepath.Join(t.TempDir(), "key.json")
+	c.Assert(os.WriteFile(keyPath, keyJSON, 0o600), qt.IsNil)
+	passPath := filepath.Join(t.TempDir(), "pass")
+	c.Assert(os.WriteFile(passPath, []byte("secret\n"), 0o600), qt.IsNil)
+
+	_, err = NewKeystoreSigner(keyPath, "wrong")
+	c.Assert(err, qt.IsNotNil)
+
+	passphrase, err := ReadPassphraseFile(passPath)
+	c.Assert(err, qt.IsNil)
+	s, err := NewKeystoreSigner(keyPath, passphrase)
+	c.Assert(err, qt.IsNil)
+	c.Assert(s.Address(), qt.Equals, key.Address)
+	testSignerRoundTrip(c, s)
+}
+
+func TestRemoteSigner(t *testing.T) {
+	c := qt.New(t)
+
+	keys := ethereum.NewSignKeysBatch(2)
+	signers := []*LocalSigner{
+		NewLocalSignerFromKey(&keys[0].Private),
+		NewLocalSignerFromKey(&keys[1].Private),
+	}
+	srv, err := NewServer("127.0.0.1:0", signers...)
+	c.Assert(err, qt.IsNil)
+	t.Cleanup(func() { _ = srv.Close() })
+
+	// default account is the first one listed
+	s, err := NewRemoteSigner(srv.URL(), common.Address{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(s.Address(), qt.Equals, signers[0].Address())
+	testSignerRoundTrip(c, s)
+
+	s, err = NewRemoteSigner(srv.URL(), signers[1].Address())
+	c.Assert(err, qt.IsNil)
+	testSignerRoundTrip(c, s)
+
+	_, err = NewRemoteSigner(srv.URL(), common.HexToAddress("0x01"))
+	c.Assert(err, qt.IsNotNil)
+}
@@ -0,0 +1,139 @@
+// Package simulated provides a test harness built on the go-ethereum simulated
+// backend. It runs an in-process chain with funded accounts and the
+// OrganizationRegistry and ProcessRegistry contracts deployed, so the code
+// that interacts with the contracts can be tested without any external node.
+package simulated
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/vocdoni/vocdoni-z-sandbox/web3"
+	"github.com/vocdoni/vocdoni-z-sandbox/web3/signer"
+)
+
+const (
+	// ChainID is the chainID of the simulated chain.
+	ChainID = 1337
+	// DefaultAccounts is the number of funded accounts created by default.
+	DefaultAccounts = 4
+	// blockGasLimit is the gas limit of the blocks of the simulated chain,
+	// big enough to deploy the contracts.
+	blockGasLimit = 30_000_000
+)
+
+// accountBalance is the initial balance of the funded accounts (1000 ETH).
+var accountBalance = new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))
+
+// Harness is an in-process chain with the contracts deployed. By default
+// every transaction sent is mined immediately in its own block, which can be
+// disabled with SetAutoMine to mine the blocks on demand with Commit.
+type Harness struct {
+	// Backend is the go-ethereum simulated backend of the chain.
+	Backend *simulated.Backend
+	// Contracts are the bindings to the contracts deployed, using the first
+	// account as signer.
+	Contracts *web3.Contracts
+	// Accounts are the funded accounts of the chain.
+	Accounts []*signer.LocalSigner
+
+	client   *client
+	autoMine atomic.Bool
+}
+
+// New creates a new simulated chain with the number of funded accounts
+// provided (DefaultAccounts if it is zero) and deploys the contracts with the
+// first account. The harness must be closed with Close.
+func New(accounts int) (*Harness, error) {
+	if accounts <= 0 {
+		accounts = DefaultAccounts
+	}
+	h := &Harness{}
+	alloc := types.GenesisAlloc{}
+	for i := 0; i < accounts; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate account key: %w", err)
+		}
+		account := signer.NewLocalSignerFromKey(key)
+		h.Accounts = append(h.Accounts, account)
+		alloc[account.Address()] = types.Account{Balance: accountBalance}
+	}
+	h.Backend = simulated.NewBackend(alloc, simulated.WithBlockGasLimit(blockGasLimit))
+	h.client = &client{Client: h.Backend.Client(), harness: h}
+	h.autoMine.Store(true)
+
+	contracts, err := web3.DeployContractsWithBackend(h.client, ChainID, h.Accounts[0])
+	if err != nil {
+		_ = h.Backend.Close()
+		return nil, fmt.Errorf("failed to deploy contracts: %w", err)
+	}
+	h.Contracts = contracts
+	return h, nil
+}
+
+// Client returns the backend to bind new Contracts instances to the chain,
+// for example with web3.NewContracts. The transactions sent through it are
+// mined according to the auto mine setting of the harness.
+func (h *Harness) Client() web3.Backend {
+	return h.client
+}
+
+// NewContracts returns new bindings to the contracts deployed that use the
+// account provided as signer.
+func (h *Harness) NewContracts(account signer.Signer) (*web3.Contracts, error) {
+	contracts, err := web3.NewContracts(h.client, ChainID, h.Contracts.ContractsAddresses)
+	if err != nil {
+		return nil, err
+	}
+	contracts.SetSigner(account)
+	return contracts, nil
+}
+
+// SetAutoMine enables or disables mining a new block after each transaction
+// sent.
+func (h *Harness) SetAutoMine(enabled bool) {
+	h.autoMine.Store(enabled)
+}
+
+// Commit mines a new block with the pending transactions and returns its hash.
+func (h *Harness) Commit() common.Hash {
+	return h.Backend.Commit()
+}
+
+// AdjustTime moves the time of the chain forward by the duration provided and
+// mines a new block. There must be no pending transactions.
+func (h *Harness) AdjustTime(d time.Duration) error {
+	return h.Backend.AdjustTime(d)
+}
+
+// Close stops the simulated chain.
+func (h *Harness) Close() error {
+	return h.Backend.Close()
+}
+
+// client wraps the client of the simulated backend to mine the transactions
+// sent when auto mine is enabled.
+type client struct {
+	simulated.Client
+	harness *Harness
+}
+
+// SendTransaction sends the transaction to the simulated chain and mines a new
+// block if auto mine is enabled.
+func (c *client) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := c.Client.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	if c.harness.autoMine.Load() {
+		c.harness.Backend.Commit()
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package simulated
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	qt "github.com/frankban/quicktest"
+	"github.com/vocdoni/vocdoni-z-sandbox/types"
+	"github.com/vocdoni/vocdoni-z-sandbox/web3"
+)
+
+func TestHarness(t *testing.T) {
+	c := qt.New(t)
+
+	h, err := New(2)
+	c.Assert(err, qt.IsNil)
+	t.Cleanup(func() { _ = h.Close() })
+	c.Assert(h.Accounts, qt.HasLen, 2)
+	c.Assert(h.Contracts.ChainID, qt.Equals, uint64(ChainID))
+	c.Assert(h.Contracts.AccountAddress(), qt.Equals, h.Accounts[0].Address())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	newOrgs, err := h.Contracts.MonitorOrganizationCreatedByPolling(ctx, 100*time.Millisecond)
+	c.Assert(err, qt.IsNil)
+	newProcesses, err := h.Contracts.MonitorProcessCreation(ctx, 100*time.Millisecond)
+	c.Assert(err, qt.IsNil)
+
+	// create an organization, mined on send
+	orgAddr := h.Contracts.AccountAddress()
+	txHash, err := h.Contracts.CreateOrganization(orgAddr, &types.OrganizationInfo{
+		Name:        "simulated organization",
+		MetadataURI: "https://vocdoni.io",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(h.Contracts.WaitTx(txHash, 5*time.Second), qt.IsNil)
+	select {
+	case org := <-newOrgs:
+		c.Assert(org.ID, qt.Equals, orgAddr)
+		c.Assert(org.Name, qt.Equals, "simulated organization")
+	case <-ctx.Done():
+		c.Fatal("timeout waiting for organization")
+	}
+
+	// create a process mining the block on demand
+	h.SetAutoMine(false)
+	pid, hash, err := h.Contracts.CreateProcess(&types.Process{
+		OrganizationId: orgAddr,
+		EncryptionKey:  &types.EncryptionKey{X: big.NewInt(1), Y: big.NewInt(2)},
+		StateRoot:      make([]byte, 32),
+		StartTime:      time.Now().Add(time.Minute),
+		Duration:       time.Hour,
+		MetadataURI:    "https://example.com/metadata",
+		BallotMode: &types.BallotMode{
+			MaxCount:     2,
+			MaxValue:     new(types.BigInt).SetUint64(100),
+			MinValue:     new(types.BigInt).SetUint64(0),
+			MaxTotalCost: new(types.BigInt).SetUint64(0),
+			MinTotalCost: new(types.BigInt).SetUint64(0),
+		},
+		Census: &types.Census{
+			CensusRoot: make([]byte, 32),
+			MaxVotes:   new(types.BigInt).SetUint64(100),
+			CensusURI:  "https://example.com/census",
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	mined, _ := h.Contracts.CheckTxStatus(*hash)
+	c.Assert(mined, qt.IsFalse)
+	h.Commit()
+	c.Assert(h.Contracts.WaitTx(*hash, 5*time.Second), qt.IsNil)
+	h.SetAutoMine(true)
+
+	select {
+	case process := <-newProcesses:
+		c.Assert([]byte(process.ID), qt.DeepEquals, pid.Marshal())
+		c.Assert(process.MetadataURI, qt.Equals, "https://example.com/metadata")
+	case <-ctx.Done():
+		c.Fatal("timeout waiting for process")
+	}
+
+	// other accounts are not administrators of the organization
+	other, err := h.NewContracts(h.Accounts[1])
+	c.Assert(err, qt.IsNil)
+	isAdmin, err := other.IsOrganizationAdministrator(orgAddr, h.Accounts[1].Address())
+	c.Assert(err, qt.IsNil)
+	c.Assert(isAdmin, qt.IsFalse)
+
+	// end the process
+	hash, err = h.Contracts.EndProcess(pid.Marshal())
+	c.Assert(err, qt.IsNil)
+	c.Assert(h.Contracts.WaitTx(*hash, 5*time.Second), qt.IsNil)
+	process, err := h.Contracts.Process(pid.Marshal())
+	c.Assert(err, qt.IsNil)
+	c.Assert(process.Status, qt.Equals, types.ProcessStatusEnded)
+}
+
+func TestTokenBalances(t *testing.T) {
+	c := qt.New(t)
+
+	h, err := New(3)
+	c.Assert(err, qt.IsNil)
+	t.Cleanup(func() { _ = h.Close() })
+	owner, alice, bob := h.Accounts[0], h.Accounts[1], h.Accounts[2]
+
+	token, err := h.DeployToken(owner, big.NewInt(1000))
+	c.Assert(err, qt.IsNil)
+	deployBlock, err := h.Client().HeaderByNumber(context.Background(), nil)
+	c.Assert(err, qt.IsNil)
+	_, err = token.Transfer(owner, alice.Address(), big.NewInt(300))
+	c.Assert(err, qt.IsNil)
+	snapshotBlock, err := token.Transfer(alice, bob.Address(), big.NewInt(100))
+	c.Assert(err, qt.IsNil)
+	// transfers after the snapshot block are not counted
+	_, err = token.Transfer(owner, bob.Address(), big.NewInt(50))
+	c.Assert(err, qt.IsNil)
+	// transfers exceeding the balance revert
+	_, err = token.Transfer(bob, alice.Address(), big.NewInt(1000))
+	c.Assert(err, qt.ErrorMatches, ".*reverted")
+
+	balances, err := web3.TokenBalances(context.Background(), h.Client(), token.Address,
+		deployBlock.Number.Uint64(), snapshotBlock)
+	c.Assert(err, qt.IsNil)
+	c.Assert(balances, qt.HasLen, 3)
+	for account, expected := range map[common.Address]int64{
+		owner.Address(): 700,
+		alice.Address(): 200,
+		bob.Address():   100,
+	} {
+		c.Assert(balances[account].Int64(), qt.Equals, expected)
+		balance, err := token.BalanceOf(account, new(big.Int).SetUint64(snapshotBlock))
+		c.Assert(err, qt.IsNil)
+		c.Assert(balance.Int64(), qt.Equals, expected)
+	}
+
+	// the latest balances include every transfer
+	latest, err := h.Client().HeaderByNumber(context.Background(), nil)
+	c.Assert(err, qt.IsNil)
+	balances, err = h.Contracts.TokenBalances(context.Background(), ChainID, token.Address, 0, latest.Number.Uint64())
+	c.Assert(err, qt.IsNil)
+	c.Assert(balances[bob.Address()].Int64(), qt.Equals, int64(150))
+
+	// the balances of another chain are not computed from this one
+	_, err = h.Contracts.TokenBalances(context.Background(), ChainID+1, token.Address, 0, latest.Number.Uint64())
+	c.Assert(err, qt.ErrorIs, web3.ErrUnknownChain)
+}
@@ -0,0 +1,210 @@
+package simulated
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/vocdoni/vocdoni-z-sandbox/web3"
+	"github.com/vocdoni/vocdoni-z-sandbox/web3/signer"
+)
+
+// tokenTxTimeout is the time to wait for the token transactions to be mined.
+const tokenTxTimeout = 10 * time.Second
+
+// tokenABI is the ABI of the subset of the ERC-20 interface implemented by the
+// test token.
+const tokenABI = `[
+	{"type":"function","name":"balanceOf","stateMutability":"view",
+	 "inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"transfer","stateMutability":"nonpayable",
+	 "inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"event","name":"Transfer","anonymous":false,
+	 "inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}
+]`
+
+// Token is a minimal ERC-20 token deployed on the simulated chain. It only
+// implements balanceOf and transfer, and emits the standard Transfer event on
+// the transfers and on the initial mint, which is enough to build token
+// holder censuses from its logs.
+type Token struct {
+	Address  common.Address
+	contract *bind.BoundContract
+	harness  *Harness
+}
+
+// DeployToken deploys a new token that mints the supply provided to the
+// owner provided. Auto mine must be enabled.
+func (h *Harness) DeployToken(owner signer.Signer, supply *big.Int) (*Token, error) {
+	parsed, err := abi.JSON(strings.NewReader(tokenABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token ABI: %w", err)
+	}
+	// the constructor reads the supply from the end of the code
+	code := append(tokenBytecode(), common.LeftPadBytes(supply.Bytes(), 32)...)
+	address, tx, contract, err := bind.DeployContract(h.transactOpts(owner), parsed, code, h.client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deploy token: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tokenTxTimeout)
+	defer cancel()
+	if _, err := bind.WaitDeployed(ctx, h.client, tx); err != nil {
+		return nil, fmt.Errorf("failed to wait for token deployment: %w", err)
+	}
+	return &Token{Address: address, contract: contract, harness: h}, nil
+}
+
+// Transfer transfers the value provided from the account provided to the
+// address provided and waits for the transaction to be mined. It returns the
+// number of the block where it was mined. Auto mine must be enabled.
+func (t *Token) Transfer(from signer.Signer, to common.Address, value *big.Int) (uint64, error) {
+	tx, err := t.contract.Transact(t.harness.transactOpts(from), "transfer", to, value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to transfer tokens: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tokenTxTimeout)
+	defer cancel()
+	receipt, err := bind.WaitMined(ctx, t.harness.client, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to wait for token transfer: %w", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return 0, fmt.Errorf("token transfer %s reverted", tx.Hash().Hex())
+	}
+	return receipt.BlockNumber.Uint64(), nil
+}
+
+// BalanceOf returns the balance of the holder provided at the block provided,
+// or at the latest block if it is nil.
+func (t *Token) BalanceOf(holder common.Address, block *big.Int) (*big.Int, error) {
+	out := []any{}
+	if err := t.contract.Call(&bind.CallOpts{BlockNumber: block}, &out, "balanceOf", holder); err != nil {
+		return nil, fmt.Errorf("failed to get token balance: %w", err)
+	}
+	return abi.ConvertType(out[0], new(big.Int)).(*big.Int), nil
+}
+
+// transactOpts returns the transact options to send transactions signed by
+// the account provided.
+func (h *Harness) transactOpts(s signer.Signer) *bind.TransactOpts {
+	from := s.Address()
+	return &bind.TransactOpts{
+		From: from,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != from {
+				return nil, bind.ErrNotAuthorized
+			}
+			return s.SignTx(tx, big.NewInt(ChainID))
+		},
+		Context: context.Background(),
+	}
+}
+
+// tokenBytecode returns the creation code of the test token. The balances
+// are stored in the storage slot of the address of each holder.
+func tokenBytecode() []byte {
+	transferTopic := web3.ERC20TransferTopic.Bytes()
+
+	runtime := newProgram()
+	// dispatch the function selector
+	runtime.push(0).op(vm.CALLDATALOAD).push(0xe0).op(vm.SHR)
+	runtime.op(vm.DUP1).pushBytes(selector("balanceOf(address)")).op(vm.EQ).pushLabel("balanceOf").op(vm.JUMPI)
+	runtime.op(vm.DUP1).pushBytes(selector("transfer(address,uint256)")).op(vm.EQ).pushLabel("transfer").op(vm.JUMPI)
+	runtime.label("revert").push(0).op(vm.DUP1, vm.REVERT)
+	// balanceOf(owner): return sload(owner)
+	runtime.label("balanceOf")
+	runtime.push(4).op(vm.CALLDATALOAD, vm.SLOAD).push(0).op(vm.MSTORE).push(32).push(0).op(vm.RETURN)
+	// transfer(to, value): revert if value > sload(caller)
+	runtime.label("transfer")
+	runtime.op(vm.CALLER, vm.SLOAD).push(0x24).op(vm.CALLDATALOAD)
+	runtime.op(vm.DUP1, vm.DUP3, vm.LT).pushLabel("revert").op(vm.JUMPI)
+	// sstore(caller, balance - value)
+	runtime.op(vm.DUP1, vm.SWAP2, vm.SUB, vm.CALLER, vm.SSTORE)
+	// sstore(to, sload(to) + value)
+	runtime.push(4).op(vm.CALLDATALOAD, vm.DUP1, vm.SLOAD, vm.DUP3, vm.ADD, vm.DUP2, vm.SSTORE)
+	// emit Transfer(caller, to, value) and return true
+	runtime.op(vm.SWAP1).push(0).op(vm.MSTORE)
+	runtime.op(vm.CALLER).pushBytes(transferTopic).push(32).push(0).op(vm.LOG3)
+	runtime.push(1).push(0).op(vm.MSTORE).push(32).push(0).op(vm.RETURN)
+	runtimeCode := runtime.bytes()
+
+	constructor := newProgram()
+	// load the supply from the last word of the code
+	constructor.push(32).push(32).op(vm.CODESIZE, vm.SUB).push(0).op(vm.CODECOPY)
+	// sstore(caller, supply) and emit Transfer(0, caller, supply)
+	constructor.push(0).op(vm.MLOAD, vm.CALLER, vm.SSTORE)
+	constructor.op(vm.CALLER).push(0).pushBytes(transferTopic).push(32).push(0).op(vm.LOG3)
+	// return the runtime code, placed right after the constructor
+	constructor.pushUint16(len(runtimeCode)).op(vm.DUP1).pushLabel("runtime").push(0).op(vm.CODECOPY)
+	constructor.push(0).op(vm.RETURN)
+	constructor.labels["runtime"] = len(constructor.code)
+	return append(constructor.bytes(), runtimeCode...)
+}
+
+// selector returns the function selector of the signature provided.
+func selector(signature string) []byte {
+	return crypto.Keccak256([]byte(signature))[:4]
+}
+
+// program is a minimal EVM assembler with support for jump labels.
+type program struct {
+	code   []byte
+	labels map[string]int
+	// jumps maps the offset of the PUSH2 placeholders to their label
+	jumps map[int]string
+}
+
+func newProgram() *program {
+	return &program{labels: make(map[string]int), jumps: make(map[int]string)}
+}
+
+func (p *program) op(ops ...vm.OpCode) *program {
+	for _, op := range ops {
+		p.code = append(p.code, byte(op))
+	}
+	return p
+}
+
+func (p *program) push(v uint64) *program {
+	if v == 0 {
+		return p.pushBytes([]byte{0})
+	}
+	return p.pushBytes(new(big.Int).SetUint64(v).Bytes())
+}
+
+func (p *program) pushUint16(v int) *program {
+	return p.pushBytes(binary.BigEndian.AppendUint16(nil, uint16(v)))
+}
+
+func (p *program) pushBytes(data []byte) *program {
+	p.code = append(p.code, byte(vm.PUSH1)+byte(len(data)-1))
+	p.code = append(p.code, data...)
+	return p
+}
+
+func (p *program) pushLabel(name string) *program {
+	p.jumps[len(p.code)+1] = name
+	return p.pushUint16(0)
+}
+
+func (p *program) label(name string) *program {
+	p.labels[name] = len(p.code)
+	return p.op(vm.JUMPDEST)
+}
+
+// bytes returns the code with the jump labels resolved.
+func (p *program) bytes() []byte {
+	for offset, name := range p.jumps {
+		binary.BigEndian.PutUint16(p.code[offset:], uint16(p.labels[name]))
+	}
+	return p.code
+}